@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"image/png"
+	"os"
+
+	"mapviewer/internal/camera"
+	"mapviewer/internal/headless"
+)
+
+func main() {
+	lat := flag.Float64("lat", camera.DefaultLat, "center latitude")
+	lon := flag.Float64("lon", camera.DefaultLon, "center longitude")
+	zoom := flag.Int("zoom", camera.DefaultZoom, "zoom level")
+	width := flag.Int("width", camera.DefaultWidth, "image width in pixels")
+	height := flag.Int("height", camera.DefaultHeight, "image height in pixels")
+	out := flag.String("out", "map.png", "output PNG file")
+	flag.Parse()
+
+	img, err := headless.RenderImage(*lat, *lon, *zoom, *width, *height)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, img); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Saved %dx%d map to %s\n", *width, *height, *out)
+}
@@ -1,30 +1,57 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 
 	"mapviewer/internal/app"
+	"mapviewer/internal/camera"
+	"mapviewer/internal/sources"
 )
 
 func main() {
+	at := flag.String("at", "", "start at a permalink (zoom/lat/lon, as printed by P)")
+	flag.Parse()
+
+	var start *camera.CameraState
+	if *at != "" {
+		state, err := camera.DecodeHash(*at)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		start = &state
+	}
+
 	fmt.Println("Map Viewer - WebGPU")
 	fmt.Println("Controls:")
 	fmt.Println("  Mouse drag    : Pan")
+	fmt.Println("  Mouse click   : Identify features")
 	fmt.Println("  Mouse wheel   : Zoom")
 	fmt.Println("  WASD / Arrows : Pan")
 	fmt.Println("  Shift         : Zoom in")
 	fmt.Println("  Space         : Zoom out")
+	fmt.Println("  N             : Toggle night mode")
+	fmt.Println("  M             : Toggle measure mode (click two points)")
+	fmt.Println("  C             : Clear tile caches")
+	fmt.Println("  P             : Print permalink")
+	fmt.Println("  F11           : Toggle fullscreen")
+	fmt.Println("  F12           : Save screenshot")
 	fmt.Println("  Escape        : Exit")
 	fmt.Println()
 
-	application, err := app.New()
+	application, err := app.New(sources.Sources{})
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
 	defer application.Cleanup()
 
+	if start != nil {
+		application.GoTo(*start)
+	}
+
 	if err := application.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"mapviewer/internal/mbtiles"
+)
+
+func main() {
+	cacheDir := flag.String("cache", ".tile_cache", "tile cache directory to export")
+	out := flag.String("out", "tiles.mbtiles", "output MBTiles file")
+	name := flag.String("name", "Map Viewer cache", "tileset name stored in the metadata")
+	flag.Parse()
+
+	n, err := mbtiles.Export(*cacheDir, *out, *name)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Exported %d tiles to %s\n", n, *out)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"mapviewer/internal/logging"
+	"mapviewer/internal/tileserver"
+	"mapviewer/internal/vectortile"
+)
+
+func main() {
+	port := flag.Int("port", 8080, "HTTP port")
+	cacheDir := flag.String("cache", ".tile_cache", "raster tile cache directory")
+	vectorDir := flag.String("vector-cache", ".vector_cache", "vector tile cache directory")
+	cors := flag.String("cors", "", "comma-separated origins allowed cross-origin access (* = any)")
+	logLevel := flag.String("log-level", "info", "log level: debug, info, warn, error or off")
+	exportManifest := flag.String("export-manifest", "", "write the list of cached tiles to this file and exit")
+	warm := flag.String("warm", "", "fetch the tiles listed in this manifest file in the background")
+	flag.Parse()
+
+	if err := logging.SetLevelName(*logLevel); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	cache, err := tileserver.NewTileCache(*cacheDir, 8, 0, 0)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer cache.Close()
+
+	if *exportManifest != "" {
+		if err := writeManifest(cache, *exportManifest); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if *warm != "" {
+		f, err := os.Open(*warm)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		go func() {
+			defer f.Close()
+			n, err := cache.ImportManifest(ctx, f)
+			if err != nil {
+				logging.Warnf("warming from %s: %v", *warm, err)
+			}
+			logging.Infof("Warmed %d tiles from %s", n, *warm)
+		}()
+	}
+
+	vectorCache, err := vectortile.NewVectorTileCache(*vectorDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer vectorCache.Close()
+
+	server := tileserver.NewServer(cache, vectorCache, *port)
+	if *cors != "" {
+		server.AllowedOrigins = strings.Split(*cors, ",")
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- server.Start() }()
+
+	select {
+	case err := <-errCh:
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+	case <-ctx.Done():
+		fmt.Println("Shutting down...")
+		if err := server.Stop(); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		}
+		<-errCh
+	}
+}
+
+// writeManifest writes the cache's tile manifest to path
+func writeManifest(cache *tileserver.TileCache, path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := cache.ExportManifest(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -1,12 +1,19 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
+
 	"mapviewer/internal/vectortile"
 )
 
 func main() {
-	cache := vectortile.NewVectorTileCache()
+	cache, err := vectortile.NewVectorTileCache(".vector_cache")
+	if err != nil {
+		fmt.Printf("Error: %v\n", err)
+		return
+	}
 
 	// Fetch tile for Amsterdam area at zoom 10
 	// Amsterdam is around lat 52.37, lon 4.90
@@ -26,6 +33,13 @@ func main() {
 		}
 	}
 
+	fmt.Printf("\n=== POIs: %d ===\n", len(data.POIs))
+	for i, p := range data.POIs {
+		if i < 10 {
+			fmt.Printf("  %s (%s/%s) rank=%d\n", p.Name, p.Class, p.Subclass, p.Rank)
+		}
+	}
+
 	fmt.Printf("\n=== Transport lines: %d ===\n", len(data.Transport))
 	classes := make(map[string]int)
 	for _, t := range data.Transport {
@@ -49,4 +63,18 @@ func main() {
 	// Filter example: only rail
 	rail := vectortile.FilterTransportByClass(data.Transport, "rail")
 	fmt.Printf("\n=== Rail lines: %d ===\n", len(rail))
+
+	// Optionally dump the tile as GeoJSON: vectortest out.geojson
+	if len(os.Args) > 1 {
+		out, err := json.MarshalIndent(data.ToGeoJSON(), "", "  ")
+		if err != nil {
+			fmt.Printf("GeoJSON error: %v\n", err)
+			return
+		}
+		if err := os.WriteFile(os.Args[1], out, 0644); err != nil {
+			fmt.Printf("Write error: %v\n", err)
+			return
+		}
+		fmt.Printf("\nWrote GeoJSON to %s\n", os.Args[1])
+	}
 }
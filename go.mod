@@ -4,13 +4,15 @@ go 1.24.0
 
 require (
 	github.com/go-gl/glfw/v3.3/glfw v0.0.0-20250301202403-da16c1255728
+	github.com/mattn/go-sqlite3 v1.14.32
+	github.com/paulmach/orb v0.12.0
 	github.com/rajveermalviya/go-webgpu/wgpu v0.17.1
+	golang.org/x/image v0.24.0
 )
 
 require (
 	github.com/AllenDang/cimgui-go v1.4.0 // indirect
 	github.com/gogo/protobuf v1.3.2 // indirect
-	github.com/paulmach/orb v0.12.0 // indirect
 	github.com/paulmach/protoscan v0.2.1 // indirect
 	go.mongodb.org/mongo-driver v1.11.4 // indirect
 )
@@ -1,31 +1,59 @@
 package app
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"image/png"
+	"math"
+	"os"
 	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-gl/glfw/v3.3/glfw"
+	"github.com/paulmach/orb"
 	"github.com/rajveermalviya/go-webgpu/wgpu"
 
 	"mapviewer/internal/camera"
 	"mapviewer/internal/config"
+	"mapviewer/internal/logging"
 	"mapviewer/internal/renderer"
-	"mapviewer/internal/tileserver"
-	"mapviewer/internal/vectortile"
+	"mapviewer/internal/sources"
 	"mapviewer/pkg/tiles"
 )
 
 const (
-	AmsterdamLat = 52.3676
-	AmsterdamLon = 4.9041
-	DefaultZoom  = 12
+	// KeyPanSpeed is the keyboard pan rate in pixels per second
+	KeyPanSpeed = 600.0
 
-	DefaultWidth  = 1280
-	DefaultHeight = 720
+	// MaxFrameDelta caps the time step so a stalled frame doesn't jump the map
+	MaxFrameDelta = 100 * time.Millisecond
 
-	KeyPanSpeed = 10.0
+	// ClickSlop is how far (in pixels) the cursor may move between press and
+	// release for it to count as a click rather than a drag
+	ClickSlop = 3.0
+
+	// CityUpdateDelay is how long the camera must rest before the city mask
+	// is refetched for the new view
+	CityUpdateDelay = 250 * time.Millisecond
+
+	// VisibleRetryInterval is how often on-screen tiles are re-requested
+	// while the view is still, so failed downloads get retried
+	VisibleRetryInterval = time.Second
+
+	// PanSmoothing is the weight of the latest frame in the pan velocity
+	// average that biases prefetching towards where the view is heading
+	PanSmoothing = 0.2
+
+	// PrefetchInterval is the least time between prefetches while the view
+	// keeps changing (scroll and key zoom, panning across tiles)
+	PrefetchInterval = 100 * time.Millisecond
+
+	// IdleWait is the longest a skipped frame in render-on-change mode
+	// sleeps; input and renderer changes (see wake) end it sooner
+	IdleWait = 100 * time.Millisecond
 )
 
 type App struct {
@@ -38,22 +66,97 @@ type App struct {
 
 	renderer        *renderer.Renderer
 	camera          *camera.Camera
-	tileCache       *tileserver.TileCache
-	vectorTileCache *vectortile.VectorTileCache
+	tileCache       sources.RasterTileSource
+	vectorTileCache sources.VectorTileSource
 
 	keys   map[glfw.Key]bool
 	keysMu sync.RWMutex
 
-	tileRequests chan tiles.TileCoord
+	// Cursor position at the last left-button press, for click detection
+	pressX, pressY float64
+
+	// Scroll offset accumulated towards the next zoom step
+	scrollAccum float64
+
+	// Windowed position and size to restore when leaving fullscreen
+	windowedX, windowedY int
+	windowedW, windowedH int
+
+	// Measure mode (see toggleMeasure): the pending start point and the
+	// status shown in the title bar
+	measuring   bool
+	measureFrom *orb.Point
+	measureText string
+
+	// Lat/lon under the cursor, shown in the window title
+	cursorGeo string
+	fps       int
+
+	tileRequests *requestQueue
+	missingTiles *missingTiles // Tiles the source doesn't have
+	tileErrors   errorLog
 	stopChan     chan struct{}
+	wakeMu       sync.RWMutex // Orders wake calls against Cleanup closing stopChan
+
+	// Each zoom change starts a new generation; older requests get cancelled
+	viewCtx    context.Context
+	viewCancel context.CancelFunc
+	viewMu     sync.Mutex
+
+	// viewGen counts frames in which the camera moved; lastView is the
+	// camera position it was last compared against
+	viewGen  atomic.Uint64
+	lastView [3]float64
+
+	// Smoothed camera velocity in screen pixels per second (positive east
+	// and south), from the world pixel position and tile of the last frame
+	panVelocity [2]float64
+	lastPixel   [2]float64
+	lastCenter  tiles.TileCoord
+
+	// Tiles already queued for the current view, so moves only enqueue the
+	// tiles that came into view (see queueVisibleTiles and prefetchTiles)
+	queuedVisible map[tiles.TileCoord]bool
+	queuedCtx     context.Context
+	queuedSize    [2]int
+	queuedGen     uint64    // viewGen of the last visible pass
+	fullGen       uint64    // viewGen of the last full visible pass
+	fullAt        time.Time // Time of the last full visible pass
+	prefetched    map[tiles.TileCoord]bool
+	prefetchZoom  int
+
+	// Pending debounced UpdateCitiesForView call
+	cityTimer *time.Timer
+
+	// Rate-limits prefetchTiles during continuous movement
+	prefetch debouncer
+
+	// changed is set by input and config reloads so render-on-change mode
+	// draws the next frame; idle means the last frame was skipped
+	changed atomic.Bool
+	idle    bool
 
 	width, height int
+
+	// Stops the config.json watcher
+	stopConfigWatch func()
 }
 
-func New() (*App, error) {
+// New opens the viewer window. Sources left nil in src are created from
+// config; the App takes ownership of all of them and closes them on Cleanup.
+// On error the window, GPU objects and every source are already released.
+func New(src sources.Sources) (*App, error) {
 	runtime.LockOSThread()
+	setLogLevel(config.Get().LogLevel)
+
+	// The request queue is sized from these before any source is opened
+	if err := config.Get().Cache.Validate(); err != nil {
+		src.Close()
+		return nil, fmt.Errorf("invalid cache config: %w", err)
+	}
 
 	if err := glfw.Init(); err != nil {
+		src.Close()
 		return nil, fmt.Errorf("GLFW init failed: %w", err)
 	}
 
@@ -61,50 +164,63 @@ func New() (*App, error) {
 	glfw.WindowHint(glfw.Resizable, glfw.True)
 	glfw.WindowHint(glfw.CocoaRetinaFramebuffer, glfw.True)
 
-	window, err := glfw.CreateWindow(DefaultWidth, DefaultHeight, "Map Viewer - Amsterdam", nil, nil)
+	window, err := glfw.CreateWindow(camera.DefaultWidth, camera.DefaultHeight, "Map Viewer - Amsterdam", nil, nil)
 	if err != nil {
 		glfw.Terminate()
+		src.Close()
 		return nil, fmt.Errorf("window creation failed: %w", err)
 	}
 
 	app := &App{
-		window:       window,
-		width:        DefaultWidth,
-		height:       DefaultHeight,
-		keys:         make(map[glfw.Key]bool),
-		tileRequests: make(chan tiles.TileCoord, 500),
-		stopChan:     make(chan struct{}),
+		window:   window,
+		width:    camera.DefaultWidth,
+		height:   camera.DefaultHeight,
+		keys:     make(map[glfw.Key]bool),
+		stopChan: make(chan struct{}),
 	}
+	app.viewCtx, app.viewCancel = context.WithCancel(context.Background())
+	app.prefetch = debouncer{interval: PrefetchInterval, fn: app.prefetchTiles}
 
+	// From here on Cleanup releases whatever was created before a failure
 	if err := app.initWebGPU(); err != nil {
-		window.Destroy()
-		glfw.Terminate()
+		app.Cleanup()
+		src.Close()
 		return nil, err
 	}
 
-	cache, err := tileserver.NewTileCache(".tile_cache", 8)
-	if err != nil {
-		return nil, fmt.Errorf("tile cache creation failed: %w", err)
-	}
-	app.tileCache = cache
-
-	// Initialize vector tile cache
-	app.vectorTileCache = vectortile.NewVectorTileCache()
+	// Load config and pick up edits while running
+	cfg := config.Get()
+	app.stopConfigWatch = config.Watch("config.json", func(cfg *config.Config) {
+		setLogLevel(cfg.LogLevel)
+		app.changed.Store(true)
+		logging.Infof("Reloaded config.json")
+	})
+	app.tileRequests = newRequestQueue(cfg.Cache.RequestQueueSize)
+	app.missingTiles = newMissingTiles()
 
-	// Load config
-	_ = config.Get()
+	if src, err = sources.Open(cfg, src); err != nil {
+		app.Cleanup()
+		return nil, err
+	}
+	app.tileCache, app.vectorTileCache = src.Raster, src.Vector
+	logging.Infof("Vector tiles: %s", app.vectorTileCache.URLTemplate())
 
-	app.camera = camera.NewCamera(AmsterdamLat, AmsterdamLon, DefaultZoom, DefaultWidth, DefaultHeight)
+	app.camera = camera.NewCamera(camera.DefaultLat, camera.DefaultLon, camera.DefaultZoom, camera.DefaultWidth, camera.DefaultHeight)
+	if b := cfg.Bounds; b != nil {
+		app.camera.SetBounds(b.MinLat, b.MinLon, b.MaxLat, b.MaxLon)
+	}
 
-	app.renderer, err = renderer.NewRenderer(app.adapter, app.device, app.queue, app.surface, uint32(DefaultWidth), uint32(DefaultHeight), app.vectorTileCache)
+	app.renderer, err = renderer.NewRenderer(app.adapter, app.device, app.queue, app.surface, uint32(camera.DefaultWidth), uint32(camera.DefaultHeight), app.vectorTileCache, cfg.Rendering.MaxTextures, cfg.Rendering.MSAASamples)
 	if err != nil {
+		app.Cleanup()
 		return nil, fmt.Errorf("renderer creation failed: %w", err)
 	}
+	app.renderer.SetOnChange(app.wake)
 
 	app.setupCallbacks()
 
 	// Start tile loaders
-	for i := 0; i < 4; i++ {
+	for i := 0; i < cfg.Cache.TileLoaders; i++ {
 		go app.tileLoader()
 	}
 
@@ -114,9 +230,42 @@ func New() (*App, error) {
 }
 
 func (app *App) initWebGPU() error {
-	// Create instance with Metal backend explicitly
+	backend, err := renderer.SelectBackend(config.Get().Rendering.Backend)
+	if err != nil {
+		return err
+	}
+
+	if err := app.requestAdapter(backend); err != nil {
+		if backend == wgpu.InstanceBackend_Primary {
+			return err
+		}
+		logging.Warnf("no adapter for %s backend (%v), falling back to primary", renderer.BackendName(backend), err)
+		if err := app.requestAdapter(wgpu.InstanceBackend_Primary); err != nil {
+			return err
+		}
+	}
+
+	// Print adapter info
+	props := app.adapter.GetProperties()
+	logging.Infof("GPU: %s (%s)", props.Name, props.DriverDescription)
+
+	app.device, err = app.adapter.RequestDevice(&wgpu.DeviceDescriptor{
+		Label: "MapViewerDevice",
+	})
+	if err != nil {
+		return fmt.Errorf("device request failed: %w", err)
+	}
+
+	app.queue = app.device.GetQueue()
+	return nil
+}
+
+// requestAdapter creates the instance and window surface for a backend and
+// picks an adapter, releasing both again if no adapter is available
+func (app *App) requestAdapter(backend wgpu.InstanceBackend) error {
+	logging.Infof("WebGPU backend: %s", renderer.BackendName(backend))
 	app.instance = wgpu.CreateInstance(&wgpu.InstanceDescriptor{
-		Backends: wgpu.InstanceBackend_Metal,
+		Backends: backend,
 	})
 	if app.instance == nil {
 		return fmt.Errorf("failed to create WebGPU instance")
@@ -125,44 +274,52 @@ func (app *App) initWebGPU() error {
 	// Create surface
 	app.surface = CreateSurface(app.instance, app.window)
 	if app.surface == nil {
+		app.instance.Release()
+		app.instance = nil
 		return fmt.Errorf("surface creation failed")
 	}
 
-	// Request adapter - try with surface first, then without
+	// Request adapter - try with surface first, then without, then software
 	var err error
 	app.adapter, err = app.instance.RequestAdapter(&wgpu.RequestAdapterOptions{
-		CompatibleSurface: app.surface,
-		PowerPreference:   wgpu.PowerPreference_HighPerformance,
+		CompatibleSurface:    app.surface,
+		PowerPreference:      wgpu.PowerPreference_HighPerformance,
 		ForceFallbackAdapter: false,
 	})
-	if err != nil {
-		// Try without surface constraint
-		fmt.Println("Trying adapter without surface constraint...")
-		app.adapter, err = app.instance.RequestAdapter(&wgpu.RequestAdapterOptions{
-			PowerPreference: wgpu.PowerPreference_HighPerformance,
-		})
-		if err != nil {
-			return fmt.Errorf("adapter request failed: %w", err)
-		}
+	if err == nil {
+		return nil
 	}
 
-	// Print adapter info
-	props := app.adapter.GetProperties()
-	fmt.Printf("GPU: %s (%s)\n", props.Name, props.DriverDescription)
+	// Try without surface constraint
+	logging.Infof("Trying adapter without surface constraint...")
+	app.adapter, err = app.instance.RequestAdapter(&wgpu.RequestAdapterOptions{
+		PowerPreference: wgpu.PowerPreference_HighPerformance,
+	})
+	if err == nil {
+		return nil
+	}
 
-	app.device, err = app.adapter.RequestDevice(&wgpu.DeviceDescriptor{
-		Label: "MapViewerDevice",
+	logging.Infof("Trying software fallback adapter...")
+	app.adapter, err = app.instance.RequestAdapter(&wgpu.RequestAdapterOptions{
+		CompatibleSurface:    app.surface,
+		ForceFallbackAdapter: true,
 	})
-	if err != nil {
-		return fmt.Errorf("device request failed: %w", err)
+	if err == nil {
+		logging.Warnf("using a software (CPU) adapter; rendering will be slow")
+		return nil
 	}
 
-	app.queue = app.device.GetQueue()
-	return nil
+	renderer.LogAdapters(app.instance)
+	app.surface.Release()
+	app.surface = nil
+	app.instance.Release()
+	app.instance = nil
+	return fmt.Errorf("no %s adapter (tried surface-compatible, any GPU and software fallback): %w", renderer.BackendName(backend), err)
 }
 
 func (app *App) setupCallbacks() {
 	app.window.SetFramebufferSizeCallback(func(w *glfw.Window, width, height int) {
+		app.changed.Store(true)
 		app.width = width
 		app.height = height
 		app.camera.SetViewport(width, height)
@@ -171,13 +328,24 @@ func (app *App) setupCallbacks() {
 	})
 
 	app.window.SetMouseButtonCallback(func(w *glfw.Window, button glfw.MouseButton, action glfw.Action, mods glfw.ModifierKey) {
+		app.changed.Store(true)
 		if button == glfw.MouseButtonLeft {
 			x, y := w.GetCursorPos()
 			if action == glfw.Press {
+				app.pressX, app.pressY = x, y
 				app.camera.StartDrag(x, y)
 			} else {
 				app.camera.EndDrag()
-				app.prefetchTiles()
+				if math.Hypot(x-app.pressX, y-app.pressY) <= ClickSlop {
+					lon, lat := app.camera.ScreenToGeo(x, y)
+					if app.measuring {
+						app.measureClick(lat, lon)
+					} else {
+						go app.identify(lat, lon, app.camera.DisplayZoom())
+					}
+				} else {
+					app.prefetch.flush()
+				}
 			}
 		}
 	})
@@ -185,20 +353,39 @@ func (app *App) setupCallbacks() {
 	app.window.SetCursorPosCallback(func(w *glfw.Window, x, y float64) {
 		if app.camera.IsDragging() {
 			app.camera.Drag(x, y)
+			return
 		}
+		lon, lat := app.camera.ScreenToGeo(x, y)
+		app.cursorGeo = fmt.Sprintf("%.5f, %.5f", lat, lon)
+		app.updateTitle()
 	})
 
 	app.window.SetScrollCallback(func(w *glfw.Window, xoff, yoff float64) {
-		x, y := w.GetCursorPos()
-		if yoff > 0 {
-			app.camera.ZoomAtPoint(1, x, y)
-		} else if yoff < 0 {
-			app.camera.ZoomAtPoint(-1, x, y)
+		app.changed.Store(true)
+		threshold := config.Get().Input.ScrollZoomThreshold
+		if threshold <= 0 {
+			threshold = 1
 		}
-		app.prefetchTiles()
+
+		// Start over when the scroll direction reverses
+		if yoff*app.scrollAccum < 0 {
+			app.scrollAccum = 0
+		}
+		app.scrollAccum += yoff
+
+		steps := int(app.scrollAccum / threshold)
+		if steps == 0 {
+			return
+		}
+		app.scrollAccum -= float64(steps) * threshold
+
+		x, y := w.GetCursorPos()
+		app.camera.ZoomAtPoint(steps, x, y)
+		app.prefetch.trigger()
 	})
 
 	app.window.SetKeyCallback(func(w *glfw.Window, key glfw.Key, scancode int, action glfw.Action, mods glfw.ModifierKey) {
+		app.changed.Store(true)
 		app.keysMu.Lock()
 		if action == glfw.Press {
 			app.keys[key] = true
@@ -214,48 +401,129 @@ func (app *App) setupCallbacks() {
 				w.SetShouldClose(true)
 			case glfw.KeySpace:
 				app.camera.ZoomOut()
-				app.prefetchTiles()
+				app.prefetch.trigger()
 			case glfw.KeyLeftShift, glfw.KeyRightShift:
 				app.camera.ZoomIn()
-				app.prefetchTiles()
+				app.prefetch.trigger()
 			case glfw.KeyEqual, glfw.KeyKPAdd: // + key (= on US keyboard)
 				newRadius := config.AdjustCityRadius(5.0)
-				fmt.Printf("City radius: %.0f%%\n", newRadius)
+				logging.Infof("City radius: %.0f%%", newRadius)
 			case glfw.KeyMinus, glfw.KeyKPSubtract: // - key
 				newRadius := config.AdjustCityRadius(-5.0)
-				fmt.Printf("City radius: %.0f%%\n", newRadius)
+				logging.Infof("City radius: %.0f%%", newRadius)
 			case glfw.Key0: // Reset to 0%
 				config.SetCityRadius(0)
-				fmt.Println("City radius: 0%")
+				logging.Infof("City radius: 0%%")
 			case glfw.Key1: // Set to 100%
 				config.SetCityRadius(100)
-				fmt.Println("City radius: 100%")
+				logging.Infof("City radius: 100%%")
 			case glfw.Key5: // Set to 50%
 				config.SetCityRadius(50)
-				fmt.Println("City radius: 50%")
+				logging.Infof("City radius: 50%%")
+			case glfw.KeyN:
+				logging.Infof("Night mode: %v", config.ToggleNightMode())
+			case glfw.KeyM:
+				app.toggleMeasure()
+			case glfw.KeyC:
+				app.clearCaches()
+			case glfw.KeyP:
+				fmt.Printf("Permalink: %s\n", app.camera.State().EncodeHash())
+			case glfw.KeyF11:
+				app.toggleFullscreen()
+			case glfw.KeyF12:
+				app.saveScreenshot()
 			}
 		}
 	})
 }
 
-func (app *App) processInput() {
+// saveScreenshot writes the current view to a timestamped PNG
+func (app *App) saveScreenshot() {
+	img, err := app.renderer.Capture(app.camera)
+	if err != nil {
+		logging.Errorf("screenshot failed: %v", err)
+		return
+	}
+
+	path := fmt.Sprintf("screenshot_%s.png", time.Now().Format("20060102_150405"))
+	f, err := os.Create(path)
+	if err != nil {
+		logging.Errorf("screenshot failed: %v", err)
+		return
+	}
+	defer f.Close()
+
+	if err := png.Encode(f, img); err != nil {
+		logging.Errorf("screenshot failed: %v", err)
+		return
+	}
+	logging.Infof("Saved screenshot to %s", path)
+}
+
+// clearCaches empties the raster and vector tile caches and the uploaded
+// textures, then requests the view again
+func (app *App) clearCaches() {
+	if err := app.tileCache.Clear(); err != nil {
+		logging.Warnf("%v", err)
+	}
+	app.vectorTileCache.Clear()
+	app.renderer.ReleaseTextures()
+	app.renderer.ResetVectorTiles()
+
+	// Start a new view generation so every tile is queued again
+	app.prefetched = nil
+	app.prefetchTiles()
+	logging.Infof("Cleared tile caches")
+}
+
+// identify prints the vector features under a clicked point
+func (app *App) identify(lat, lon float64, zoom int) {
+	result, err := app.vectorTileCache.QueryPoint(lat, lon, zoom)
+	if err != nil {
+		logging.Errorf("identify failed at (%.5f, %.5f): %v", lat, lon, err)
+		return
+	}
+
+	fmt.Printf("At (%.5f, %.5f):\n", lat, lon)
+	for _, p := range result.Places {
+		fmt.Printf("  place: %s (%s, rank %d)\n", p.Name, p.Class, p.Rank)
+	}
+	for _, p := range result.POIs {
+		fmt.Printf("  poi: %s (%s/%s, rank %d)\n", p.Name, p.Class, p.Subclass, p.Rank)
+	}
+	for _, t := range result.Transport {
+		fmt.Printf("  transport: %s\n", t.Class)
+	}
+	if len(result.Places)+len(result.POIs)+len(result.Transport) == 0 {
+		fmt.Println("  nothing here")
+	}
+}
+
+// processInput applies held keys for a frame that took dt
+func (app *App) processInput(dt time.Duration) {
 	app.keysMu.RLock()
 	defer app.keysMu.RUnlock()
 
+	if dt > MaxFrameDelta {
+		dt = MaxFrameDelta
+	}
+	step := KeyPanSpeed * dt.Seconds()
 	panX, panY := 0.0, 0.0
 
-	// W/Up = move map down = camera moves up = positive pan
+	// Same convention as dragging (see Camera.Pan): the deltas move the map
+	// content, so W/Up slides it down to look north and A/Left slides it
+	// right to look west
 	if app.keys[glfw.KeyW] || app.keys[glfw.KeyUp] {
-		panY += KeyPanSpeed
+		panY += step
 	}
 	if app.keys[glfw.KeyS] || app.keys[glfw.KeyDown] {
-		panY -= KeyPanSpeed
+		panY -= step
 	}
 	if app.keys[glfw.KeyA] || app.keys[glfw.KeyLeft] {
-		panX += KeyPanSpeed
+		panX += step
 	}
 	if app.keys[glfw.KeyD] || app.keys[glfw.KeyRight] {
-		panX -= KeyPanSpeed
+		panX -= step
 	}
 
 	if panX != 0 || panY != 0 {
@@ -267,68 +535,296 @@ func (app *App) processInput() {
 
 func (app *App) tileLoader() {
 	for {
-		select {
-		case <-app.stopChan:
+		req, ok := app.tileRequests.pop(app.stopChan)
+		if !ok {
 			return
-		case coord := <-app.tileRequests:
-			if app.renderer.HasTile(coord) {
+		}
+		coord := req.coord
+		if req.stale(app.viewGen.Load()) || app.renderer.HasTile(coord) || app.missingTiles.has(coord) {
+			continue
+		}
+		data, err := app.tileCache.GetTileCtx(req.ctx, coord)
+		if err != nil {
+			if req.ctx.Err() != nil {
+				// View moved on; the tile is no longer wanted
 				continue
 			}
-			data, err := app.tileCache.GetTile(coord)
-			if err != nil {
-				fmt.Printf("Tile load error %s: %v\n", coord.String(), err)
+			if sources.IsTileNotFound(err) {
+				// Expected (e.g. open ocean); the placeholder stays
+				app.missingTiles.add(coord)
 				continue
 			}
-			fmt.Printf("Loaded tile %s (%d bytes)\n", coord.String(), len(data))
-			if err := app.renderer.UploadTile(coord, data); err != nil {
-				fmt.Printf("Upload error %s: %v\n", coord.String(), err)
+			app.tileErrors.printf("tile load failed %s: %v", coord.String(), err)
+			continue
+		}
+		logging.Debugf("Loaded tile %s (%d bytes)", coord.String(), len(data))
+		err = app.renderer.UploadTile(coord, data)
+		if errors.Is(err, renderer.ErrCorruptTile) {
+			// Probably a bad cached copy; drop it and download once more
+			logging.Warnf("corrupt tile %s, fetching again", coord.String())
+			app.tileCache.Invalidate(coord)
+			if data, err = app.tileCache.GetTileCtx(req.ctx, coord); err == nil {
+				err = app.renderer.UploadTile(coord, data)
 			}
 		}
+		if err != nil && req.ctx.Err() == nil {
+			logging.Errorf("upload failed %s: %v", coord.String(), err)
+		}
 	}
 }
 
+// currentViewCtx returns the context for the current view generation
+func (app *App) currentViewCtx() context.Context {
+	app.viewMu.Lock()
+	defer app.viewMu.Unlock()
+	return app.viewCtx
+}
+
+// newViewGeneration cancels requests for the previous view and returns a
+// context for the new one
+func (app *App) newViewGeneration() context.Context {
+	app.viewMu.Lock()
+	defer app.viewMu.Unlock()
+	app.viewCancel()
+	app.viewCtx, app.viewCancel = context.WithCancel(context.Background())
+	return app.viewCtx
+}
+
+// prefetchTiles queues the tiles around the view that weren't queued for
+// the previous one. Only a zoom change starts a new view generation; after
+// a pan, requests for tiles that left the area are dropped instead.
 func (app *App) prefetchTiles() {
-	tilesToLoad := tiles.GetPrefetchTiles(app.camera.Lat, app.camera.Lon, app.camera.Zoom, app.width, app.height)
+	ctx := app.currentViewCtx()
+	if app.prefetched == nil || app.camera.Zoom != app.prefetchZoom {
+		ctx = app.newViewGeneration()
+		app.prefetched = nil
+		app.prefetchZoom = app.camera.Zoom
+	}
+
+	app.queueVisibleTiles(ctx)
+	gen := app.viewGen.Load()
+	tilesToLoad := tiles.GetDirectionalPrefetchTiles(app.camera.Lat, app.camera.Lon, app.camera.Zoom,
+		app.width, app.height, app.panVelocity[0], app.panVelocity[1])
+	wanted := make(map[tiles.TileCoord]bool, len(tilesToLoad)+len(app.queuedVisible))
+	for coord := range app.queuedVisible {
+		wanted[coord] = true
+	}
 	for _, coord := range tilesToLoad {
-		select {
-		case app.tileRequests <- coord:
-		default:
-		}
+		wanted[coord] = true
 	}
+	queued := app.tileRequests.retain(wanted, gen)
 
-	// Update city data for the current view
-	go app.renderer.UpdateCitiesForView(app.camera.Lat, app.camera.Lon, app.camera.Zoom)
+	for i, coord := range tilesToLoad {
+		if queued[coord] {
+			continue
+		}
+		if app.prefetched[coord] && (app.renderer.HasTile(coord) || app.missingTiles.has(coord)) {
+			continue
+		}
+		priority := priorityPrefetch
+		if coord.Zoom == app.camera.Zoom {
+			priority = priorityAdjacent
+		}
+		app.tileRequests.push(tileRequest{coord: coord, ctx: ctx, gen: gen, priority: priority, rank: i})
+	}
+	app.prefetched = make(map[tiles.TileCoord]bool, len(tilesToLoad))
+	for _, coord := range tilesToLoad {
+		app.prefetched[coord] = true
+	}
 }
 
 func (app *App) loadVisibleTiles() {
+	app.queueVisibleTiles(app.currentViewCtx())
+}
+
+// queueVisibleTiles requests missing on-screen tiles ahead of everything
+// else. Usually only tiles that just came into view are queued; every
+// MaxStaleGenerations/2 moving frames, every VisibleRetryInterval and on a
+// new view generation all of them are, so queued ones never go stale and
+// failed ones are retried.
+func (app *App) queueVisibleTiles(ctx context.Context) {
+	gen := app.viewGen.Load()
+	size := [2]int{app.width, app.height}
+	full := ctx != app.queuedCtx || gen-app.fullGen >= MaxStaleGenerations/2 ||
+		time.Since(app.fullAt) >= VisibleRetryInterval
+	if !full && gen == app.queuedGen && size == app.queuedSize {
+		return
+	}
+
 	visible := tiles.GetVisibleTiles(app.camera.Lat, app.camera.Lon, app.camera.Zoom, app.width, app.height)
-	for _, coord := range visible {
-		if !app.renderer.HasTile(coord) {
-			select {
-			case app.tileRequests <- coord:
-			default:
-			}
+	queued := make(map[tiles.TileCoord]bool, len(visible))
+	for i, coord := range visible {
+		queued[coord] = true
+		if !full && app.queuedVisible[coord] {
+			continue
+		}
+		if !app.renderer.HasTile(coord) && !app.missingTiles.has(coord) {
+			app.tileRequests.push(tileRequest{coord: coord, ctx: ctx, gen: gen, priority: priorityVisible, rank: i})
+		}
+	}
+
+	app.queuedVisible = queued
+	app.queuedCtx = ctx
+	app.queuedSize = size
+	app.queuedGen = gen
+	if full {
+		app.fullGen = gen
+		app.fullAt = time.Now()
+	}
+}
+
+// setLogLevel applies the configured log level, keeping the current one if
+// the name is invalid
+func setLogLevel(name string) {
+	if err := logging.SetLevelName(name); err != nil {
+		logging.Warnf("%v", err)
+	}
+}
+
+// trackViewChanges starts a new view generation if the camera moved since
+// the last frame, and updates the pan velocity. Moving into another tile
+// re-runs prefetching so it follows the motion.
+func (app *App) trackViewChanges(dt time.Duration) {
+	view := [3]float64{app.camera.Lat, app.camera.Lon, float64(app.camera.Zoom)}
+	zoomed := view[2] != app.lastView[2]
+	if view != app.lastView {
+		app.lastView = view
+		app.viewGen.Add(1)
+		app.scheduleCityUpdate()
+	}
+
+	size := float64(tiles.TileSize())
+	tx, ty := tiles.Project(app.camera.Lat, app.camera.Lon, app.camera.Zoom)
+	pixel := [2]float64{tx * size, ty * size}
+	if zoomed || dt <= 0 {
+		app.panVelocity = [2]float64{}
+	} else {
+		// Take the short way round across the antimeridian
+		world := size * math.Exp2(float64(app.camera.Zoom))
+		dx := pixel[0] - app.lastPixel[0]
+		dx -= world * math.Round(dx/world)
+		dy := pixel[1] - app.lastPixel[1]
+		app.panVelocity[0] += PanSmoothing * (dx/dt.Seconds() - app.panVelocity[0])
+		app.panVelocity[1] += PanSmoothing * (dy/dt.Seconds() - app.panVelocity[1])
+	}
+	app.lastPixel = pixel
+
+	center := tiles.LatLonToTile(app.camera.Lat, app.camera.Lon, app.camera.Zoom)
+	if center != app.lastCenter {
+		app.lastCenter = center
+		if !zoomed {
+			// Zooming prefetches on its own
+			app.prefetch.trigger()
 		}
 	}
 }
 
+// wake makes an idle Run loop in render-on-change mode draw the next frame
+// without waiting for IdleWait. It is safe to call from any goroutine.
+func (app *App) wake() {
+	if !config.Get().Rendering.RenderOnChange {
+		return
+	}
+	app.wakeMu.RLock()
+	defer app.wakeMu.RUnlock()
+	select {
+	case <-app.stopChan:
+		// GLFW may already be terminated
+	default:
+		glfw.PostEmptyEvent()
+	}
+}
+
+// debouncer runs fn at most once per interval, plus once more after the
+// last trigger it held back. It is only used from the main thread.
+type debouncer struct {
+	interval time.Duration
+	fn       func()
+	last     time.Time
+	pending  bool
+}
+
+// trigger runs fn now if the interval has passed, otherwise leaves it for
+// poll
+func (d *debouncer) trigger() {
+	if time.Since(d.last) < d.interval {
+		d.pending = true
+		return
+	}
+	d.flush()
+}
+
+// poll runs a held-back fn once the interval has passed; call it every frame
+func (d *debouncer) poll() {
+	if d.pending && time.Since(d.last) >= d.interval {
+		d.flush()
+	}
+}
+
+// flush runs fn now, dropping any held-back call
+func (d *debouncer) flush() {
+	d.pending = false
+	d.last = time.Now()
+	d.fn()
+}
+
+// scheduleCityUpdate refreshes the city mask for the current view once the
+// camera has rested for CityUpdateDelay, so panning doesn't refetch city
+// tiles every frame
+func (app *App) scheduleCityUpdate() {
+	if app.cityTimer != nil {
+		app.cityTimer.Stop()
+	}
+	lat, lon, zoom := app.camera.Lat, app.camera.Lon, app.camera.Zoom
+	app.cityTimer = time.AfterFunc(CityUpdateDelay, func() {
+		select {
+		case <-app.stopChan:
+			return
+		default:
+		}
+		app.renderer.UpdateCitiesForView(lat, lon, zoom)
+	})
+}
+
 func (app *App) Run() error {
 	lastTime := time.Now()
+	lastFrame := lastTime
 	frames := 0
+	app.changed.Store(true)
 
 	for !app.window.ShouldClose() {
-		glfw.PollEvents()
-		app.processInput()
+		if app.idle {
+			// Nothing changed last frame; sleep until input or a tile arrives
+			glfw.WaitEventsTimeout(IdleWait.Seconds())
+		} else {
+			glfw.PollEvents()
+		}
+		now := time.Now()
+		gen := app.viewGen.Load()
+		app.processInput(now.Sub(lastFrame))
+		app.trackViewChanges(now.Sub(lastFrame))
+		app.prefetch.poll()
+		lastFrame = now
 		app.loadVisibleTiles()
 
-		if err := app.renderer.Render(app.camera); err != nil {
-			fmt.Printf("Render error: %v\n", err)
+		rendering := config.Get().Rendering
+		redraw := app.changed.Swap(false) || app.renderer.NeedsRedraw() || app.viewGen.Load() != gen
+		app.idle = rendering.RenderOnChange && !redraw
+		if !app.idle {
+			if err := app.renderer.Render(app.camera); err != nil {
+				logging.Errorf("render failed: %v", err)
+			}
+			frames++
+
+			// Sleep out the rest of the frame to stay under MaxFPS
+			if rendering.MaxFPS > 0 {
+				time.Sleep(time.Until(now.Add(time.Second / time.Duration(rendering.MaxFPS))))
+			}
 		}
 
-		frames++
 		if time.Since(lastTime) >= time.Second {
-			radius := config.GetCityRadius()
-			app.window.SetTitle(fmt.Sprintf("Map Viewer | Zoom: %d | City: %.0f%% | FPS: %d", app.camera.Zoom, radius, frames))
+			app.fps = frames
+			app.updateTitle()
 			frames = 0
 			lastTime = time.Now()
 		}
@@ -337,14 +833,105 @@ func (app *App) Run() error {
 	return nil
 }
 
+// tileProgress returns how many of the visible tiles are done: uploaded, or
+// known not to exist
+func (app *App) tileProgress() (loaded, total int) {
+	visible := tiles.GetVisibleTiles(app.camera.Lat, app.camera.Lon, app.camera.Zoom, app.width, app.height)
+	var pending []tiles.TileCoord
+	for _, coord := range visible {
+		if !app.missingTiles.has(coord) {
+			pending = append(pending, coord)
+		}
+	}
+	loaded = len(visible) - len(pending) + app.renderer.CountLoaded(pending)
+	return loaded, len(visible)
+}
+
+// GoTo moves the view to a saved camera state, e.g. a permalink
+func (app *App) GoTo(state camera.CameraState) {
+	app.camera.Restore(state)
+	app.prefetchTiles()
+}
+
+// FitBounds moves the view to show a bounding box, with paddingPx to spare
+// on every side (see camera.Camera.FitBounds)
+func (app *App) FitBounds(minLat, minLon, maxLat, maxLon float64, paddingPx int) {
+	app.camera.FitBounds(minLat, minLon, maxLat, maxLon, paddingPx)
+	app.prefetchTiles()
+}
+
+// SetMarkers replaces the custom points pinned to the map (see
+// renderer.Marker). It is safe to call from any goroutine.
+func (app *App) SetMarkers(markers []renderer.Marker) {
+	app.renderer.SetMarkers(markers)
+}
+
+// SetRoute replaces the polyline drawn over the map (see
+// renderer.Renderer.SetRoute). It is safe to call from any goroutine.
+func (app *App) SetRoute(points []orb.Point, color [4]float32) {
+	app.renderer.SetRoute(points, color)
+}
+
+// toggleFullscreen switches between windowed mode and fullscreen on the
+// primary monitor. The framebuffer size callback resizes the swap chain.
+func (app *App) toggleFullscreen() {
+	if app.window.GetMonitor() != nil {
+		app.window.SetMonitor(nil, app.windowedX, app.windowedY, app.windowedW, app.windowedH, 0)
+		return
+	}
+
+	monitor := glfw.GetPrimaryMonitor()
+	if monitor == nil {
+		logging.Warnf("fullscreen unavailable: no monitor")
+		return
+	}
+	app.windowedX, app.windowedY = app.window.GetPos()
+	app.windowedW, app.windowedH = app.window.GetSize()
+
+	mode := monitor.GetVideoMode()
+	app.window.SetMonitor(monitor, 0, 0, mode.Width, mode.Height, mode.RefreshRate)
+}
+
+// updateTitle shows zoom, city radius, FPS, tile loading progress and the
+// cursor position in the title bar
+func (app *App) updateTitle() {
+	radius := config.GetCityRadius()
+	title := fmt.Sprintf("Map Viewer | Zoom: %d | City: %.0f%% | FPS: %d", app.camera.DisplayZoom(), radius, app.fps)
+	if loaded, total := app.tileProgress(); loaded < total {
+		title += fmt.Sprintf(" | Loading %d/%d", loaded, total)
+	}
+	if app.measureText != "" {
+		title += " | " + app.measureText
+	}
+	if app.cursorGeo != "" {
+		title += " | " + app.cursorGeo
+	}
+	app.window.SetTitle(title)
+}
+
 func (app *App) Cleanup() {
+	// No wake-ups past this point, so GLFW can be terminated
+	app.wakeMu.Lock()
 	close(app.stopChan)
+	app.wakeMu.Unlock()
+	if app.cityTimer != nil {
+		app.cityTimer.Stop()
+	}
+	if app.stopConfigWatch != nil {
+		app.stopConfigWatch()
+	}
+	app.viewMu.Lock()
+	app.viewCancel()
+	app.viewMu.Unlock()
 	if app.renderer != nil {
 		app.renderer.Release()
 	}
 	if app.tileCache != nil {
 		app.tileCache.Close()
 	}
+	if app.vectorTileCache != nil {
+		app.vectorTileCache.Close()
+	}
 	if app.queue != nil {
 		app.queue.Release()
 	}
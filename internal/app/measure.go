@@ -0,0 +1,67 @@
+package app
+
+import (
+	"fmt"
+
+	"github.com/paulmach/orb"
+
+	"mapviewer/pkg/tiles"
+)
+
+// MeasureSegments is how many straight pieces approximate the great circle
+// drawn between measured points
+const MeasureSegments = 64
+
+// MeasureColor is the color of the measured line
+var MeasureColor = [4]float32{0.85, 0.15, 0.15, 0.9}
+
+// toggleMeasure switches measure mode, in which clicks measure great-circle
+// distances instead of identifying features. The measured line is drawn as
+// the renderer's route, replacing any route set with SetRoute.
+func (app *App) toggleMeasure() {
+	app.measuring = !app.measuring
+	app.measureFrom = nil
+	app.renderer.SetRoute(nil, MeasureColor)
+	if app.measuring {
+		app.measureText = "Measure: click start"
+	} else {
+		app.measureText = ""
+	}
+	app.updateTitle()
+}
+
+// measureClick handles a click in measure mode: the first click sets the
+// start, the second shows the distance and draws the great circle between
+// the two. The next click starts a new measurement.
+func (app *App) measureClick(lat, lon float64) {
+	if app.measureFrom == nil {
+		app.measureFrom = &orb.Point{lon, lat}
+		app.renderer.SetRoute(nil, MeasureColor)
+		app.measureText = "Measure: click end"
+		app.updateTitle()
+		return
+	}
+
+	from := *app.measureFrom
+	app.measureFrom = nil
+
+	path := make([]orb.Point, MeasureSegments+1)
+	for i := range path {
+		plat, plon := tiles.Intermediate(from.Lat(), from.Lon(), lat, lon, float64(i)/MeasureSegments)
+		path[i] = orb.Point{plon, plat}
+	}
+	app.renderer.SetRoute(path, MeasureColor)
+
+	distance := formatDistance(tiles.Haversine(from.Lat(), from.Lon(), lat, lon))
+	fmt.Printf("Distance: %s\n", distance)
+	app.measureText = "Distance: " + distance
+	app.updateTitle()
+}
+
+// formatDistance formats meters as "850 m" or "12.34 km"
+func formatDistance(meters float64) string {
+	if meters < 1000 {
+		return fmt.Sprintf("%.0f m", meters)
+	}
+	return fmt.Sprintf("%.2f km", meters/1000)
+}
@@ -0,0 +1,213 @@
+package app
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+
+	"mapviewer/pkg/tiles"
+)
+
+// MaxStaleGenerations is how many moving frames a request may lag behind
+// the view before loaders skip it. Tiles still on screen are re-requested
+// at least every MaxStaleGenerations/2 moving frames, so only the trail of
+// places scrolled past goes stale.
+const MaxStaleGenerations = 30
+
+// tilePriority ranks tile requests; lower values are loaded first
+type tilePriority int
+
+const (
+	priorityVisible  tilePriority = iota // On screen now
+	priorityAdjacent                     // Same zoom, just off screen
+	priorityPrefetch                     // Neighbouring zoom levels
+)
+
+// tileRequest asks a tileLoader for a tile on behalf of a view generation.
+// ctx is cancelled when the zoom level changes; gen counts frames
+// in which the camera moved. Within a priority, lower rank (distance from
+// the center) loads first.
+type tileRequest struct {
+	coord    tiles.TileCoord
+	ctx      context.Context
+	gen      uint64
+	priority tilePriority
+	rank     int
+
+	seq   uint64 // Insertion order, to keep equal requests FIFO
+	index int    // Position in the heap
+}
+
+// less reports whether a should be loaded before b
+func (a *tileRequest) less(b *tileRequest) bool {
+	if a.priority != b.priority {
+		return a.priority < b.priority
+	}
+	if a.rank != b.rank {
+		return a.rank < b.rank
+	}
+	return a.seq < b.seq
+}
+
+// requestHeap implements heap.Interface over pending requests
+type requestHeap []*tileRequest
+
+func (h requestHeap) Len() int           { return len(h) }
+func (h requestHeap) Less(i, j int) bool { return h[i].less(h[j]) }
+func (h requestHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *requestHeap) Push(x any) {
+	req := x.(*tileRequest)
+	req.index = len(*h)
+	*h = append(*h, req)
+}
+
+func (h *requestHeap) Pop() any {
+	old := *h
+	req := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return req
+}
+
+// requestQueue is a bounded priority queue of tile requests shared by the
+// tile loaders; the least important request is dropped when it is full. A
+// tile is queued at most once; re-requesting it keeps the higher priority
+// and the newer view context and generation.
+type requestQueue struct {
+	mu      sync.Mutex
+	heap    requestHeap
+	pending map[string]*tileRequest
+	seq     uint64
+	max     int
+
+	// ready is signalled whenever a request may be available
+	ready chan struct{}
+}
+
+// newRequestQueue creates a queue holding at most max requests (at least 1)
+func newRequestQueue(max int) *requestQueue {
+	if max < 1 {
+		max = 1
+	}
+	return &requestQueue{
+		pending: make(map[string]*tileRequest),
+		max:     max,
+		ready:   make(chan struct{}, 1),
+	}
+}
+
+// push queues a request, merging it with one already queued for the tile
+func (q *requestQueue) push(r tileRequest) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	key := r.coord.String()
+	q.seq++
+	if req, ok := q.pending[key]; ok {
+		req.ctx = r.ctx
+		req.gen = r.gen
+		if r.priority < req.priority || (r.priority == req.priority && r.rank < req.rank) {
+			req.priority, req.rank = r.priority, r.rank
+		}
+		heap.Fix(&q.heap, req.index)
+		return
+	}
+
+	req := &r
+	req.seq = q.seq
+	if len(q.heap) >= q.max {
+		worst := q.worstLocked()
+		// The queue holds at least one request, so there is always a worst
+		// one. A request whose view moved on always makes room.
+		if worst.ctx.Err() == nil && !req.less(worst) {
+			return
+		}
+		heap.Remove(&q.heap, worst.index)
+		delete(q.pending, worst.coord.String())
+	}
+
+	heap.Push(&q.heap, req)
+	q.pending[key] = req
+	q.signal()
+}
+
+// retain drops queued requests for tiles not in keep and renews the
+// generation of the rest, returning the tiles still queued
+func (q *requestQueue) retain(keep map[tiles.TileCoord]bool, gen uint64) map[tiles.TileCoord]bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	queued := make(map[tiles.TileCoord]bool, len(q.heap))
+	kept := q.heap[:0]
+	for _, req := range q.heap {
+		if !keep[req.coord] {
+			delete(q.pending, req.coord.String())
+			continue
+		}
+		req.gen = gen
+		req.index = len(kept)
+		kept = append(kept, req)
+		queued[req.coord] = true
+	}
+	clear(q.heap[len(kept):])
+	q.heap = kept
+	heap.Init(&q.heap)
+	return queued
+}
+
+// worstLocked returns the request that should be dropped first, preferring
+// ones whose view has already moved on
+func (q *requestQueue) worstLocked() *tileRequest {
+	var worst *tileRequest
+	for _, req := range q.heap {
+		if req.ctx.Err() != nil {
+			return req
+		}
+		if worst == nil || req.gen < worst.gen || (req.gen == worst.gen && worst.less(req)) {
+			worst = req
+		}
+	}
+	return worst
+}
+
+// stale reports whether the view has moved too far since the request
+func (r *tileRequest) stale(currentGen uint64) bool {
+	return r.ctx.Err() != nil || currentGen-r.gen > MaxStaleGenerations
+}
+
+// pop blocks until a request is available or stop is closed
+func (q *requestQueue) pop(stop <-chan struct{}) (*tileRequest, bool) {
+	for {
+		q.mu.Lock()
+		if len(q.heap) > 0 {
+			req := heap.Pop(&q.heap).(*tileRequest)
+			delete(q.pending, req.coord.String())
+			if len(q.heap) > 0 {
+				// Wake another loader for the remaining requests
+				q.signal()
+			}
+			q.mu.Unlock()
+			return req, true
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-stop:
+			return nil, false
+		case <-q.ready:
+		}
+	}
+}
+
+// signal wakes one waiting loader without blocking
+func (q *requestQueue) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,154 @@
+package app
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"mapviewer/pkg/tiles"
+)
+
+func TestTileRequestStale(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		gen        uint64
+		currentGen uint64
+		want       bool
+	}{
+		{"current view", context.Background(), 100, 100, false},
+		{"a few frames behind", context.Background(), 90, 100, false},
+		{"at the limit", context.Background(), 100, 100 + MaxStaleGenerations, false},
+		{"past the limit", context.Background(), 100, 101 + MaxStaleGenerations, true},
+		{"zoom changed", cancelled, 100, 100, true},
+	}
+	for _, tt := range tests {
+		req := tileRequest{ctx: tt.ctx, gen: tt.gen}
+		if got := req.stale(tt.currentGen); got != tt.want {
+			t.Errorf("%s: stale = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// popAll drains the queue in load order
+func popAll(q *requestQueue) []*tileRequest {
+	stop := make(chan struct{})
+	close(stop)
+	var reqs []*tileRequest
+	for {
+		req, ok := q.pop(stop)
+		if !ok {
+			return reqs
+		}
+		reqs = append(reqs, req)
+	}
+}
+
+func TestRequestQueuePush(t *testing.T) {
+	coord := tiles.TileCoord{X: 1, Y: 2, Zoom: 5}
+	oldCtx := context.Background()
+	newCtx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	tests := []struct {
+		name         string
+		first, again tileRequest
+		wantPriority tilePriority
+		wantRank     int
+	}{
+		{"higher priority wins",
+			tileRequest{priority: priorityPrefetch, rank: 1},
+			tileRequest{priority: priorityVisible, rank: 4},
+			priorityVisible, 4},
+		{"lower priority keeps the queued one",
+			tileRequest{priority: priorityVisible, rank: 4},
+			tileRequest{priority: priorityAdjacent, rank: 0},
+			priorityVisible, 4},
+		{"same priority keeps the lower rank",
+			tileRequest{priority: priorityAdjacent, rank: 2},
+			tileRequest{priority: priorityAdjacent, rank: 7},
+			priorityAdjacent, 2},
+		{"same priority takes a lower rank",
+			tileRequest{priority: priorityAdjacent, rank: 7},
+			tileRequest{priority: priorityAdjacent, rank: 2},
+			priorityAdjacent, 2},
+	}
+	for _, tt := range tests {
+		q := newRequestQueue(10)
+		tt.first.coord, tt.first.ctx, tt.first.gen = coord, oldCtx, 1
+		tt.again.coord, tt.again.ctx, tt.again.gen = coord, newCtx, 2
+		q.push(tt.first)
+		q.push(tt.again)
+
+		reqs := popAll(q)
+		if len(reqs) != 1 {
+			t.Errorf("%s: %d requests queued for one tile", tt.name, len(reqs))
+			continue
+		}
+		req := reqs[0]
+		if req.priority != tt.wantPriority || req.rank != tt.wantRank {
+			t.Errorf("%s: priority %d rank %d, want %d %d", tt.name, req.priority, req.rank, tt.wantPriority, tt.wantRank)
+		}
+		// The newer view always takes over
+		if req.ctx != newCtx || req.gen != 2 {
+			t.Errorf("%s: kept the old view context or generation %d", tt.name, req.gen)
+		}
+	}
+}
+
+// A full queue drops requests from views that moved on first, then the
+// least important
+func TestRequestQueuePushFull(t *testing.T) {
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	ctx := context.Background()
+	tile := func(x int) tiles.TileCoord { return tiles.TileCoord{X: x, Y: 0, Zoom: 5} }
+
+	q := newRequestQueue(2)
+	q.push(tileRequest{coord: tile(0), ctx: cancelled, gen: 5, priority: priorityVisible})
+	q.push(tileRequest{coord: tile(1), ctx: ctx, gen: 5, priority: priorityPrefetch})
+	q.push(tileRequest{coord: tile(2), ctx: ctx, gen: 5, priority: priorityAdjacent})
+	// Less important than anything queued: dropped
+	q.push(tileRequest{coord: tile(3), ctx: ctx, gen: 5, priority: priorityPrefetch, rank: 9})
+
+	var got []int
+	for _, req := range popAll(q) {
+		got = append(got, req.coord.X)
+	}
+	if want := []int{2, 1}; !slices.Equal(got, want) {
+		t.Errorf("queued tiles %v, want %v", got, want)
+	}
+}
+
+func TestRequestQueueRetain(t *testing.T) {
+	ctx := context.Background()
+	tile := func(x int) tiles.TileCoord { return tiles.TileCoord{X: x, Y: 0, Zoom: 5} }
+
+	q := newRequestQueue(10)
+	for x := 0; x < 5; x++ {
+		q.push(tileRequest{coord: tile(x), ctx: ctx, gen: 1, priority: priorityAdjacent, rank: 5 - x})
+	}
+
+	queued := q.retain(map[tiles.TileCoord]bool{tile(1): true, tile(3): true, tile(7): true}, 9)
+	if len(queued) != 2 || !queued[tile(1)] || !queued[tile(3)] {
+		t.Errorf("retain reported %v queued, want tiles 1 and 3", queued)
+	}
+	if len(q.pending) != 2 {
+		t.Errorf("%d pending entries after retain, want 2", len(q.pending))
+	}
+
+	// Kept requests are renewed and still come out in priority order
+	var got []int
+	for _, req := range popAll(q) {
+		got = append(got, req.coord.X)
+		if req.gen != 9 {
+			t.Errorf("tile %d: generation %d, want 9", req.coord.X, req.gen)
+		}
+	}
+	if want := []int{3, 1}; !slices.Equal(got, want) {
+		t.Errorf("load order %v, want %v", got, want)
+	}
+}
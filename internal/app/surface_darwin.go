@@ -40,28 +40,29 @@ void* setupMetalLayer(void* nsWindow) {
 import "C"
 
 import (
-	"fmt"
 	"unsafe"
 
 	"github.com/go-gl/glfw/v3.3/glfw"
 	"github.com/rajveermalviya/go-webgpu/wgpu"
+
+	"mapviewer/internal/logging"
 )
 
 // CreateSurface creates a WebGPU surface from a GLFW window on macOS
 func CreateSurface(instance *wgpu.Instance, window *glfw.Window) *wgpu.Surface {
 	nsWindow := window.GetCocoaWindow()
 	if nsWindow == nil {
-		fmt.Println("Error: GetCocoaWindow returned nil")
+		logging.Errorf("GetCocoaWindow returned nil")
 		return nil
 	}
 
 	metalLayer := C.setupMetalLayer(nsWindow)
 	if metalLayer == nil {
-		fmt.Println("Error: setupMetalLayer returned nil")
+		logging.Errorf("setupMetalLayer returned nil")
 		return nil
 	}
 
-	fmt.Printf("Metal layer created: %p\n", metalLayer)
+	logging.Debugf("Metal layer created: %p", metalLayer)
 
 	surface := instance.CreateSurface(&wgpu.SurfaceDescriptor{
 		Label: "MainSurface",
@@ -71,7 +72,7 @@ func CreateSurface(instance *wgpu.Instance, window *glfw.Window) *wgpu.Surface {
 	})
 
 	if surface == nil {
-		fmt.Println("Error: CreateSurface returned nil")
+		logging.Errorf("CreateSurface returned nil")
 	}
 
 	return surface
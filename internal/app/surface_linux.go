@@ -0,0 +1,36 @@
+//go:build linux && !wayland
+
+package app
+
+import (
+	"unsafe"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+	"github.com/rajveermalviya/go-webgpu/wgpu"
+
+	"mapviewer/internal/logging"
+)
+
+// CreateSurface creates a WebGPU surface from a GLFW window on Linux (X11).
+// Build with -tags wayland for Wayland sessions.
+func CreateSurface(instance *wgpu.Instance, window *glfw.Window) *wgpu.Surface {
+	display := glfw.GetX11Display()
+	if display == nil {
+		logging.Errorf("GetX11Display returned nil")
+		return nil
+	}
+
+	surface := instance.CreateSurface(&wgpu.SurfaceDescriptor{
+		Label: "MainSurface",
+		XlibWindow: &wgpu.SurfaceDescriptorFromXlibWindow{
+			Display: unsafe.Pointer(display),
+			Window:  uint32(window.GetX11Window()),
+		},
+	})
+
+	if surface == nil {
+		logging.Errorf("CreateSurface returned nil")
+	}
+
+	return surface
+}
@@ -0,0 +1,35 @@
+//go:build linux && wayland
+
+package app
+
+import (
+	"unsafe"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+	"github.com/rajveermalviya/go-webgpu/wgpu"
+
+	"mapviewer/internal/logging"
+)
+
+// CreateSurface creates a WebGPU surface from a GLFW window on Linux (Wayland)
+func CreateSurface(instance *wgpu.Instance, window *glfw.Window) *wgpu.Surface {
+	display := glfw.GetWaylandDisplay()
+	if display == nil {
+		logging.Errorf("GetWaylandDisplay returned nil")
+		return nil
+	}
+
+	surface := instance.CreateSurface(&wgpu.SurfaceDescriptor{
+		Label: "MainSurface",
+		WaylandSurface: &wgpu.SurfaceDescriptorFromWaylandSurface{
+			Display: unsafe.Pointer(display),
+			Surface: unsafe.Pointer(window.GetWaylandWindow()),
+		},
+	})
+
+	if surface == nil {
+		logging.Errorf("CreateSurface returned nil")
+	}
+
+	return surface
+}
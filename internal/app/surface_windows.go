@@ -0,0 +1,38 @@
+package app
+
+/*
+#include <windows.h>
+*/
+import "C"
+
+import (
+	"unsafe"
+
+	"github.com/go-gl/glfw/v3.3/glfw"
+	"github.com/rajveermalviya/go-webgpu/wgpu"
+
+	"mapviewer/internal/logging"
+)
+
+// CreateSurface creates a WebGPU surface from a GLFW window on Windows
+func CreateSurface(instance *wgpu.Instance, window *glfw.Window) *wgpu.Surface {
+	hwnd := window.GetWin32Window()
+	if hwnd == nil {
+		logging.Errorf("GetWin32Window returned nil")
+		return nil
+	}
+
+	surface := instance.CreateSurface(&wgpu.SurfaceDescriptor{
+		Label: "MainSurface",
+		WindowsHWND: &wgpu.SurfaceDescriptorFromWindowsHWND{
+			Hinstance: unsafe.Pointer(C.GetModuleHandle(nil)),
+			Hwnd:      unsafe.Pointer(hwnd),
+		},
+	})
+
+	if surface == nil {
+		logging.Errorf("CreateSurface returned nil")
+	}
+
+	return surface
+}
@@ -0,0 +1,72 @@
+package app
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"mapviewer/internal/logging"
+	"mapviewer/pkg/tiles"
+)
+
+// MaxMissingTiles bounds the set of tiles known not to exist; it is cleared
+// when full so a long session over open ocean doesn't grow it forever
+const MaxMissingTiles = 10000
+
+// TileErrorLogInterval is the minimum time between tile error log lines;
+// errors in between are counted and reported with the next one
+const TileErrorLogInterval = 5 * time.Second
+
+// missingTiles remembers tiles the source doesn't have so they aren't
+// requested again every frame
+type missingTiles struct {
+	mu    sync.RWMutex
+	tiles map[string]bool
+}
+
+func newMissingTiles() *missingTiles {
+	return &missingTiles{tiles: make(map[string]bool)}
+}
+
+// add marks a tile as missing
+func (m *missingTiles) add(coord tiles.TileCoord) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.tiles) >= MaxMissingTiles {
+		m.tiles = make(map[string]bool)
+	}
+	m.tiles[coord.String()] = true
+}
+
+// has reports whether a tile is known to be missing
+func (m *missingTiles) has(coord tiles.TileCoord) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.tiles[coord.String()]
+}
+
+// errorLog logs at most one error per TileErrorLogInterval
+type errorLog struct {
+	mu         sync.Mutex
+	last       time.Time
+	suppressed int
+}
+
+// printf logs the message unless one was logged recently
+func (l *errorLog) printf(format string, args ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.last) < TileErrorLogInterval {
+		l.suppressed++
+		return
+	}
+	msg := fmt.Sprintf(format, args...)
+	if l.suppressed > 0 {
+		msg += fmt.Sprintf(" (%d more errors since last report)", l.suppressed)
+	}
+	logging.Errorf("%s", msg)
+	l.last = now
+	l.suppressed = 0
+}
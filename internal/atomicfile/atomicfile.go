@@ -0,0 +1,37 @@
+// Package atomicfile writes cache files so that readers, and a restart after
+// a crash, never see a partly written file.
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// TempPrefix marks cache files still being written; caches remove leftovers
+// from a crash when they start
+const TempPrefix = ".tmp-"
+
+// Write writes data to a temp file next to path and renames it into
+// place, so a crash mid-write never leaves a truncated file at path
+func Write(path string, data []byte) error {
+	f, err := os.CreateTemp(filepath.Dir(path), TempPrefix+"*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+
+	_, err = f.Write(data)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp, 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+	}
+	return err
+}
@@ -0,0 +1,134 @@
+package atomicfile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// tempFiles lists leftover temp files in dir
+func tempFiles(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), TempPrefix) {
+			names = append(names, e.Name())
+		}
+	}
+	return names
+}
+
+func TestWrite(t *testing.T) {
+	tests := []struct {
+		name     string
+		existing []byte // nil = no file yet
+		data     []byte
+	}{
+		{"new file", nil, []byte("tile data")},
+		{"overwrite", []byte("old tile data that is longer"), []byte("new")},
+		{"empty", []byte("old"), []byte{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			path := filepath.Join(dir, "1_2_3.png")
+			if tt.existing != nil {
+				if err := os.WriteFile(path, tt.existing, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := Write(path, tt.data); err != nil {
+				t.Fatal(err)
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, tt.data) {
+				t.Errorf("file holds %q, want %q", got, tt.data)
+			}
+			if info, _ := os.Stat(path); info.Mode().Perm() != 0644 {
+				t.Errorf("mode %v, want 0644", info.Mode().Perm())
+			}
+			if left := tempFiles(t, dir); len(left) != 0 {
+				t.Errorf("temp files left behind: %v", left)
+			}
+		})
+	}
+}
+
+// When the rename fails the target is untouched and the temp file removed
+func TestWriteFailure(t *testing.T) {
+	dir := t.TempDir()
+
+	// A non-empty directory can't be replaced by a file
+	target := filepath.Join(dir, "1_2_3.png")
+	if err := os.MkdirAll(filepath.Join(target, "child"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Write(target, []byte("tile")); err == nil {
+		t.Fatal("write over a directory succeeded")
+	}
+	if info, err := os.Stat(target); err != nil || !info.IsDir() {
+		t.Errorf("target changed after a failed write: %v", err)
+	}
+	if left := tempFiles(t, dir); len(left) != 0 {
+		t.Errorf("temp files left behind: %v", left)
+	}
+
+	// A missing directory fails before anything is written
+	if err := Write(filepath.Join(dir, "missing", "tile.png"), []byte("tile")); err == nil {
+		t.Error("write into a missing directory succeeded")
+	}
+}
+
+// Readers see either the old or the new tile, never a partial write
+func TestWriteConcurrentReaders(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "1_2_3.png")
+	versions := [][]byte{
+		bytes.Repeat([]byte("a"), 64<<10),
+		bytes.Repeat([]byte("b"), 32<<10),
+	}
+	if err := Write(path, versions[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			got, err := os.ReadFile(path)
+			if err != nil {
+				t.Errorf("read during write: %v", err)
+				return
+			}
+			if !bytes.Equal(got, versions[0]) && !bytes.Equal(got, versions[1]) {
+				t.Errorf("read a partial tile of %d bytes", len(got))
+				return
+			}
+		}
+	}()
+
+	for i := 0; i < 200; i++ {
+		if err := Write(path, versions[i%2]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	close(done)
+	wg.Wait()
+}
@@ -2,11 +2,20 @@ package camera
 
 import (
 	"math"
+
+	"mapviewer/pkg/tiles"
 )
 
 const (
 	MinZoom = 2
 	MaxZoom = 18
+
+	// The initial view: Amsterdam in a 1280x720 viewport
+	DefaultLat    = 52.3676
+	DefaultLon    = 4.9041
+	DefaultZoom   = 12
+	DefaultWidth  = 1280
+	DefaultHeight = 720
 )
 
 // Camera represents the map camera/viewport
@@ -38,6 +47,17 @@ type Camera struct {
 	isDragging   bool
 	lastDragX    float64
 	lastDragY    float64
+
+	// Optional region the viewport is restricted to (nil = whole world)
+	bounds *Bounds
+}
+
+// Bounds is a geographic bounding box in degrees
+type Bounds struct {
+	MinLat float64
+	MinLon float64
+	MaxLat float64
+	MaxLon float64
 }
 
 // NewCamera creates a new camera centered on given coordinates
@@ -59,26 +79,38 @@ func NewCamera(lat, lon float64, zoom int, width, height int) *Camera {
 func (c *Camera) SetViewport(width, height int) {
 	c.ViewportWidth = width
 	c.ViewportHeight = height
+	c.clampPosition()
 }
 
-// Pan moves the camera by the given pixel delta
-func (c *Camera) Pan(deltaX, deltaY float64) {
-	// Convert pixel movement to geographic movement
-	// At zoom level z, there are 2^z tiles, each 256 pixels
-	// The world is 360 degrees wide and ~170 degrees tall (Mercator)
-	scale := math.Pow(2, float64(c.Zoom))
-	tileSize := 256.0
+// SetBounds restricts panning so the visible area stays inside the given box
+func (c *Camera) SetBounds(minLat, minLon, maxLat, maxLon float64) {
+	if minLat > maxLat {
+		minLat, maxLat = maxLat, minLat
+	}
+	if minLon > maxLon {
+		minLon, maxLon = maxLon, minLon
+	}
+	c.bounds = &Bounds{MinLat: minLat, MinLon: minLon, MaxLat: maxLat, MaxLon: maxLon}
+	c.clampPosition()
+}
 
-	// Degrees per pixel
-	lonPerPixel := 360.0 / (scale * tileSize)
+// ClearBounds removes any panning restriction
+func (c *Camera) ClearBounds() {
+	c.bounds = nil
+}
 
-	// Latitude is more complex due to Mercator projection
-	latRad := c.Lat * math.Pi / 180.0
-	metersPerPixel := 156543.03392 * math.Cos(latRad) / scale
-	latPerPixel := metersPerPixel / 111319.9 // meters per degree at equator
+// GetBounds returns the current panning restriction, or nil if unrestricted
+func (c *Camera) GetBounds() *Bounds {
+	return c.bounds
+}
 
-	c.Lon -= deltaX * lonPerPixel
-	c.Lat += deltaY * latPerPixel
+// Pan moves the map content by the given pixel delta, like dragging it:
+// positive deltaX/deltaY move the content right/down, so the camera moves
+// west/north. The move is exact in Mercator pixels, not linearized around
+// the current latitude, so long pans don't drift.
+func (c *Camera) Pan(deltaX, deltaY float64) {
+	x, y := c.worldPixel(c.Lat, c.Lon)
+	c.Lat, c.Lon = c.geoAtPixel(x-deltaX, y-deltaY)
 
 	c.clampPosition()
 }
@@ -87,6 +119,7 @@ func (c *Camera) Pan(deltaX, deltaY float64) {
 func (c *Camera) ZoomIn() {
 	if c.Zoom < MaxZoom {
 		c.Zoom++
+		c.clampPosition()
 	}
 }
 
@@ -94,6 +127,7 @@ func (c *Camera) ZoomIn() {
 func (c *Camera) ZoomOut() {
 	if c.Zoom > MinZoom {
 		c.Zoom--
+		c.clampPosition()
 	}
 }
 
@@ -106,6 +140,7 @@ func (c *Camera) ZoomTo(zoom int) {
 		zoom = MaxZoom
 	}
 	c.Zoom = zoom
+	c.clampPosition()
 }
 
 // ZoomAtPoint zooms in/out centered on a specific screen point
@@ -131,53 +166,62 @@ func (c *Camera) ZoomAtPoint(delta int, screenX, screenY float64) {
 	// Get the new screen position of the same geographic point
 	newScreenX, newScreenY := c.GeoToScreen(geoX, geoY)
 
-	// Adjust camera to keep the point under the cursor
-	deltaScreenX := screenX - newScreenX
-	deltaScreenY := screenY - newScreenY
+	// Move the content so the point lands back under the cursor
+	c.Pan(screenX-newScreenX, screenY-newScreenY)
+}
+
+// FitBounds zooms to the highest zoom level at which the box fits in the
+// viewport inset by paddingPx on every side, and centers on the box. A box
+// with minLon > maxLon crosses the antimeridian. Boxes too large for
+// MinZoom get MinZoom.
+func (c *Camera) FitBounds(minLat, minLon, maxLat, maxLon float64, paddingPx int) {
+	if maxLon < minLon {
+		maxLon += 360
+	}
+	minLat = math.Max(minLat, -tiles.MaxLatitude)
+	maxLat = math.Min(maxLat, tiles.MaxLatitude)
+
+	// Box corners in zoom 0 tile units; Y grows southwards
+	x0, y0 := tiles.Project(maxLat, minLon, 0)
+	x1, y1 := tiles.Project(minLat, maxLon, 0)
+
+	availW := math.Max(float64(c.ViewportWidth-2*paddingPx), 1)
+	availH := math.Max(float64(c.ViewportHeight-2*paddingPx), 1)
+	size := float64(tiles.TileSize())
+
+	c.Zoom = MinZoom
+	for z := MaxZoom; z > MinZoom; z-- {
+		scale := math.Pow(2, float64(z)) * size
+		if (x1-x0)*scale <= availW && (y1-y0)*scale <= availH {
+			c.Zoom = z
+			break
+		}
+	}
 
-	c.Pan(-deltaScreenX, deltaScreenY)
+	c.Lat, c.Lon = tiles.Unproject((x0+x1)/2, (y0+y1)/2, 0)
+	c.clampPosition()
 }
 
 // ScreenToGeo converts screen coordinates to geographic coordinates
 func (c *Camera) ScreenToGeo(screenX, screenY float64) (lon, lat float64) {
-	scale := math.Pow(2, float64(c.Zoom))
-	tileSize := 256.0
-
 	// Center of screen in pixels from world origin
-	centerX := (c.Lon + 180.0) / 360.0 * scale * tileSize
-	latRad := c.Lat * math.Pi / 180.0
-	centerY := (1.0 - math.Log(math.Tan(latRad)+1.0/math.Cos(latRad))/math.Pi) / 2.0 * scale * tileSize
+	centerX, centerY := c.worldPixel(c.Lat, c.Lon)
 
 	// Offset from center
 	offsetX := screenX - float64(c.ViewportWidth)/2
 	offsetY := screenY - float64(c.ViewportHeight)/2
 
-	// World pixel position
-	worldX := centerX + offsetX
-	worldY := centerY + offsetY
-
-	// Convert back to geo
-	lon = worldX/(scale*tileSize)*360.0 - 180.0
-	latRad = math.Atan(math.Sinh(math.Pi * (1 - 2*worldY/(scale*tileSize))))
-	lat = latRad * 180.0 / math.Pi
-
+	lat, lon = c.geoAtPixel(centerX+offsetX, centerY+offsetY)
 	return lon, lat
 }
 
 // GeoToScreen converts geographic coordinates to screen coordinates
 func (c *Camera) GeoToScreen(lon, lat float64) (screenX, screenY float64) {
-	scale := math.Pow(2, float64(c.Zoom))
-	tileSize := 256.0
-
 	// Center of screen in pixels from world origin
-	centerX := (c.Lon + 180.0) / 360.0 * scale * tileSize
-	latRad := c.Lat * math.Pi / 180.0
-	centerY := (1.0 - math.Log(math.Tan(latRad)+1.0/math.Cos(latRad))/math.Pi) / 2.0 * scale * tileSize
+	centerX, centerY := c.worldPixel(c.Lat, c.Lon)
 
 	// Target position in world pixels
-	targetX := (lon + 180.0) / 360.0 * scale * tileSize
-	targetLatRad := lat * math.Pi / 180.0
-	targetY := (1.0 - math.Log(math.Tan(targetLatRad)+1.0/math.Cos(targetLatRad))/math.Pi) / 2.0 * scale * tileSize
+	targetX, targetY := c.worldPixel(lat, lon)
 
 	// Screen position
 	screenX = targetX - centerX + float64(c.ViewportWidth)/2
@@ -193,7 +237,7 @@ func (c *Camera) StartDrag(x, y float64) {
 	c.lastDragY = y
 }
 
-// Drag continues a drag operation
+// Drag continues a drag operation; the map content follows the cursor
 func (c *Camera) Drag(x, y float64) {
 	if !c.isDragging {
 		return
@@ -229,24 +273,74 @@ func (c *Camera) clampPosition() {
 	}
 
 	// Clamp latitude to valid Mercator range
-	if c.Lat > 85.0511 {
-		c.Lat = 85.0511
+	if c.Lat > tiles.MaxLatitude {
+		c.Lat = tiles.MaxLatitude
 	}
-	if c.Lat < -85.0511 {
-		c.Lat = -85.0511
+	if c.Lat < -tiles.MaxLatitude {
+		c.Lat = -tiles.MaxLatitude
+	}
+
+	if c.bounds != nil {
+		c.clampToBounds()
 	}
 }
 
-// GetTileBounds returns the tile coordinates for the current viewport
+// clampToBounds keeps the visible area inside c.bounds at the current zoom.
+// When the box is smaller than the viewport along an axis, the camera is
+// centered on the box along that axis instead.
+func (c *Camera) clampToBounds() {
+	halfW := float64(c.ViewportWidth) / 2
+	halfH := float64(c.ViewportHeight) / 2
+
+	// Y grows southwards, so the north edge has the smaller value
+	minX, minY := c.worldPixel(c.bounds.MaxLat, c.bounds.MinLon)
+	maxX, maxY := c.worldPixel(c.bounds.MinLat, c.bounds.MaxLon)
+
+	x, y := c.worldPixel(c.Lat, c.Lon)
+
+	if maxX-minX <= 2*halfW {
+		x = (minX + maxX) / 2
+	} else {
+		x = math.Max(minX+halfW, math.Min(x, maxX-halfW))
+	}
+	if maxY-minY <= 2*halfH {
+		y = (minY + maxY) / 2
+	} else {
+		y = math.Max(minY+halfH, math.Min(y, maxY-halfH))
+	}
+
+	c.Lat, c.Lon = c.geoAtPixel(x, y)
+}
+
+// worldPixel converts latitude/longitude to world pixels at the current
+// zoom, where the world is 2^zoom tiles of tiles.TileSize() pixels
+func (c *Camera) worldPixel(lat, lon float64) (x, y float64) {
+	size := float64(tiles.TileSize())
+	tx, ty := tiles.Project(lat, lon, c.Zoom)
+	return tx * size, ty * size
+}
+
+// geoAtPixel converts world pixels at the current zoom back to latitude/longitude
+func (c *Camera) geoAtPixel(x, y float64) (lat, lon float64) {
+	size := float64(tiles.TileSize())
+	return tiles.Unproject(x/size, y/size, c.Zoom)
+}
+
+// DisplayZoom is the zoom level on the standard 256px scale. It differs from
+// Zoom when the tile source serves larger tiles (see tiles.ZoomOffset).
+func (c *Camera) DisplayZoom() int {
+	return c.Zoom + tiles.ZoomOffset()
+}
+
+// GetTileBounds returns the tile coordinates for the current viewport. X may
+// fall outside [0, 2^zoom) near the antimeridian; use tiles.WrapX to address
+// the tile while keeping the unwrapped X for screen positioning.
 func (c *Camera) GetTileBounds() (minX, minY, maxX, maxY int) {
-	scale := math.Pow(2, float64(c.Zoom))
-	tileSize := 256.0
-	maxTile := int(scale) - 1
+	tileSize := float64(tiles.TileSize())
+	maxTile := 1<<c.Zoom - 1
 
 	// Center tile
-	centerTileX := (c.Lon + 180.0) / 360.0 * scale
-	latRad := c.Lat * math.Pi / 180.0
-	centerTileY := (1.0 - math.Log(math.Tan(latRad)+1.0/math.Cos(latRad))/math.Pi) / 2.0 * scale
+	centerTileX, centerTileY := tiles.Project(c.Lat, c.Lon, c.Zoom)
 
 	// How many tiles fit in viewport
 	tilesX := float64(c.ViewportWidth) / tileSize / 2
@@ -257,16 +351,10 @@ func (c *Camera) GetTileBounds() (minX, minY, maxX, maxY int) {
 	minY = int(math.Floor(centerTileY - tilesY - 1))
 	maxY = int(math.Ceil(centerTileY + tilesY + 1))
 
-	// Clamp to valid range
-	if minX < 0 {
-		minX = 0
-	}
+	// Clamp rows to the valid range; columns wrap around the antimeridian
 	if minY < 0 {
 		minY = 0
 	}
-	if maxX > maxTile {
-		maxX = maxTile
-	}
 	if maxY > maxTile {
 		maxY = maxTile
 	}
@@ -276,13 +364,10 @@ func (c *Camera) GetTileBounds() (minX, minY, maxX, maxY int) {
 
 // GetTileScreenPosition returns the screen position for a tile's top-left corner
 func (c *Camera) GetTileScreenPosition(tileX, tileY int) (screenX, screenY float64) {
-	scale := math.Pow(2, float64(c.Zoom))
-	tileSize := 256.0
+	tileSize := float64(tiles.TileSize())
 
 	// Center position in tile coordinates
-	centerTileX := (c.Lon + 180.0) / 360.0 * scale
-	latRad := c.Lat * math.Pi / 180.0
-	centerTileY := (1.0 - math.Log(math.Tan(latRad)+1.0/math.Cos(latRad))/math.Pi) / 2.0 * scale
+	centerTileX, centerTileY := tiles.Project(c.Lat, c.Lon, c.Zoom)
 
 	// Offset from center in tiles
 	offsetX := float64(tileX) - centerTileX
@@ -0,0 +1,275 @@
+package camera
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"mapviewer/pkg/tiles"
+)
+
+// pixelTolerance is the accepted round-trip error in screen pixels
+const pixelTolerance = 1.0
+
+var (
+	testZooms     = []int{MinZoom, 5, 10, 15, MaxZoom}
+	testViewports = [][2]int{{800, 600}, {1920, 1080}, {333, 777}}
+	testCenters   = []struct{ lat, lon float64 }{
+		{0, 0},
+		{52.37, 4.9},     // Amsterdam
+		{-33.87, 151.21}, // Sydney
+		{78.22, 15.65},   // Svalbard
+		{-54.8, -68.3},   // Ushuaia
+	}
+)
+
+// forEachView calls fn with a camera for every combination of test center,
+// zoom level and viewport size
+func forEachView(t *testing.T, fn func(t *testing.T, c *Camera)) {
+	for _, center := range testCenters {
+		for _, zoom := range testZooms {
+			for _, vp := range testViewports {
+				name := fmt.Sprintf("%.2f,%.2f/z%d/%dx%d", center.lat, center.lon, zoom, vp[0], vp[1])
+				t.Run(name, func(t *testing.T) {
+					fn(t, NewCamera(center.lat, center.lon, zoom, vp[0], vp[1]))
+				})
+			}
+		}
+	}
+}
+
+// screenPoints are the corners, edge midpoints and center of the viewport
+func screenPoints(c *Camera) [][2]float64 {
+	w, h := float64(c.ViewportWidth), float64(c.ViewportHeight)
+	var pts [][2]float64
+	for _, fx := range []float64{0, 0.5, 1} {
+		for _, fy := range []float64{0, 0.5, 1} {
+			pts = append(pts, [2]float64{fx * w, fy * h})
+		}
+	}
+	return pts
+}
+
+func TestScreenGeoScreenRoundTrip(t *testing.T) {
+	forEachView(t, func(t *testing.T, c *Camera) {
+		for _, p := range screenPoints(c) {
+			lon, lat := c.ScreenToGeo(p[0], p[1])
+			x, y := c.GeoToScreen(lon, lat)
+			if d := math.Hypot(x-p[0], y-p[1]); d >= pixelTolerance {
+				t.Errorf("(%.1f, %.1f) -> (%.6f, %.6f) -> (%.3f, %.3f): off by %.3fpx",
+					p[0], p[1], lon, lat, x, y, d)
+			}
+		}
+	})
+}
+
+func TestGeoScreenGeoRoundTrip(t *testing.T) {
+	forEachView(t, func(t *testing.T, c *Camera) {
+		// Geographic points spread across the visible area
+		for _, p := range screenPoints(c) {
+			lon, lat := c.ScreenToGeo(p[0], p[1])
+			if math.Abs(lat) > tiles.MaxLatitude {
+				continue
+			}
+			x, y := c.GeoToScreen(lon, lat)
+			gotLon, gotLat := c.ScreenToGeo(x, y)
+
+			// Measure the error in world pixels so the tolerance is the same
+			// at every zoom and latitude
+			wantX, wantY := c.worldPixel(lat, lon)
+			gotX, gotY := c.worldPixel(gotLat, gotLon)
+			if d := math.Hypot(gotX-wantX, gotY-wantY); d >= pixelTolerance {
+				t.Errorf("(%.6f, %.6f) -> (%.3f, %.3f) -> (%.6f, %.6f): off by %.3fpx",
+					lon, lat, x, y, gotLon, gotLat, d)
+			}
+		}
+	})
+}
+
+func TestGeoToScreenCenter(t *testing.T) {
+	forEachView(t, func(t *testing.T, c *Camera) {
+		x, y := c.GeoToScreen(c.Lon, c.Lat)
+		wantX, wantY := float64(c.ViewportWidth)/2, float64(c.ViewportHeight)/2
+		if math.Hypot(x-wantX, y-wantY) >= pixelTolerance {
+			t.Errorf("camera center at (%.3f, %.3f), want (%.1f, %.1f)", x, y, wantX, wantY)
+		}
+	})
+}
+
+// The geographic point under the cursor must stay under it when zooming
+func TestZoomAtPointKeepsCursorFixed(t *testing.T) {
+	forEachView(t, func(t *testing.T, c *Camera) {
+		cursors := [][2]float64{
+			{float64(c.ViewportWidth) / 4, float64(c.ViewportHeight) / 3},
+			{float64(c.ViewportWidth) * 0.9, float64(c.ViewportHeight) * 0.8},
+		}
+		for _, delta := range []int{1, -1, 3} {
+			for _, cur := range cursors {
+				cam := *c
+				lon, lat := cam.ScreenToGeo(cur[0], cur[1])
+				if math.Abs(lat) > tiles.MaxLatitude {
+					continue
+				}
+				startZoom := cam.Zoom
+				cam.ZoomAtPoint(delta, cur[0], cur[1])
+				if cam.Zoom == startZoom {
+					continue
+				}
+
+				// Near the antimeridian the camera longitude wraps, so the
+				// point may land on the neighbouring copy of the world
+				x, y := cam.GeoToScreen(lon, lat)
+				world := math.Pow(2, float64(cam.Zoom)) * float64(tiles.TileSize())
+				dx := math.Remainder(x-cur[0], world)
+				if d := math.Hypot(dx, y-cur[1]); d >= pixelTolerance {
+					t.Errorf("zoom %d -> %d at (%.1f, %.1f): point moved to (%.3f, %.3f), %.3fpx",
+						startZoom, cam.Zoom, cur[0], cur[1], x, y, d)
+				}
+			}
+		}
+	})
+}
+
+func TestZoomAtPointClampsZoom(t *testing.T) {
+	tests := []struct {
+		start, delta, want int
+	}{
+		{MaxZoom, 1, MaxZoom},
+		{MinZoom, -1, MinZoom},
+		{MaxZoom - 1, 5, MaxZoom},
+		{MinZoom + 1, -5, MinZoom},
+		{10, 2, 12},
+	}
+	for _, tt := range tests {
+		c := NewCamera(52.37, 4.9, tt.start, 800, 600)
+		c.ZoomAtPoint(tt.delta, 100, 100)
+		if c.Zoom != tt.want {
+			t.Errorf("zoom %d%+d: got %d, want %d", tt.start, tt.delta, c.Zoom, tt.want)
+		}
+	}
+}
+
+// processInput passes these deltas to Pan for the pan keys (see
+// app.processInput). A fixed geographic point must move on screen by exactly
+// the delta, so W slides it down (+y) and A slides it right (+x), the same
+// as dragging the map.
+func TestKeyboardPanDirection(t *testing.T) {
+	const step = 40.0
+	tests := []struct {
+		key    string
+		dx, dy float64
+	}{
+		{"W", 0, step},
+		{"S", 0, -step},
+		{"A", step, 0},
+		{"D", -step, 0},
+	}
+	for _, tt := range tests {
+		for _, center := range testCenters {
+			c := NewCamera(center.lat, center.lon, 10, 800, 600)
+			lon, lat := c.ScreenToGeo(400, 300)
+
+			c.Pan(tt.dx, tt.dy)
+			x, y := c.GeoToScreen(lon, lat)
+			if math.Abs(x-400-tt.dx) >= pixelTolerance || math.Abs(y-300-tt.dy) >= pixelTolerance {
+				t.Errorf("%s at %.2f,%.2f: point moved (%+.3f, %+.3f), want (%+.0f, %+.0f)",
+					tt.key, center.lat, center.lon, x-400, y-300, tt.dx, tt.dy)
+			}
+		}
+	}
+}
+
+// Pressing W and dragging the map down must agree
+func TestDragMatchesKeyboardPan(t *testing.T) {
+	keys := NewCamera(52.37, 4.9, 12, 800, 600)
+	keys.Pan(0, 50)
+
+	drag := NewCamera(52.37, 4.9, 12, 800, 600)
+	drag.StartDrag(400, 300)
+	drag.Drag(400, 350)
+	drag.EndDrag()
+
+	if keys.Lat <= 52.37 {
+		t.Errorf("W moved the camera to lat %.6f, want north of 52.37", keys.Lat)
+	}
+	if math.Abs(keys.Lat-drag.Lat) > 1e-9 || math.Abs(keys.Lon-drag.Lon) > 1e-9 {
+		t.Errorf("W pan ended at %.6f,%.6f, drag at %.6f,%.6f", keys.Lat, keys.Lon, drag.Lat, drag.Lon)
+	}
+}
+
+func TestFitBounds(t *testing.T) {
+	type box struct{ minLat, minLon, maxLat, maxLon float64 }
+	boxes := []struct {
+		name string
+		box  box
+	}{
+		{"netherlands", box{50.75, 3.36, 53.55, 7.23}},
+		{"manhattan", box{40.70, -74.02, 40.88, -73.91}},
+		{"chile, tall and thin", box{-55.9, -75.6, -17.5, -66.4}},
+		{"across the antimeridian", box{-47.3, 166.4, -34.4, -178.5}},
+	}
+	viewports := [][2]int{{800, 600}, {1920, 1080}, {400, 1200}, {2560, 400}}
+	const padding = 20
+
+	for _, b := range boxes {
+		for _, vp := range viewports {
+			t.Run(fmt.Sprintf("%s/%dx%d", b.name, vp[0], vp[1]), func(t *testing.T) {
+				c := NewCamera(0, 0, 5, vp[0], vp[1])
+				c.FitBounds(b.box.minLat, b.box.minLon, b.box.maxLat, b.box.maxLon, padding)
+
+				// Corners land inside the padded viewport; the east edge may be
+				// a world copy away
+				maxLon := b.box.maxLon
+				if maxLon < b.box.minLon {
+					maxLon += 360
+				}
+				fits := func(cam *Camera) bool {
+					x0, y0 := cam.GeoToScreen(b.box.minLon, b.box.maxLat)
+					x1, y1 := cam.GeoToScreen(maxLon, b.box.minLat)
+					return x0 >= padding-pixelTolerance && y0 >= padding-pixelTolerance &&
+						x1 <= float64(vp[0]-padding)+pixelTolerance && y1 <= float64(vp[1]-padding)+pixelTolerance
+				}
+				if !fits(c) {
+					t.Errorf("box does not fit at zoom %d", c.Zoom)
+				}
+
+				// Box centered in the viewport
+				x0, y0 := c.GeoToScreen(b.box.minLon, b.box.maxLat)
+				x1, y1 := c.GeoToScreen(maxLon, b.box.minLat)
+				if math.Abs((x0+x1)/2-float64(vp[0])/2) >= pixelTolerance || math.Abs((y0+y1)/2-float64(vp[1])/2) >= pixelTolerance {
+					t.Errorf("box center at (%.1f, %.1f), want viewport center", (x0+x1)/2, (y0+y1)/2)
+				}
+
+				// And it is the closest zoom that fits
+				if c.Zoom < MaxZoom {
+					closer := *c
+					closer.Zoom++
+					if fits(&closer) {
+						t.Errorf("zoom %d chosen but %d also fits", c.Zoom, closer.Zoom)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestFitBoundsLimits(t *testing.T) {
+	tests := []struct {
+		name                           string
+		minLat, minLon, maxLat, maxLon float64
+		want                           int
+	}{
+		{"single point", 52.37, 4.9, 52.37, 4.9, MaxZoom},
+		{"whole world", -90, -180, 90, 180, MinZoom},
+	}
+	for _, tt := range tests {
+		c := NewCamera(0, 0, 10, 800, 600)
+		c.FitBounds(tt.minLat, tt.minLon, tt.maxLat, tt.maxLon, 0)
+		if c.Zoom != tt.want {
+			t.Errorf("%s: zoom %d, want %d", tt.name, c.Zoom, tt.want)
+		}
+		if c.Zoom < MinZoom || c.Zoom > MaxZoom || math.Abs(c.Lat) > tiles.MaxLatitude {
+			t.Errorf("%s: camera out of range at %.4f,%.4f z%d", tt.name, c.Lat, c.Lon, c.Zoom)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package camera
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"mapviewer/pkg/tiles"
+)
+
+// CameraState is the part of a camera worth saving: where it looks. Zoom is
+// on the standard 256px scale (see DisplayZoom) so permalinks work whatever
+// tile size is configured.
+type CameraState struct {
+	Lat  float64 `json:"lat"`
+	Lon  float64 `json:"lon"`
+	Zoom int     `json:"zoom"`
+}
+
+// State returns the camera's current position
+func (c *Camera) State() CameraState {
+	return CameraState{Lat: c.Lat, Lon: c.Lon, Zoom: c.DisplayZoom()}
+}
+
+// Restore moves the camera to a saved position, clamping the zoom and
+// keeping it within any bounds
+func (c *Camera) Restore(s CameraState) {
+	c.Lat, c.Lon = s.Lat, s.Lon
+	c.TargetLat, c.TargetLon = s.Lat, s.Lon
+	c.OffsetX, c.OffsetY = 0, 0
+	c.ZoomTo(s.Zoom - tiles.ZoomOffset())
+}
+
+// EncodeHash formats the state as a "zoom/lat/lon" permalink, like the
+// #map= fragment on openstreetmap.org. Five decimals is about a meter.
+func (s CameraState) EncodeHash() string {
+	return fmt.Sprintf("%d/%.5f/%.5f", s.Zoom, s.Lat, s.Lon)
+}
+
+// DecodeHash parses a permalink made by EncodeHash. A leading "#" or
+// "#map=" is ignored.
+func DecodeHash(hash string) (CameraState, error) {
+	hash = strings.TrimPrefix(strings.TrimPrefix(hash, "#"), "map=")
+	parts := strings.Split(hash, "/")
+	if len(parts) != 3 {
+		return CameraState{}, fmt.Errorf("invalid permalink %q: want zoom/lat/lon", hash)
+	}
+
+	zoom, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return CameraState{}, fmt.Errorf("invalid permalink zoom %q", parts[0])
+	}
+	lat, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return CameraState{}, fmt.Errorf("invalid permalink latitude %q", parts[1])
+	}
+	lon, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return CameraState{}, fmt.Errorf("invalid permalink longitude %q", parts[2])
+	}
+	return CameraState{Lat: lat, Lon: lon, Zoom: zoom}, nil
+}
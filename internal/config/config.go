@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	"fmt"
 	"os"
 	"sync"
 )
@@ -13,6 +14,29 @@ type Config struct {
 
 	// Rendering parameters
 	Rendering Rendering `json:"rendering"`
+
+	// Tile source parameters
+	Tiles Tiles `json:"tiles"`
+
+	// Mouse and keyboard parameters
+	Input Input `json:"input"`
+
+	// Tile cache and loader parameters
+	Cache Cache `json:"cache"`
+
+	// LogLevel drops log messages below it: debug, info, warn, error or off
+	LogLevel string `json:"log_level"`
+
+	// Bounds optionally restricts panning to a region (nil = whole world)
+	Bounds *Bounds `json:"bounds,omitempty"`
+}
+
+// Bounds is a geographic bounding box the camera is locked to
+type Bounds struct {
+	MinLat float64 `json:"min_lat"`
+	MinLon float64 `json:"min_lon"`
+	MaxLat float64 `json:"max_lat"`
+	MaxLon float64 `json:"max_lon"`
 }
 
 // Features contains feature flags for development
@@ -28,6 +52,20 @@ type Features struct {
 
 	// EnableVectorOverlay enables rendering vector data on top of raster tiles
 	EnableVectorOverlay bool `json:"enable_vector_overlay"`
+
+	// EnableLabels draws place names from vector tiles over the map
+	EnableLabels bool `json:"enable_labels"`
+
+	// EnableWaterFill draws vector tile water bodies over the map in the
+	// theme's sea color, so water stays visible through the city mask fog
+	EnableWaterFill bool `json:"enable_water_fill"`
+
+	// NightMode darkens and blue-tints tiles in the shader for low light
+	NightMode bool `json:"night_mode"`
+
+	// ShowTileGrid outlines each tile and labels it with its z/x/y, for
+	// debugging tile placement
+	ShowTileGrid bool `json:"show_tile_grid"`
 }
 
 // Rendering contains rendering parameters
@@ -42,6 +80,110 @@ type Rendering struct {
 
 	// RoadWeightDecay controls how quickly road influence decays with distance
 	RoadWeightDecay float64 `json:"road_weight_decay"`
+
+	// MaxTextures bounds how many tile textures stay on the GPU (0 = default)
+	MaxTextures int `json:"max_textures"`
+
+	// MSAASamples is the multisample count for anti-aliasing (1 = off, 4 = 4x)
+	MSAASamples int `json:"msaa_samples"`
+
+	// Backend selects the WebGPU backend: primary, metal, vulkan, dx12, dx11
+	// or gl. Empty = platform default. MAPVIEWER_BACKEND overrides it.
+	Backend string `json:"backend,omitempty"`
+
+	// Saturation scales map colors (0 = grayscale, 1 = full color)
+	Saturation float64 `json:"saturation"`
+
+	// Theme selects a color palette by name (built-in or from Themes)
+	Theme string `json:"theme"`
+
+	// Themes defines custom palettes in addition to the built-in ones
+	Themes map[string]Theme `json:"themes,omitempty"`
+
+	// MaxFPS caps the frame rate (0 = as fast as the display allows)
+	MaxFPS int `json:"max_fps"`
+
+	// RenderOnChange skips frames while the camera is still and nothing new
+	// arrived, saving CPU and battery on a static map
+	RenderOnChange bool `json:"render_on_change"`
+}
+
+// Tiles contains tile source parameters
+type Tiles struct {
+	// URLTemplate is the raster tile URL with {z}/{x}/{y} placeholders
+	// Empty = built-in Carto basemap
+	URLTemplate string `json:"url_template,omitempty"`
+
+	// Subdomains rotated through for a {s} placeholder in URLTemplate
+	// Empty = a, b, c
+	Subdomains []string `json:"subdomains,omitempty"`
+
+	// MBTiles serves raster tiles from a local .mbtiles file instead of
+	// URLTemplate. Empty = download tiles.
+	MBTiles string `json:"mbtiles,omitempty"`
+
+	// TileSize is the raster tile size in pixels (256 or 512)
+	TileSize int `json:"tile_size"`
+
+	// Mirrors are alternative URL templates to fail over between
+	// Empty = URLTemplate only
+	Mirrors []string `json:"mirrors,omitempty"`
+
+	// VectorURLTemplate is the MVT source with {z}/{x}/{y} placeholders
+	// Empty = built-in OpenFreeMap planet build
+	VectorURLTemplate string `json:"vector_url_template,omitempty"`
+
+	// MaxCacheMB limits the raster disk cache size (0 = unlimited)
+	MaxCacheMB int64 `json:"max_cache_mb"`
+
+	// TileTTLHours is how long cached raster tiles stay fresh (0 = forever)
+	TileTTLHours float64 `json:"tile_ttl_hours"`
+
+	// FetchMaxAttempts is the number of tries per tile download (min 1)
+	FetchMaxAttempts int `json:"fetch_max_attempts"`
+
+	// FetchRetryBaseMs is the initial retry delay; it doubles each attempt
+	FetchRetryBaseMs int `json:"fetch_retry_base_ms"`
+
+	// MaxConcurrentDownloads caps simultaneous requests to the tile server
+	MaxConcurrentDownloads int `json:"max_concurrent_downloads"`
+
+	// FetchTimeoutMs bounds each download attempt; a slow tile is retried
+	// (0 = only the 30s client timeout)
+	FetchTimeoutMs int `json:"fetch_timeout_ms"`
+}
+
+// Input contains mouse and keyboard parameters
+type Input struct {
+	// ScrollZoomThreshold is how much scroll must accumulate before zooming
+	// one level (1 = every wheel notch). Raise it for trackpads.
+	ScrollZoomThreshold float64 `json:"scroll_zoom_threshold"`
+}
+
+// Cache contains tile cache and loader parameters
+type Cache struct {
+	// Dir is the raster tile cache directory
+	Dir string `json:"dir"`
+
+	// Workers is the number of background prefetch workers in the tile cache
+	Workers int `json:"workers"`
+
+	// TileLoaders is the number of goroutines loading tiles for the view
+	TileLoaders int `json:"tile_loaders"`
+
+	// RequestQueueSize bounds pending tile requests from the view
+	RequestQueueSize int `json:"request_queue_size"`
+}
+
+// Validate checks that the cache parameters are usable
+func (c Cache) Validate() error {
+	if c.Dir == "" {
+		return fmt.Errorf("cache dir must not be empty")
+	}
+	if c.Workers <= 0 || c.TileLoaders <= 0 || c.RequestQueueSize <= 0 {
+		return fmt.Errorf("cache workers, tile_loaders and request_queue_size must be positive")
+	}
+	return nil
 }
 
 var (
@@ -56,18 +198,43 @@ func DefaultConfig() *Config {
 		Features: Features{
 			ShowDevUI:           true,  // On by default for development
 			EnableCityMask:      true,  // On by default for development
-			EnableRoadWeights:   false, // Off until implemented
+			EnableRoadWeights:   false, // Off by default
 			EnableVectorOverlay: true,  // On by default
+			EnableLabels:        true,
 		},
 		Rendering: Rendering{
 			CityRadiusPercent:   100.0, // Full size by default
 			RoadWeightInfluence: 0.3,
 			RoadWeightDecay:     0.5,
+			MaxTextures:         512,
+			MSAASamples:         4,
+			Theme:               DefaultTheme,
+			Saturation:          1.0,
+		},
+		Tiles: Tiles{
+			TileSize:               256,
+			MaxCacheMB:             1024,
+			TileTTLHours:           24 * 7,
+			FetchMaxAttempts:       3,
+			FetchRetryBaseMs:       500,
+			MaxConcurrentDownloads: 6,
+			FetchTimeoutMs:         10000,
 		},
+		Input: Input{
+			ScrollZoomThreshold: 1.0,
+		},
+		Cache: Cache{
+			Dir:              ".tile_cache",
+			Workers:          8,
+			TileLoaders:      4,
+			RequestQueueSize: 500,
+		},
+		LogLevel: "info",
 	}
 }
 
-// Get returns the global configuration instance
+// Get returns the global configuration instance: defaults, overridden by
+// config.json, overridden by MAPVIEWER_* environment variables
 func Get() *Config {
 	once.Do(func() {
 		instance = DefaultConfig()
@@ -75,10 +242,25 @@ func Get() *Config {
 		if data, err := os.ReadFile("config.json"); err == nil {
 			json.Unmarshal(data, instance)
 		}
+		applyEnvOverrides(instance)
 	})
+
+	// Watch may swap in a reloaded instance at any time
+	mu.RLock()
+	defer mu.RUnlock()
 	return instance
 }
 
+// Snapshot returns a copy of the configuration taken under the lock, so
+// per-frame readers never race the setters below. Slices and maps (Themes,
+// Mirrors, Subdomains) are shared and must be treated as read-only.
+func Snapshot() Config {
+	Get() // Load on first use
+	mu.RLock()
+	defer mu.RUnlock()
+	return *instance
+}
+
 // Load loads configuration from a file
 func Load(path string) error {
 	data, err := os.ReadFile(path)
@@ -93,7 +275,11 @@ func Load(path string) error {
 		instance = DefaultConfig()
 	}
 
-	return json.Unmarshal(data, instance)
+	if err := json.Unmarshal(data, instance); err != nil {
+		return err
+	}
+	applyEnvOverrides(instance)
+	return nil
 }
 
 // Save saves configuration to a file
@@ -161,3 +347,16 @@ func AdjustCityRadius(delta float64) float64 {
 
 	return instance.Rendering.CityRadiusPercent
 }
+
+// ToggleNightMode flips night mode and returns the new state
+func ToggleNightMode() bool {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if instance == nil {
+		instance = DefaultConfig()
+	}
+
+	instance.Features.NightMode = !instance.Features.NightMode
+	return instance.Features.NightMode
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"mapviewer/internal/logging"
+)
+
+// envOverride maps one environment variable onto a config field
+type envOverride struct {
+	name  string
+	apply func(cfg *Config, value string) error
+}
+
+// envOverrides are applied after config.json, so precedence is
+// defaults < config.json < environment
+var envOverrides = []envOverride{
+	{"MAPVIEWER_CITY_RADIUS", func(c *Config, v string) error {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 || f > 100 {
+			return fmt.Errorf("want a number from 0 to 100")
+		}
+		c.Rendering.CityRadiusPercent = f
+		return nil
+	}},
+	{"MAPVIEWER_ENABLE_CITY_MASK", envBool(func(c *Config) *bool { return &c.Features.EnableCityMask })},
+	{"MAPVIEWER_ENABLE_ROAD_WEIGHTS", envBool(func(c *Config) *bool { return &c.Features.EnableRoadWeights })},
+	{"MAPVIEWER_ENABLE_VECTOR_OVERLAY", envBool(func(c *Config) *bool { return &c.Features.EnableVectorOverlay })},
+	{"MAPVIEWER_ENABLE_LABELS", envBool(func(c *Config) *bool { return &c.Features.EnableLabels })},
+	{"MAPVIEWER_ENABLE_WATER_FILL", envBool(func(c *Config) *bool { return &c.Features.EnableWaterFill })},
+	{"MAPVIEWER_NIGHT_MODE", envBool(func(c *Config) *bool { return &c.Features.NightMode })},
+	{"MAPVIEWER_SHOW_TILE_GRID", envBool(func(c *Config) *bool { return &c.Features.ShowTileGrid })},
+	{"MAPVIEWER_THEME", func(c *Config, v string) error {
+		c.Rendering.Theme = v
+		return nil
+	}},
+	{"MAPVIEWER_MSAA_SAMPLES", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return fmt.Errorf("want a positive integer")
+		}
+		c.Rendering.MSAASamples = n
+		return nil
+	}},
+	{"MAPVIEWER_MAX_FPS", func(c *Config, v string) error {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return fmt.Errorf("want a non-negative integer")
+		}
+		c.Rendering.MaxFPS = n
+		return nil
+	}},
+	{"MAPVIEWER_RENDER_ON_CHANGE", envBool(func(c *Config) *bool { return &c.Rendering.RenderOnChange })},
+	{"MAPVIEWER_TILE_URL", func(c *Config, v string) error {
+		c.Tiles.URLTemplate = v
+		return nil
+	}},
+	{"MAPVIEWER_VECTOR_URL", func(c *Config, v string) error {
+		c.Tiles.VectorURLTemplate = v
+		return nil
+	}},
+	{"MAPVIEWER_CACHE_DIR", func(c *Config, v string) error {
+		c.Cache.Dir = v
+		return nil
+	}},
+	{"MAPVIEWER_LOG_LEVEL", func(c *Config, v string) error {
+		c.LogLevel = v
+		return nil
+	}},
+}
+
+// envBool returns an override that parses a boolean into a field
+func envBool(field func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("want true or false")
+		}
+		*field(c) = b
+		return nil
+	}
+}
+
+// applyEnvOverrides sets config fields from MAPVIEWER_* environment
+// variables. Invalid values are reported and ignored.
+func applyEnvOverrides(cfg *Config) {
+	for _, o := range envOverrides {
+		v, ok := os.LookupEnv(o.name)
+		if !ok || v == "" {
+			continue
+		}
+		if err := o.apply(cfg, v); err != nil {
+			logging.Warnf("ignoring %s=%q: %v", o.name, v, err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package config
+
+// Color is an RGB color with components in 0-1
+type Color [3]float64
+
+// Theme is the map's color palette
+type Theme struct {
+	// Sea fills the background and not-yet-loaded tiles
+	Sea Color `json:"sea"`
+
+	// Fog covers areas outside the city mask
+	Fog Color `json:"fog"`
+
+	// LandTint multiplies tile colors (1, 1, 1 = unchanged)
+	LandTint Color `json:"land_tint"`
+}
+
+// DefaultTheme is the theme used when none is configured
+const DefaultTheme = "light"
+
+// BuiltinThemes are the themes selectable by name without defining them
+var BuiltinThemes = map[string]Theme{
+	"light": {
+		Sea:      Color{0.627, 0.765, 0.812},
+		Fog:      Color{0.75, 0.8, 0.85},
+		LandTint: Color{1, 1, 1},
+	},
+	"dark": {
+		Sea:      Color{0.09, 0.12, 0.17},
+		Fog:      Color{0.14, 0.15, 0.18},
+		LandTint: Color{0.42, 0.45, 0.52},
+	},
+	"sepia": {
+		Sea:      Color{0.76, 0.70, 0.58},
+		Fog:      Color{0.85, 0.80, 0.70},
+		LandTint: Color{1.0, 0.92, 0.78},
+	},
+}
+
+// ActiveTheme returns the configured theme. Custom themes in Themes take
+// precedence over built-in ones of the same name; unknown names fall back
+// to DefaultTheme.
+func (r Rendering) ActiveTheme() Theme {
+	name := r.Theme
+	if name == "" {
+		name = DefaultTheme
+	}
+	if t, ok := r.Themes[name]; ok {
+		return t
+	}
+	if t, ok := BuiltinThemes[name]; ok {
+		return t
+	}
+	return BuiltinThemes[DefaultTheme]
+}
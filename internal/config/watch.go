@@ -0,0 +1,115 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"mapviewer/internal/logging"
+)
+
+// WatchInterval is how often Watch checks the config file for changes
+const WatchInterval = time.Second
+
+// Watch polls the config file and, whenever its modification time or size
+// changes, reloads it and swaps it in as the global instance. onChange (may
+// be nil) is called with the new config. A file that fails to parse is
+// reported and the current config kept. Call the returned function to stop
+// watching.
+//
+// Settings read while running take effect immediately: the feature flags,
+// the city radius, road weights, saturation, theme, max FPS and
+// render-on-change, the input settings and (through onChange) the log level.
+// The tile source, cache, MSAA, backend, texture limit and bounds are only
+// read at startup and need a restart.
+//
+// The city radius and night mode can also be changed at runtime (see
+// SetCityRadius, AdjustCityRadius and ToggleNightMode). A reload keeps their
+// runtime values unless the file's own value for them was edited.
+func Watch(path string, onChange func(*Config)) (stop func()) {
+	done := make(chan struct{})
+	lastMod, lastSize := fileVersion(path)
+
+	// The file as last read, to tell edits apart from runtime changes
+	lastFile, err := readFile(path)
+	if err != nil {
+		current := Snapshot()
+		lastFile = &current
+	}
+
+	go func() {
+		ticker := time.NewTicker(WatchInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			mod, size := fileVersion(path)
+			if mod.Equal(lastMod) && size == lastSize {
+				continue
+			}
+			lastMod, lastSize = mod, size
+
+			cfg, err := readFile(path)
+			if err != nil {
+				logging.Warnf("config reload failed: %v", err)
+				continue
+			}
+
+			file := *cfg
+			Get() // Make sure the initial load doesn't overwrite the swap
+			mu.Lock()
+			keepRuntimeSettings(cfg, lastFile, instance)
+			instance = cfg
+			mu.Unlock()
+			lastFile = &file
+
+			if onChange != nil {
+				onChange(cfg)
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// keepRuntimeSettings copies the settings that can change at runtime from
+// current into next, a freshly reloaded config, unless the file changed them
+// since prevFile was read
+func keepRuntimeSettings(next, prevFile, current *Config) {
+	if next.Rendering.CityRadiusPercent == prevFile.Rendering.CityRadiusPercent {
+		next.Rendering.CityRadiusPercent = current.Rendering.CityRadiusPercent
+	}
+	if next.Features.NightMode == prevFile.Features.NightMode {
+		next.Features.NightMode = current.Features.NightMode
+	}
+}
+
+// fileVersion returns the modification time and size of a file, or zero
+// values if it cannot be read
+func fileVersion(path string) (time.Time, int64) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return info.ModTime(), info.Size()
+}
+
+// readFile parses a config file on top of the defaults and applies the
+// environment overrides
+func readFile(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cfg := DefaultConfig()
+	if err := json.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	applyEnvOverrides(cfg)
+	return cfg, nil
+}
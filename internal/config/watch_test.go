@@ -0,0 +1,137 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeepRuntimeSettings(t *testing.T) {
+	type settings struct {
+		radius float64
+		night  bool
+	}
+	tests := []struct {
+		name                    string
+		prevFile, current, next settings
+		want                    settings
+	}{
+		{"no runtime changes", settings{50, false}, settings{50, false}, settings{50, false}, settings{50, false}},
+		{"runtime changes kept", settings{50, false}, settings{80, true}, settings{50, false}, settings{80, true}},
+		{"file edit wins", settings{50, false}, settings{80, true}, settings{20, true}, settings{20, true}},
+		{"only radius edited", settings{50, false}, settings{80, true}, settings{20, false}, settings{20, true}},
+		{"only night mode edited", settings{50, true}, settings{80, false}, settings{50, false}, settings{80, false}},
+	}
+	for _, tt := range tests {
+		cfg := func(s settings) *Config {
+			c := DefaultConfig()
+			c.Rendering.CityRadiusPercent = s.radius
+			c.Features.NightMode = s.night
+			return c
+		}
+		next := cfg(tt.next)
+		keepRuntimeSettings(next, cfg(tt.prevFile), cfg(tt.current))
+		got := settings{next.Rendering.CityRadiusPercent, next.Features.NightMode}
+		if got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// writeConfig writes a config file and bumps its modification time so
+// Watch notices even within the file system's timestamp resolution
+func writeConfig(t *testing.T, path, content string, mod time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, mod, mod); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchKeepsRuntimeChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	start := time.Now().Add(-time.Hour)
+	writeConfig(t, path, `{"rendering": {"city_radius_percent": 40, "saturation": 1}}`, start)
+
+	Get()
+	prev := Snapshot()
+	t.Cleanup(func() {
+		mu.Lock()
+		*instance = prev
+		mu.Unlock()
+	})
+	if err := Load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := make(chan *Config, 4)
+	stop := Watch(path, func(cfg *Config) { reloaded <- cfg })
+	defer stop()
+	wait := func() {
+		t.Helper()
+		select {
+		case <-reloaded:
+		case <-time.After(5 * WatchInterval):
+			t.Fatal("config was not reloaded")
+		}
+	}
+
+	// Hotkeys change the radius and night mode, then an unrelated edit
+	SetCityRadius(75)
+	ToggleNightMode()
+	writeConfig(t, path, `{"rendering": {"city_radius_percent": 40, "saturation": 0.5}}`, start.Add(time.Minute))
+	wait()
+
+	cfg := Snapshot()
+	if cfg.Rendering.Saturation != 0.5 {
+		t.Errorf("saturation %v, want the edited 0.5", cfg.Rendering.Saturation)
+	}
+	if cfg.Rendering.CityRadiusPercent != 75 || !cfg.Features.NightMode {
+		t.Errorf("radius %v, night mode %v; want the runtime 75, true",
+			cfg.Rendering.CityRadiusPercent, cfg.Features.NightMode)
+	}
+
+	// Editing the radius itself overrides the runtime value
+	writeConfig(t, path, `{"rendering": {"city_radius_percent": 20, "saturation": 0.5}}`, start.Add(2*time.Minute))
+	wait()
+
+	cfg = Snapshot()
+	if cfg.Rendering.CityRadiusPercent != 20 || !cfg.Features.NightMode {
+		t.Errorf("radius %v, night mode %v; want the edited 20 and the runtime true",
+			cfg.Rendering.CityRadiusPercent, cfg.Features.NightMode)
+	}
+}
+
+func TestWatchKeepsConfigOnParseError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.json")
+	start := time.Now().Add(-time.Hour)
+	writeConfig(t, path, `{"rendering": {"saturation": 0.7}}`, start)
+
+	Get()
+	prev := Snapshot()
+	t.Cleanup(func() {
+		mu.Lock()
+		*instance = prev
+		mu.Unlock()
+	})
+	if err := Load(path); err != nil {
+		t.Fatal(err)
+	}
+
+	reloaded := make(chan *Config, 1)
+	stop := Watch(path, func(cfg *Config) { reloaded <- cfg })
+	defer stop()
+
+	writeConfig(t, path, `{"rendering": {`, start.Add(time.Minute))
+	select {
+	case <-reloaded:
+		t.Fatal("a broken file was swapped in")
+	case <-time.After(3 * WatchInterval):
+	}
+	if got := Snapshot().Rendering.Saturation; got != 0.7 {
+		t.Errorf("saturation %v after a failed reload, want 0.7", got)
+	}
+}
@@ -0,0 +1,205 @@
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// RetryPolicy controls how failed HTTP requests are retried
+type RetryPolicy struct {
+	// MaxAttempts is the total number of tries, including the first (min 1)
+	MaxAttempts int
+
+	// BaseDelay is the wait before the first retry; it doubles every attempt
+	BaseDelay time.Duration
+
+	// MaxDelay caps the backoff. A Retry-After longer than this is not waited out.
+	MaxDelay time.Duration
+
+	// Jitter randomizes each delay by up to this fraction (0-1)
+	Jitter float64
+
+	// AttemptTimeout bounds each try, including reading the body, so a
+	// stalled request is retried instead of waiting out the client timeout
+	// (0 = no per-attempt limit)
+	AttemptTimeout time.Duration
+}
+
+// DefaultRetryPolicy returns a polite policy suitable for public tile servers
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    3,
+		BaseDelay:      500 * time.Millisecond,
+		MaxDelay:       10 * time.Second,
+		Jitter:         0.2,
+		AttemptTimeout: 10 * time.Second,
+	}
+}
+
+// Do sends req, retrying network errors, 408, 429 and 5xx responses with
+// exponential backoff. Other responses (including 404) are returned as-is.
+// Waiting between attempts is aborted when the request's context is done.
+func Do(client *http.Client, req *http.Request, policy RetryPolicy) (*http.Response, error) {
+	return DoLimited(client, req, policy, nil)
+}
+
+// DoLimited is Do with every attempt taking a slot in slots, so callers
+// sharing it have at most cap(slots) requests in flight. A slot is held
+// until the attempt's response body is closed, but not while waiting to
+// retry. A nil slots means no limit.
+func DoLimited(client *http.Client, req *http.Request, policy RetryPolicy, slots chan struct{}) (*http.Response, error) {
+	attempts := policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	ctx := req.Context()
+
+	for attempt := 1; ; attempt++ {
+		if slots != nil {
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		release := func() {
+			if slots != nil {
+				<-slots
+			}
+		}
+
+		resp, err := policy.try(client, req)
+		if ctx.Err() != nil {
+			if resp != nil {
+				resp.Body.Close()
+			}
+			release()
+			return nil, ctx.Err()
+		}
+		if attempt >= attempts || (err == nil && !retryableStatus(resp.StatusCode)) {
+			return holdSlot(resp, err, release)
+		}
+
+		delay := policy.backoff(attempt)
+		if err == nil {
+			if retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+				if policy.MaxDelay > 0 && retryAfter > policy.MaxDelay {
+					// Server wants us gone for longer than we're willing to wait
+					return holdSlot(resp, nil, release)
+				}
+				if retryAfter > delay {
+					delay = retryAfter
+				}
+			}
+			// Drain so the connection can be reused
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		release()
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("retry aborted: %w", ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+// try sends one attempt under AttemptTimeout. The timeout keeps running
+// until the returned body is closed.
+func (p RetryPolicy) try(client *http.Client, req *http.Request) (*http.Response, error) {
+	if p.AttemptTimeout <= 0 {
+		return client.Do(req.Clone(req.Context()))
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), p.AttemptTimeout)
+	resp, err := client.Do(req.Clone(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases an attempt's context when its body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// holdSlot keeps an attempt's slot until resp's body is closed, or frees it
+// now if there is no response
+func holdSlot(resp *http.Response, err error, release func()) (*http.Response, error) {
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releaseBody frees a download slot when the body is closed
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+	once    sync.Once
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(b.release)
+	return err
+}
+
+// backoff returns the jittered delay before the given retry (1-based)
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.BaseDelay) * math.Pow(2, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(delay)
+}
+
+// retryableStatus reports whether a response status is worth retrying
+func retryableStatus(code int) bool {
+	return code == http.StatusRequestTimeout ||
+		code == http.StatusTooManyRequests ||
+		code >= 500
+}
+
+// parseRetryAfter parses a Retry-After header in seconds or HTTP-date form
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		d := time.Until(t)
+		if d < 0 {
+			d = 0
+		}
+		return d, true
+	}
+	return 0, false
+}
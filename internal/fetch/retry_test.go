@@ -0,0 +1,263 @@
+package fetch
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fastPolicy retries quickly so tests don't wait on backoff
+var fastPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Second}
+
+// sequenceServer answers the nth request with statuses[n] (the last status
+// repeats) and counts requests
+func sequenceServer(t *testing.T, hits *atomic.Int32, statuses ...int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(hits.Add(1)) - 1
+		w.WriteHeader(statuses[min(n, len(statuses)-1)])
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func get(t *testing.T, ctx context.Context, url string) *http.Request {
+	t.Helper()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestDoRetries(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxAttempts  int
+		statuses     []int
+		wantStatus   int
+		wantAttempts int32
+	}{
+		{"success", 3, []int{200}, 200, 1},
+		{"5xx then success", 3, []int{503, 502, 200}, 200, 3},
+		{"429 then success", 3, []int{429, 200}, 200, 2},
+		{"408 then success", 3, []int{408, 200}, 200, 2},
+		{"gives up after max attempts", 2, []int{500}, 500, 2},
+		{"404 is not retried", 3, []int{404, 200}, 404, 1},
+		{"400 is not retried", 3, []int{400, 200}, 400, 1},
+		{"zero attempts means one", 0, []int{500, 200}, 500, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int32
+			srv := sequenceServer(t, &hits, tt.statuses...)
+			policy := fastPolicy
+			policy.MaxAttempts = tt.maxAttempts
+
+			resp, err := Do(srv.Client(), get(t, context.Background(), srv.URL), policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if hits.Load() != tt.wantAttempts {
+				t.Errorf("%d attempts, want %d", hits.Load(), tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestDoHonorsRetryAfter(t *testing.T) {
+	tests := []struct {
+		name         string
+		retryAfter   func() string // evaluated when the server answers
+		maxDelay     time.Duration
+		wantStatus   int
+		wantAttempts int32
+		minWait      time.Duration
+	}{
+		{"seconds", func() string { return "1" }, 5 * time.Second, 200, 2, time.Second},
+		{"http date", func() string {
+			// Whole seconds only, so ask for 2s to wait at least 1s
+			return time.Now().Add(2 * time.Second).UTC().Format(http.TimeFormat)
+		}, 5 * time.Second, 200, 2, time.Second},
+		{"longer than MaxDelay gives up", func() string { return "60" }, 5 * time.Second, 429, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if hits.Add(1) == 1 {
+					w.Header().Set("Retry-After", tt.retryAfter())
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			}))
+			defer srv.Close()
+			policy := fastPolicy
+			policy.MaxDelay = tt.maxDelay
+
+			start := time.Now()
+			resp, err := Do(srv.Client(), get(t, context.Background(), srv.URL), policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			elapsed := time.Since(start)
+
+			if resp.StatusCode != tt.wantStatus || hits.Load() != tt.wantAttempts {
+				t.Errorf("status %d after %d attempts, want %d after %d",
+					resp.StatusCode, hits.Load(), tt.wantStatus, tt.wantAttempts)
+			}
+			if elapsed < tt.minWait {
+				t.Errorf("retried after %v, want at least %v", elapsed, tt.minWait)
+			}
+		})
+	}
+}
+
+func TestDoAbortsBackoffOnCancel(t *testing.T) {
+	var hits atomic.Int32
+	srv := sequenceServer(t, &hits, 503)
+	policy := RetryPolicy{MaxAttempts: 5, BaseDelay: time.Hour}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := Do(srv.Client(), get(t, ctx, srv.URL), policy); err == nil {
+		t.Fatal("Do succeeded after its context was cancelled")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Do kept waiting %v after cancel", elapsed)
+	}
+	if hits.Load() != 1 {
+		t.Errorf("%d attempts, want 1", hits.Load())
+	}
+}
+
+// A stalled attempt is cut off by AttemptTimeout and retried
+func TestDoAttemptTimeout(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hits.Add(1) == 1 {
+			<-r.Context().Done()
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+	policy := fastPolicy
+	policy.AttemptTimeout = 100 * time.Millisecond
+
+	resp, err := Do(srv.Client(), get(t, context.Background(), srv.URL), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || hits.Load() != 2 {
+		t.Errorf("status %d after %d attempts, want 200 after 2", resp.StatusCode, hits.Load())
+	}
+}
+
+// Each attempt holds a slot until its body is closed; failed attempts give
+// theirs back before backing off
+func TestDoLimitedSlots(t *testing.T) {
+	slots := make(chan struct{}, 1)
+	var hits atomic.Int32
+	var held []int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		held = append(held, len(slots))
+		if hits.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer srv.Close()
+
+	req, _ := http.NewRequest("GET", srv.URL, nil)
+	resp, err := DoLimited(srv.Client(), req, fastPolicy, slots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != 1 {
+		t.Errorf("%d slots taken before the body is closed, want 1", len(slots))
+	}
+	resp.Body.Close()
+	resp.Body.Close()
+	if len(slots) != 0 {
+		t.Errorf("%d slots still taken after the body is closed", len(slots))
+	}
+	// A leaked slot from a failed attempt would have blocked the next one
+	if len(held) != 3 || held[0] != 1 || held[1] != 1 || held[2] != 1 {
+		t.Errorf("slots taken during each attempt: %v, want [1 1 1]", held)
+	}
+
+	// Errors free the slot at once
+	srv.Close()
+	if _, err := DoLimited(http.DefaultClient, req, fastPolicy, slots); err == nil {
+		t.Error("request to a closed server succeeded")
+	}
+	if len(slots) != 0 {
+		t.Errorf("%d slots taken after a failed request", len(slots))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+	for attempt, want := range []time.Duration{100, 200, 300, 300} {
+		want *= time.Millisecond
+		if got := policy.backoff(attempt + 1); got != want {
+			t.Errorf("attempt %d: %v, want %v", attempt+1, got, want)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := policy.backoff(1); got < 50*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("jittered delay %v outside [50ms, 150ms]", got)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"120", 120 * time.Second, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, true},
+	}
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseRetryAfter(%q) = %v, %v; want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+
+	// Dates in the future count down from now
+	future := time.Now().Add(30 * time.Second).UTC().Format(http.TimeFormat)
+	if got, ok := parseRetryAfter(future); !ok || got <= 28*time.Second || got > 30*time.Second {
+		t.Errorf("parseRetryAfter(%q) = %v, %v", future, got, ok)
+	}
+}
+
+func TestRetryableStatus(t *testing.T) {
+	for code, want := range map[int]bool{
+		200: false, 304: false, 400: false, 404: false,
+		408: true, 429: true, 500: true, 503: true,
+	} {
+		if got := retryableStatus(code); got != want {
+			t.Errorf("retryableStatus(%d) = %v, want %v", code, got, want)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Package headless renders map images without opening a window.
+package headless
+
+import (
+	"errors"
+	"fmt"
+	"image"
+
+	"github.com/rajveermalviya/go-webgpu/wgpu"
+
+	"mapviewer/internal/camera"
+	"mapviewer/internal/config"
+	"mapviewer/internal/logging"
+	"mapviewer/internal/renderer"
+	"mapviewer/internal/sources"
+	"mapviewer/pkg/tiles"
+)
+
+// RenderImage renders the map centered on lat/lon at the given zoom into an
+// image of the requested size, without opening a window. Visible tiles are
+// fetched (or read from the disk cache) before rendering.
+func RenderImage(lat, lon float64, zoom, width, height int) (*image.RGBA, error) {
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid image size %dx%d", width, height)
+	}
+
+	cfg := config.Get()
+	if err := logging.SetLevelName(cfg.LogLevel); err != nil {
+		logging.Warnf("%v", err)
+	}
+	backend, err := renderer.SelectBackend(cfg.Rendering.Backend)
+	if err != nil {
+		return nil, err
+	}
+
+	instance := wgpu.CreateInstance(&wgpu.InstanceDescriptor{Backends: backend})
+	if instance == nil {
+		return nil, fmt.Errorf("failed to create WebGPU instance")
+	}
+	defer instance.Release()
+
+	adapter, err := instance.RequestAdapter(&wgpu.RequestAdapterOptions{
+		PowerPreference: wgpu.PowerPreference_HighPerformance,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("adapter request failed: %w", err)
+	}
+	defer adapter.Release()
+
+	device, err := adapter.RequestDevice(&wgpu.DeviceDescriptor{
+		Label: "MapViewerHeadlessDevice",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("device request failed: %w", err)
+	}
+	defer device.Release()
+	queue := device.GetQueue()
+	defer queue.Release()
+
+	src, err := sources.Open(cfg, sources.Sources{})
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	tileCache, vectorTileCache := src.Raster, src.Vector
+
+	cam := camera.NewCamera(lat, lon, zoom, width, height)
+
+	r, err := renderer.NewRenderer(adapter, device, queue, nil, uint32(width), uint32(height), vectorTileCache, cfg.Rendering.MaxTextures, cfg.Rendering.MSAASamples)
+	if err != nil {
+		return nil, fmt.Errorf("renderer creation failed: %w", err)
+	}
+	defer r.Release()
+
+	// Load every visible tile up front; missing ones fall back to the placeholder
+	minX, minY, maxX, maxY := cam.GetTileBounds()
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			coord := tiles.TileCoord{X: tiles.WrapX(x, zoom), Y: y, Zoom: zoom}
+			if r.HasTile(coord) {
+				continue // Repeated across the antimeridian at low zoom
+			}
+			data, err := tileCache.GetTile(coord)
+			if sources.IsTileNotFound(err) {
+				continue
+			}
+			if err != nil {
+				logging.Errorf("failed to load tile %s: %v", coord.String(), err)
+				continue
+			}
+			if err := r.UploadTile(coord, data); err != nil {
+				if errors.Is(err, renderer.ErrCorruptTile) {
+					// Drop the bad cached copy so the next run downloads it
+					tileCache.Invalidate(coord)
+				}
+				logging.Errorf("failed to upload tile %s: %v", coord.String(), err)
+			}
+		}
+	}
+
+	r.UpdateCitiesForView(lat, lon, zoom)
+	r.PreloadVectorTiles(cam)
+
+	return r.Capture(cam)
+}
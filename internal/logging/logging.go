@@ -0,0 +1,111 @@
+// Package logging is a minimal leveled logger. Messages below the current
+// level are dropped, so embedding the viewer or running the tile server can
+// keep stdout quiet.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Level is a log severity
+type Level int32
+
+const (
+	LevelDebug Level = iota // Per-tile chatter
+	LevelInfo               // Startup and user-visible state changes
+	LevelWarn               // Recoverable problems
+	LevelError              // Failed operations
+	LevelOff                // Nothing
+)
+
+// levelNames maps config names to levels
+var levelNames = map[string]Level{
+	"debug": LevelDebug,
+	"info":  LevelInfo,
+	"warn":  LevelWarn,
+	"error": LevelError,
+	"off":   LevelOff,
+}
+
+var (
+	level atomic.Int32
+
+	outMu sync.Mutex
+	out   io.Writer = os.Stdout
+)
+
+func init() {
+	level.Store(int32(LevelInfo))
+}
+
+// ParseLevel returns the level for a name: debug, info, warn, error or off
+func ParseLevel(name string) (Level, error) {
+	l, ok := levelNames[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return LevelInfo, fmt.Errorf("unknown log level %q (want debug, info, warn, error or off)", name)
+	}
+	return l, nil
+}
+
+// SetLevel drops messages below l
+func SetLevel(l Level) {
+	level.Store(int32(l))
+}
+
+// SetLevelName sets the level by name (see ParseLevel). Empty = info.
+func SetLevelName(name string) error {
+	if name == "" {
+		SetLevel(LevelInfo)
+		return nil
+	}
+	l, err := ParseLevel(name)
+	if err != nil {
+		return err
+	}
+	SetLevel(l)
+	return nil
+}
+
+// SetOutput redirects log messages (default os.Stdout)
+func SetOutput(w io.Writer) {
+	outMu.Lock()
+	defer outMu.Unlock()
+	out = w
+}
+
+// Enabled reports whether messages at l are printed
+func Enabled(l Level) bool {
+	return l >= Level(level.Load())
+}
+
+// logf prints a message at l with an optional prefix
+func logf(l Level, prefix, format string, args ...any) {
+	if !Enabled(l) {
+		return
+	}
+	msg := prefix + fmt.Sprintf(format, args...)
+	if !strings.HasSuffix(msg, "\n") {
+		msg += "\n"
+	}
+
+	outMu.Lock()
+	defer outMu.Unlock()
+	io.WriteString(out, msg)
+}
+
+// Debugf logs detail that is only useful when diagnosing a problem
+func Debugf(format string, args ...any) { logf(LevelDebug, "", format, args...) }
+
+// Infof logs normal operation
+func Infof(format string, args ...any) { logf(LevelInfo, "", format, args...) }
+
+// Warnf logs a recoverable problem
+func Warnf(format string, args ...any) { logf(LevelWarn, "Warning: ", format, args...) }
+
+// Errorf logs a failed operation
+func Errorf(format string, args ...any) { logf(LevelError, "Error: ", format, args...) }
@@ -0,0 +1,159 @@
+package mbtiles
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mapviewer/internal/logging"
+	"mapviewer/pkg/tiles"
+)
+
+// cacheFormats maps tile cache file extensions to MBTiles format names
+var cacheFormats = map[string]string{
+	".png":  "png",
+	".jpg":  "jpg",
+	".webp": "webp",
+}
+
+// Export packages the tiles of a tile cache directory (files named
+// z_x_y.png/.jpg/.webp) into a new MBTiles file at outPath and returns how
+// many tiles were written. Tiles in a format other than the most common one
+// are skipped, since an MBTiles file has a single format.
+func Export(cacheDir, outPath, name string) (int, error) {
+	entries, err := os.ReadDir(cacheDir)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read tile cache: %w", err)
+	}
+
+	// Group tiles by format
+	byFormat := make(map[string][]cachedTile)
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		t, ok := parseCacheName(e.Name())
+		if ok {
+			byFormat[t.format] = append(byFormat[t.format], t)
+		}
+	}
+
+	format := ""
+	for f, list := range byFormat {
+		if format == "" || len(list) > len(byFormat[format]) || (len(list) == len(byFormat[format]) && f < format) {
+			format = f
+		}
+	}
+	if format == "" {
+		return 0, fmt.Errorf("no tiles found in %s", cacheDir)
+	}
+	for f, list := range byFormat {
+		if f != format {
+			logging.Warnf("skipping %d %s tiles (exporting %s)", len(list), f, format)
+		}
+	}
+
+	if _, err := os.Stat(outPath); err == nil {
+		return 0, fmt.Errorf("%s already exists", outPath)
+	}
+	db, err := sql.Open("sqlite3", outPath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create mbtiles: %w", err)
+	}
+	defer db.Close()
+
+	if err := writeTiles(db, cacheDir, format, byFormat[format], name); err != nil {
+		db.Close()
+		os.Remove(outPath)
+		return 0, err
+	}
+	return len(byFormat[format]), nil
+}
+
+// cachedTile is a tile file found in the cache directory
+type cachedTile struct {
+	coord  tiles.TileCoord
+	file   string
+	format string
+}
+
+// parseCacheName parses a "z_x_y.ext" tile cache file name
+func parseCacheName(file string) (cachedTile, bool) {
+	ext := filepath.Ext(file)
+	format, ok := cacheFormats[ext]
+	if !ok {
+		return cachedTile{}, false
+	}
+
+	var t cachedTile
+	n, err := fmt.Sscanf(strings.TrimSuffix(file, ext), "%d_%d_%d", &t.coord.Zoom, &t.coord.X, &t.coord.Y)
+	if err != nil || n != 3 {
+		return cachedTile{}, false
+	}
+	t.file = file
+	t.format = format
+	return t, true
+}
+
+// writeTiles creates the schema and inserts tiles and metadata in one transaction
+func writeTiles(db *sql.DB, cacheDir, format string, list []cachedTile, name string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range []string{
+		"CREATE TABLE metadata (name TEXT, value TEXT)",
+		"CREATE TABLE tiles (zoom_level INTEGER, tile_column INTEGER, tile_row INTEGER, tile_data BLOB)",
+		"CREATE UNIQUE INDEX tile_index ON tiles (zoom_level, tile_column, tile_row)",
+	} {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("failed to create mbtiles schema: %w", err)
+		}
+	}
+
+	insert, err := tx.Prepare("INSERT INTO tiles (zoom_level, tile_column, tile_row, tile_data) VALUES (?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	minZoom, maxZoom := math.MaxInt, 0
+	minLat, minLon := 90.0, 180.0
+	maxLat, maxLon := -90.0, -180.0
+	for _, t := range list {
+		data, err := os.ReadFile(filepath.Join(cacheDir, t.file))
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", t.file, err)
+		}
+		if _, err := insert.Exec(t.coord.Zoom, t.coord.X, tmsRow(t.coord), data); err != nil {
+			return fmt.Errorf("failed to insert %s: %w", t.coord.String(), err)
+		}
+
+		minZoom = min(minZoom, t.coord.Zoom)
+		maxZoom = max(maxZoom, t.coord.Zoom)
+		west, south, east, north := tiles.TileGeoBounds(t.coord)
+		minLat, maxLat = math.Min(minLat, south), math.Max(maxLat, north)
+		minLon, maxLon = math.Min(minLon, west), math.Max(maxLon, east)
+	}
+
+	metadata := map[string]string{
+		"name":    name,
+		"format":  format,
+		"type":    "baselayer",
+		"bounds":  fmt.Sprintf("%f,%f,%f,%f", minLon, minLat, maxLon, maxLat),
+		"minzoom": fmt.Sprint(minZoom),
+		"maxzoom": fmt.Sprint(maxZoom),
+	}
+	for k, v := range metadata {
+		if _, err := tx.Exec("INSERT INTO metadata (name, value) VALUES (?, ?)", k, v); err != nil {
+			return fmt.Errorf("failed to write metadata: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,90 @@
+// Package mbtiles reads and writes MBTiles files: SQLite databases holding
+// map tiles in a "tiles" table plus a "metadata" key/value table. Rows use
+// the TMS scheme, so Y is flipped relative to slippy map tiles.
+package mbtiles
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"mapviewer/pkg/tiles"
+)
+
+// ErrTileNotFound is returned when the file has no tile at a coordinate
+var ErrTileNotFound = errors.New("tile not in mbtiles file")
+
+// Reader serves tiles from an MBTiles file
+type Reader struct {
+	db       *sql.DB
+	metadata map[string]string
+}
+
+// Open opens an MBTiles file read-only
+func Open(path string) (*Reader, error) {
+	db, err := sql.Open("sqlite3", "file:"+path+"?mode=ro&immutable=1")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mbtiles: %w", err)
+	}
+
+	metadata, err := readMetadata(db)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to read mbtiles metadata from %s: %w", path, err)
+	}
+
+	return &Reader{db: db, metadata: metadata}, nil
+}
+
+// readMetadata loads the metadata table
+func readMetadata(db *sql.DB) (map[string]string, error) {
+	rows, err := db.Query("SELECT name, value FROM metadata")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	metadata := make(map[string]string)
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err != nil {
+			return nil, err
+		}
+		metadata[name] = value
+	}
+	return metadata, rows.Err()
+}
+
+// Metadata returns a metadata value such as "name", "format" or "bounds"
+func (r *Reader) Metadata(key string) string {
+	return r.metadata[key]
+}
+
+// FetchTile returns the image bytes for a slippy map tile
+func (r *Reader) FetchTile(ctx context.Context, coord tiles.TileCoord) ([]byte, error) {
+	var data []byte
+	err := r.db.QueryRowContext(ctx,
+		"SELECT tile_data FROM tiles WHERE zoom_level = ? AND tile_column = ? AND tile_row = ?",
+		coord.Zoom, coord.X, tmsRow(coord),
+	).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%s: %w", coord.String(), ErrTileNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("mbtiles query failed: %w", err)
+	}
+	return data, nil
+}
+
+// Close closes the file
+func (r *Reader) Close() error {
+	return r.db.Close()
+}
+
+// tmsRow converts a slippy map Y to the bottom-up TMS row MBTiles stores
+func tmsRow(coord tiles.TileCoord) int {
+	return (1 << coord.Zoom) - 1 - coord.Y
+}
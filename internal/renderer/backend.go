@@ -0,0 +1,69 @@
+package renderer
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/rajveermalviya/go-webgpu/wgpu"
+
+	"mapviewer/internal/logging"
+)
+
+// BackendEnv overrides the configured WebGPU backend when set
+const BackendEnv = "MAPVIEWER_BACKEND"
+
+// backendNames maps config/env names to WebGPU backends
+var backendNames = map[string]wgpu.InstanceBackend{
+	"primary": wgpu.InstanceBackend_Primary,
+	"metal":   wgpu.InstanceBackend_Metal,
+	"vulkan":  wgpu.InstanceBackend_Vulkan,
+	"dx12":    wgpu.InstanceBackend_DX12,
+	"dx11":    wgpu.InstanceBackend_DX11,
+	"gl":      wgpu.InstanceBackend_GL,
+}
+
+// SelectBackend returns the backend named by BackendEnv, else by configured,
+// else the platform default
+func SelectBackend(configured string) (wgpu.InstanceBackend, error) {
+	name := configured
+	if env := os.Getenv(BackendEnv); env != "" {
+		name = env
+	}
+	if name == "" {
+		return defaultBackend, nil
+	}
+
+	backend, ok := backendNames[strings.ToLower(name)]
+	if !ok {
+		return 0, fmt.Errorf("unknown WebGPU backend %q (want primary, metal, vulkan, dx12, dx11 or gl)", name)
+	}
+	return backend, nil
+}
+
+// BackendName returns the config name of a backend for logging
+func BackendName(backend wgpu.InstanceBackend) string {
+	for name, b := range backendNames {
+		if b == backend {
+			return name
+		}
+	}
+	return fmt.Sprintf("0x%x", uint32(backend))
+}
+
+// LogAdapters prints every adapter the instance can see, to help diagnose
+// why none was suitable
+func LogAdapters(instance *wgpu.Instance) {
+	adapters := instance.EnumerateAdapters(nil)
+	if len(adapters) == 0 {
+		logging.Warnf("no WebGPU adapters found; check GPU drivers or set MAPVIEWER_BACKEND")
+		return
+	}
+
+	logging.Infof("Available WebGPU adapters:")
+	for _, adapter := range adapters {
+		props := adapter.GetProperties()
+		logging.Infof("  %s (%s, %s)", props.Name, props.BackendType, props.AdapterType)
+		adapter.Release()
+	}
+}
@@ -0,0 +1,6 @@
+package renderer
+
+import "github.com/rajveermalviya/go-webgpu/wgpu"
+
+// defaultBackend is the WebGPU backend used on this platform; Metal is the only backend wgpu supports on macOS
+const defaultBackend = wgpu.InstanceBackend_Metal
@@ -0,0 +1,8 @@
+//go:build !darwin && !windows
+
+package renderer
+
+import "github.com/rajveermalviya/go-webgpu/wgpu"
+
+// defaultBackend is the WebGPU backend used on this platform; Vulkan is the native wgpu backend on Linux
+const defaultBackend = wgpu.InstanceBackend_Vulkan
@@ -0,0 +1,7 @@
+package renderer
+
+import "github.com/rajveermalviya/go-webgpu/wgpu"
+
+// defaultBackend is the WebGPU backend used on this platform; DX12 is the
+// native choice on Windows
+const defaultBackend = wgpu.InstanceBackend_DX12
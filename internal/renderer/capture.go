@@ -0,0 +1,121 @@
+package renderer
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/rajveermalviya/go-webgpu/wgpu"
+
+	"mapviewer/internal/camera"
+)
+
+// copyRowAlignment is WebGPU's required alignment for bytesPerRow in
+// texture-to-buffer copies
+const copyRowAlignment = 256
+
+// Capture renders the current view into an offscreen texture and reads it
+// back as an image, e.g. for screenshots
+func (r *Renderer) Capture(cam *camera.Camera) (*image.RGBA, error) {
+	width, height := r.width, r.height
+
+	texture, err := r.device.CreateTexture(&wgpu.TextureDescriptor{
+		Label: "capture_texture",
+		Size: wgpu.Extent3D{
+			Width:              width,
+			Height:             height,
+			DepthOrArrayLayers: 1,
+		},
+		MipLevelCount: 1,
+		SampleCount:   1,
+		Dimension:     wgpu.TextureDimension_2D,
+		Format:        r.swapChainFormat,
+		Usage:         wgpu.TextureUsage_RenderAttachment | wgpu.TextureUsage_CopySrc,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("capture texture creation failed: %w", err)
+	}
+	defer texture.Release()
+
+	view, err := texture.CreateView(nil)
+	if err != nil {
+		return nil, fmt.Errorf("capture view creation failed: %w", err)
+	}
+	defer view.Release()
+
+	if err := r.renderTo(view, cam); err != nil {
+		return nil, err
+	}
+
+	return r.readTexture(texture, width, height)
+}
+
+// readTexture copies a 4-byte-per-pixel texture into CPU memory as RGBA
+func (r *Renderer) readTexture(texture *wgpu.Texture, width, height uint32) (*image.RGBA, error) {
+	// Rows in the staging buffer must be padded to copyRowAlignment
+	unpadded := width * 4
+	padded := (unpadded + copyRowAlignment - 1) / copyRowAlignment * copyRowAlignment
+	size := uint64(padded) * uint64(height)
+
+	buffer, err := r.device.CreateBuffer(&wgpu.BufferDescriptor{
+		Label: "capture_buffer",
+		Usage: wgpu.BufferUsage_CopyDst | wgpu.BufferUsage_MapRead,
+		Size:  size,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("capture buffer creation failed: %w", err)
+	}
+	defer buffer.Release()
+
+	encoder, err := r.device.CreateCommandEncoder(&wgpu.CommandEncoderDescriptor{})
+	if err != nil {
+		return nil, err
+	}
+	defer encoder.Release()
+
+	err = encoder.CopyTextureToBuffer(
+		&wgpu.ImageCopyTexture{Texture: texture, MipLevel: 0, Origin: wgpu.Origin3D{}, Aspect: wgpu.TextureAspect_All},
+		&wgpu.ImageCopyBuffer{
+			Buffer: buffer,
+			Layout: wgpu.TextureDataLayout{Offset: 0, BytesPerRow: padded, RowsPerImage: height},
+		},
+		&wgpu.Extent3D{Width: width, Height: height, DepthOrArrayLayers: 1},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("texture copy failed: %w", err)
+	}
+
+	cmdBuffer, err := encoder.Finish(&wgpu.CommandBufferDescriptor{})
+	if err != nil {
+		return nil, err
+	}
+	defer cmdBuffer.Release()
+	r.queue.Submit(cmdBuffer)
+
+	var status wgpu.BufferMapAsyncStatus
+	if err := buffer.MapAsync(wgpu.MapMode_Read, 0, size, func(s wgpu.BufferMapAsyncStatus) {
+		status = s
+	}); err != nil {
+		return nil, fmt.Errorf("buffer map failed: %w", err)
+	}
+	r.device.Poll(true, nil)
+	if status != wgpu.BufferMapAsyncStatus_Success {
+		return nil, fmt.Errorf("buffer map failed: %s", status)
+	}
+	defer buffer.Unmap()
+
+	data := buffer.GetMappedRange(0, uint(size))
+	img := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
+	swapRB := r.swapChainFormat == wgpu.TextureFormat_BGRA8Unorm || r.swapChainFormat == wgpu.TextureFormat_BGRA8UnormSrgb
+	for y := 0; y < int(height); y++ {
+		src := data[y*int(padded) : y*int(padded)+int(unpadded)]
+		dst := img.Pix[y*img.Stride : y*img.Stride+int(unpadded)]
+		copy(dst, src)
+		if swapRB {
+			for i := 0; i < len(dst); i += 4 {
+				dst[i], dst[i+2] = dst[i+2], dst[i]
+			}
+		}
+	}
+
+	return img, nil
+}
@@ -0,0 +1,45 @@
+package renderer
+
+import (
+	"image"
+	"sort"
+)
+
+// LabelCandidate is a label that may be drawn, with its screen-space box
+type LabelCandidate struct {
+	Name     string
+	Priority int // lower = more important, placed first
+	Rect     image.Rectangle
+
+	// Index lets the caller map the result back to its own data
+	Index int
+}
+
+// Declutter greedily picks labels that don't overlap any already placed,
+// most important first, and drops the rest. Ties are broken by name so the
+// same input gives the same output every frame. The input is not modified.
+func Declutter(candidates []LabelCandidate) []LabelCandidate {
+	sorted := make([]LabelCandidate, len(candidates))
+	copy(sorted, candidates)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Priority != sorted[j].Priority {
+			return sorted[i].Priority < sorted[j].Priority
+		}
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	visible := make([]LabelCandidate, 0, len(sorted))
+	for _, c := range sorted {
+		overlaps := false
+		for _, v := range visible {
+			if c.Rect.Overlaps(v.Rect) {
+				overlaps = true
+				break
+			}
+		}
+		if !overlaps {
+			visible = append(visible, c)
+		}
+	}
+	return visible
+}
@@ -0,0 +1,163 @@
+package renderer
+
+import (
+	"fmt"
+	"unsafe"
+
+	"github.com/rajveermalviya/go-webgpu/wgpu"
+)
+
+// initFrameResources creates the buffers and bind group the tile pass uses
+// every frame. Their contents are updated with queue writes instead of
+// being recreated, so a frame allocates almost nothing on the GPU side.
+func (r *Renderer) initFrameResources() error {
+	var err error
+
+	// Unit quad (0-1 range) drawn once per tile instance
+	vertices := []Vertex{
+		{Position: [2]float32{0, 0}, TexCoord: [2]float32{0, 0}},
+		{Position: [2]float32{1, 0}, TexCoord: [2]float32{1, 0}},
+		{Position: [2]float32{1, 1}, TexCoord: [2]float32{1, 1}},
+		{Position: [2]float32{0, 1}, TexCoord: [2]float32{0, 1}},
+	}
+	r.quadVertexBuffer, err = r.device.CreateBufferInit(&wgpu.BufferInitDescriptor{
+		Label:    "vertex_buffer",
+		Contents: wgpu.ToBytes(vertices),
+		Usage:    wgpu.BufferUsage_Vertex,
+	})
+	if err != nil {
+		return fmt.Errorf("vertex buffer creation failed: %w", err)
+	}
+
+	indices := []uint16{0, 1, 2, 0, 2, 3}
+	r.quadIndexBuffer, err = r.device.CreateBufferInit(&wgpu.BufferInitDescriptor{
+		Label:    "index_buffer",
+		Contents: wgpu.ToBytes(indices),
+		Usage:    wgpu.BufferUsage_Index,
+	})
+	if err != nil {
+		return fmt.Errorf("index buffer creation failed: %w", err)
+	}
+
+	// Uniforms and storage sized for the maximum the shader accepts; the
+	// city buffer starts small and grows with writeCities
+	buffers := []struct {
+		target **wgpu.Buffer
+		label  string
+		size   uintptr
+		usage  wgpu.BufferUsage
+	}{
+		{&r.maskParamsBuffer, "mask_params_uniform", unsafe.Sizeof(CityMaskParams{}), wgpu.BufferUsage_Uniform},
+		{&r.cityBuffer, "city_storage", initialCityCapacity * unsafe.Sizeof(CityData{}), wgpu.BufferUsage_Storage},
+		{&r.roadParamsBuffer, "road_params_uniform", unsafe.Sizeof(RoadParams{}), wgpu.BufferUsage_Uniform},
+		{&r.roadBuffer, "road_storage", MaxRoadSegments * unsafe.Sizeof(RoadSegment{}), wgpu.BufferUsage_Storage},
+		{&r.themeParamsBuffer, "theme_params_uniform", unsafe.Sizeof(ThemeParams{}), wgpu.BufferUsage_Uniform},
+	}
+	for _, b := range buffers {
+		*b.target, err = r.device.CreateBuffer(&wgpu.BufferDescriptor{
+			Label: b.label,
+			Size:  uint64(b.size),
+			Usage: b.usage | wgpu.BufferUsage_CopyDst,
+		})
+		if err != nil {
+			return fmt.Errorf("%s creation failed: %w", b.label, err)
+		}
+	}
+	r.cityCapacity = initialCityCapacity
+
+	return r.createFrameBindGroup()
+}
+
+// createFrameBindGroup binds the per-frame buffers; everything but the tile
+// texture is shared by all tiles
+func (r *Renderer) createFrameBindGroup() error {
+	var err error
+	r.frameBindGroup, err = r.device.CreateBindGroup(&wgpu.BindGroupDescriptor{
+		Label:  "tile_frame_bind_group",
+		Layout: r.bindGroupLayout,
+		Entries: []wgpu.BindGroupEntry{
+			{Binding: 1, Sampler: r.sampler},
+			{Binding: 3, Buffer: r.maskParamsBuffer, Size: uint64(unsafe.Sizeof(CityMaskParams{}))},
+			{Binding: 4, Buffer: r.cityBuffer, Size: uint64(r.cityCapacity) * uint64(unsafe.Sizeof(CityData{}))},
+			{Binding: 5, Buffer: r.roadParamsBuffer, Size: uint64(unsafe.Sizeof(RoadParams{}))},
+			{Binding: 6, Buffer: r.roadBuffer, Size: uint64(MaxRoadSegments * unsafe.Sizeof(RoadSegment{}))},
+			{Binding: 7, Buffer: r.themeParamsBuffer, Size: uint64(unsafe.Sizeof(ThemeParams{}))},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("frame bind group creation failed: %w", err)
+	}
+
+	return nil
+}
+
+// writeInstances uploads per-tile instance data, growing the instance
+// buffer when more tiles are visible than it can hold
+func (r *Renderer) writeInstances(instances []TileInfo) error {
+	if len(instances) > r.instanceCapacity {
+		if r.instanceBuffer != nil {
+			r.instanceBuffer.Release()
+		}
+
+		capacity := max(len(instances), 2*r.instanceCapacity, 64)
+		buffer, err := r.device.CreateBuffer(&wgpu.BufferDescriptor{
+			Label: "tile_instance_buffer",
+			Size:  uint64(capacity) * uint64(unsafe.Sizeof(TileInfo{})),
+			Usage: wgpu.BufferUsage_Vertex | wgpu.BufferUsage_CopyDst,
+		})
+		if err != nil {
+			r.instanceBuffer, r.instanceCapacity = nil, 0
+			return fmt.Errorf("instance buffer creation failed: %w", err)
+		}
+		r.instanceBuffer, r.instanceCapacity = buffer, capacity
+	}
+
+	return r.queue.WriteBuffer(r.instanceBuffer, 0, wgpu.ToBytes(instances))
+}
+
+// writeCities uploads the mask cities, growing the city buffer (and
+// rebinding it) when there are more than it can hold
+func (r *Renderer) writeCities(cities []CityData) error {
+	if len(cities) > r.cityCapacity {
+		capacity := min(max(len(cities), 2*r.cityCapacity), MaxCities)
+		buffer, err := r.device.CreateBuffer(&wgpu.BufferDescriptor{
+			Label: "city_storage",
+			Size:  uint64(capacity) * uint64(unsafe.Sizeof(CityData{})),
+			Usage: wgpu.BufferUsage_Storage | wgpu.BufferUsage_CopyDst,
+		})
+		if err != nil {
+			return fmt.Errorf("city buffer creation failed: %w", err)
+		}
+
+		// Keep the old buffer and bind group until the new ones exist
+		oldBuffer, oldGroup, oldCapacity := r.cityBuffer, r.frameBindGroup, r.cityCapacity
+		r.cityBuffer, r.cityCapacity = buffer, capacity
+		if err := r.createFrameBindGroup(); err != nil {
+			buffer.Release()
+			r.cityBuffer, r.frameBindGroup, r.cityCapacity = oldBuffer, oldGroup, oldCapacity
+			return err
+		}
+		oldGroup.Release()
+		oldBuffer.Release()
+	}
+
+	return r.queue.WriteBuffer(r.cityBuffer, 0, wgpu.ToBytes(cities))
+}
+
+// releaseFrameResources frees what initFrameResources and writeInstances created
+func (r *Renderer) releaseFrameResources() {
+	if r.frameBindGroup != nil {
+		r.frameBindGroup.Release()
+	}
+	for _, b := range []*wgpu.Buffer{
+		r.quadVertexBuffer, r.quadIndexBuffer,
+		r.maskParamsBuffer, r.cityBuffer,
+		r.roadParamsBuffer, r.roadBuffer,
+		r.themeParamsBuffer,
+		r.instanceBuffer,
+	} {
+		if b != nil {
+			b.Release()
+		}
+	}
+}
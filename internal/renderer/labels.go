@@ -0,0 +1,331 @@
+package renderer
+
+import (
+	"fmt"
+	"image"
+	"unsafe"
+
+	"github.com/rajveermalviya/go-webgpu/wgpu"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+
+	"mapviewer/internal/camera"
+	"mapviewer/internal/vectortile"
+)
+
+const (
+	// First and last characters baked into the glyph atlas (printable ASCII)
+	firstGlyph = ' '
+	lastGlyph  = '~'
+
+	// MaxLabels caps how many place names are drawn per frame
+	MaxLabels = 200
+)
+
+// TextVertex is a vertex of a glyph quad, already in NDC
+type TextVertex struct {
+	Position [2]float32
+	TexCoord [2]float32
+	Color    [4]float32
+}
+
+// glyphAtlas is a single-row texture holding every glyph of a fixed-width font
+type glyphAtlas struct {
+	texture     *TileTexture
+	glyphWidth  int
+	glyphHeight int
+	ascent      int
+	atlasWidth  int
+}
+
+var (
+	labelColor = [4]float32{0.15, 0.15, 0.2, 1.0}
+	haloColor  = [4]float32{1.0, 1.0, 1.0, 0.85}
+)
+
+// initLabels renders the font atlas and creates the text pipeline
+func (r *Renderer) initLabels() error {
+	face := basicfont.Face7x13
+	count := int(lastGlyph-firstGlyph) + 1
+
+	img := image.NewRGBA(image.Rect(0, 0, face.Advance*count, face.Height))
+	drawer := font.Drawer{Dst: img, Src: image.White, Face: face}
+	for i := 0; i < count; i++ {
+		drawer.Dot = fixed.P(i*face.Advance, face.Ascent)
+		drawer.DrawString(string(rune(firstGlyph + i)))
+	}
+
+	texture, err := r.createTileTexture(img)
+	if err != nil {
+		return fmt.Errorf("glyph atlas creation failed: %w", err)
+	}
+	r.atlas = &glyphAtlas{
+		texture:     texture,
+		glyphWidth:  face.Advance,
+		glyphHeight: face.Height,
+		ascent:      face.Ascent,
+		atlasWidth:  img.Bounds().Dx(),
+	}
+
+	// Nearest filtering keeps the bitmap font crisp
+	r.labelSampler, err = r.device.CreateSampler(&wgpu.SamplerDescriptor{
+		AddressModeU:   wgpu.AddressMode_ClampToEdge,
+		AddressModeV:   wgpu.AddressMode_ClampToEdge,
+		AddressModeW:   wgpu.AddressMode_ClampToEdge,
+		MagFilter:      wgpu.FilterMode_Nearest,
+		MinFilter:      wgpu.FilterMode_Nearest,
+		MipmapFilter:   wgpu.MipmapFilterMode_Nearest,
+		MaxAnisotrophy: 1,
+	})
+	if err != nil {
+		return fmt.Errorf("label sampler creation failed: %w", err)
+	}
+
+	shader, err := r.device.CreateShaderModule(&wgpu.ShaderModuleDescriptor{
+		Label:          "text_shader",
+		WGSLDescriptor: &wgpu.ShaderModuleWGSLDescriptor{Code: TextShader},
+	})
+	if err != nil {
+		return fmt.Errorf("text shader creation failed: %w", err)
+	}
+	defer shader.Release()
+
+	bindGroupLayout, err := r.device.CreateBindGroupLayout(&wgpu.BindGroupLayoutDescriptor{
+		Label: "text_bind_group_layout",
+		Entries: []wgpu.BindGroupLayoutEntry{
+			{
+				Binding:    0,
+				Visibility: wgpu.ShaderStage_Fragment,
+				Sampler:    wgpu.SamplerBindingLayout{Type: wgpu.SamplerBindingType_Filtering},
+			},
+			{
+				Binding:    1,
+				Visibility: wgpu.ShaderStage_Fragment,
+				Texture: wgpu.TextureBindingLayout{
+					SampleType:    wgpu.TextureSampleType_Float,
+					ViewDimension: wgpu.TextureViewDimension_2D,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("text bind group layout creation failed: %w", err)
+	}
+	defer bindGroupLayout.Release()
+
+	r.labelBindGroup, err = r.device.CreateBindGroup(&wgpu.BindGroupDescriptor{
+		Layout: bindGroupLayout,
+		Entries: []wgpu.BindGroupEntry{
+			{Binding: 0, Sampler: r.labelSampler},
+			{Binding: 1, TextureView: r.atlas.texture.View},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("text bind group creation failed: %w", err)
+	}
+
+	pipelineLayout, err := r.device.CreatePipelineLayout(&wgpu.PipelineLayoutDescriptor{
+		Label:            "text_pipeline_layout",
+		BindGroupLayouts: []*wgpu.BindGroupLayout{bindGroupLayout},
+	})
+	if err != nil {
+		return fmt.Errorf("text pipeline layout creation failed: %w", err)
+	}
+	defer pipelineLayout.Release()
+
+	r.textPipeline, err = r.device.CreateRenderPipeline(&wgpu.RenderPipelineDescriptor{
+		Label:  "text_pipeline",
+		Layout: pipelineLayout,
+		Vertex: wgpu.VertexState{
+			Module:     shader,
+			EntryPoint: "vs_main",
+			Buffers: []wgpu.VertexBufferLayout{{
+				ArrayStride: uint64(unsafe.Sizeof(TextVertex{})),
+				StepMode:    wgpu.VertexStepMode_Vertex,
+				Attributes: []wgpu.VertexAttribute{
+					{Format: wgpu.VertexFormat_Float32x2, Offset: 0, ShaderLocation: 0},
+					{Format: wgpu.VertexFormat_Float32x2, Offset: 8, ShaderLocation: 1},
+					{Format: wgpu.VertexFormat_Float32x4, Offset: 16, ShaderLocation: 2},
+				},
+			}},
+		},
+		Fragment: &wgpu.FragmentState{
+			Module:     shader,
+			EntryPoint: "fs_main",
+			Targets: []wgpu.ColorTargetState{{
+				Format:    r.swapChainFormat,
+				Blend:     &wgpu.BlendState_AlphaBlending,
+				WriteMask: wgpu.ColorWriteMask_All,
+			}},
+		},
+		Primitive: wgpu.PrimitiveState{
+			Topology: wgpu.PrimitiveTopology_TriangleList,
+		},
+		Multisample: r.multisampleState(),
+	})
+	if err != nil {
+		return fmt.Errorf("text pipeline creation failed: %w", err)
+	}
+
+	return nil
+}
+
+// releaseLabels frees the text pipeline and glyph atlas
+func (r *Renderer) releaseLabels() {
+	if r.textPipeline != nil {
+		r.textPipeline.Release()
+	}
+	if r.labelBindGroup != nil {
+		r.labelBindGroup.Release()
+	}
+	if r.labelSampler != nil {
+		r.labelSampler.Release()
+	}
+	if r.atlas != nil {
+		r.atlas.texture.Release()
+	}
+}
+
+// minLabelZoom returns the lowest zoom at which a place is labelled.
+// Bigger settlements appear first; within a class, lower (more important)
+// ranks appear earlier.
+func minLabelZoom(place vectortile.Place) int {
+	var base int
+	switch place.Class {
+	case "city":
+		base = 3
+	case "town":
+		base = 8
+	case "village":
+		base = 11
+	default:
+		base = 13
+	}
+	return base + place.Rank/4
+}
+
+// labelScale returns the glyph scale for a place, larger for major cities
+func labelScale(place vectortile.Place) int {
+	if place.Class == "city" && place.Rank > 0 && place.Rank <= 4 {
+		return 2
+	}
+	return 1
+}
+
+// buildLabelVertices lays out place names around their locations, dropping
+// labels that would overlap a more important one
+func (r *Renderer) buildLabelVertices(cam *camera.Camera) []TextVertex {
+	var places []vectortile.Place
+	for _, data := range r.visibleVectorTiles(cam) {
+		for _, place := range data.Places {
+			if place.Name != "" && cam.DisplayZoom() >= minLabelZoom(place) {
+				places = append(places, place)
+			}
+		}
+	}
+
+	screen := image.Rect(0, 0, int(r.width), int(r.height))
+	candidates := make([]LabelCandidate, 0, len(places))
+	for i, place := range places {
+		scale := labelScale(place)
+		textW := len(place.Name) * r.atlas.glyphWidth * scale
+		textH := r.atlas.glyphHeight * scale
+
+		// Center the text just above the place
+		sx, sy := cam.GeoToScreen(place.Location.Lon(), place.Location.Lat())
+		left := int(sx) - textW/2
+		top := int(sy) - textH - 2
+		rect := image.Rect(left, top, left+textW, top+textH)
+		if !rect.Overlaps(screen) {
+			continue
+		}
+
+		candidates = append(candidates, LabelCandidate{
+			Name:     place.Name,
+			Priority: minLabelZoom(place),
+			Rect:     rect.Inset(-2), // keep a small gap between labels
+			Index:    i,
+		})
+	}
+
+	visible := Declutter(candidates)
+	if len(visible) > MaxLabels {
+		visible = visible[:MaxLabels]
+	}
+
+	w := float32(r.width)
+	h := float32(r.height)
+	var vertices []TextVertex
+	for _, c := range visible {
+		place := places[c.Index]
+		scale := labelScale(place)
+		left, top := c.Rect.Min.X+2, c.Rect.Min.Y+2
+
+		// Halo first so the text is readable on any background
+		for _, off := range [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+			vertices = r.appendText(vertices, place.Name, left+off[0], top+off[1], scale, haloColor, w, h)
+		}
+		vertices = r.appendText(vertices, place.Name, left, top, scale, labelColor, w, h)
+	}
+
+	return vertices
+}
+
+// appendText appends two triangles per glyph of text with its top-left
+// corner at the given screen position
+func (r *Renderer) appendText(vertices []TextVertex, text string, left, top, scale int, color [4]float32, w, h float32) []TextVertex {
+	gw := r.atlas.glyphWidth * scale
+	gh := r.atlas.glyphHeight * scale
+	uStep := float32(r.atlas.glyphWidth) / float32(r.atlas.atlasWidth)
+
+	x := left
+	for _, ch := range text {
+		if ch < firstGlyph || ch > lastGlyph {
+			ch = '?'
+		}
+		u0 := float32(ch-firstGlyph) * uStep
+		u1 := u0 + uStep
+
+		x0 := float32(x)/w*2 - 1
+		x1 := float32(x+gw)/w*2 - 1
+		y0 := 1 - float32(top)/h*2
+		y1 := 1 - float32(top+gh)/h*2
+
+		vertices = append(vertices,
+			TextVertex{Position: [2]float32{x0, y0}, TexCoord: [2]float32{u0, 0}, Color: color},
+			TextVertex{Position: [2]float32{x1, y0}, TexCoord: [2]float32{u1, 0}, Color: color},
+			TextVertex{Position: [2]float32{x0, y1}, TexCoord: [2]float32{u0, 1}, Color: color},
+			TextVertex{Position: [2]float32{x1, y0}, TexCoord: [2]float32{u1, 0}, Color: color},
+			TextVertex{Position: [2]float32{x1, y1}, TexCoord: [2]float32{u1, 1}, Color: color},
+			TextVertex{Position: [2]float32{x0, y1}, TexCoord: [2]float32{u0, 1}, Color: color},
+		)
+		x += gw
+	}
+
+	return vertices
+}
+
+// drawLabels records place-name labels into the pass. The returned buffer
+// (if any) must be released after the command buffer is submitted.
+func (r *Renderer) drawLabels(pass *wgpu.RenderPassEncoder, cam *camera.Camera) *wgpu.Buffer {
+	vertices := r.buildLabelVertices(cam)
+	if len(vertices) == 0 {
+		return nil
+	}
+
+	buffer, err := r.device.CreateBufferInit(&wgpu.BufferInitDescriptor{
+		Label:    "text_vertex_buffer",
+		Contents: wgpu.ToBytes(vertices),
+		Usage:    wgpu.BufferUsage_Vertex,
+	})
+	if err != nil {
+		return nil
+	}
+
+	pass.SetPipeline(r.textPipeline)
+	pass.SetBindGroup(0, r.labelBindGroup, nil)
+	pass.SetVertexBuffer(0, buffer, 0, wgpu.WholeSize)
+	pass.Draw(uint32(len(vertices)), 1, 0, 0)
+	return buffer
+}
@@ -0,0 +1,97 @@
+package renderer
+
+import (
+	"math"
+
+	"github.com/rajveermalviya/go-webgpu/wgpu"
+
+	"mapviewer/internal/camera"
+)
+
+// DefaultMarkerSize is the diameter in pixels of markers without a Size
+const DefaultMarkerSize = 12
+
+// markerSegments is how many triangles approximate a marker's disc
+const markerSegments = 16
+
+// Marker is a custom point pinned to the map, drawn as a disc of constant
+// screen size on top of everything else
+type Marker struct {
+	Lat, Lon float64
+	Color    [4]float32 // RGBA
+	Size     float32    // Diameter in pixels (0 = DefaultMarkerSize)
+}
+
+// SetMarkers replaces the markers drawn over the map. It is safe to call
+// from any goroutine; nil clears them.
+func (r *Renderer) SetMarkers(markers []Marker) {
+	list := make([]Marker, len(markers))
+	copy(list, markers)
+
+	r.markersMu.Lock()
+	r.markers = list
+	r.markersMu.Unlock()
+	r.markChanged()
+}
+
+// buildMarkerVertices converts on-screen markers to triangle-list vertices
+func (r *Renderer) buildMarkerVertices(cam *camera.Camera) []LineVertex {
+	r.markersMu.RLock()
+	markers := r.markers
+	r.markersMu.RUnlock()
+	if len(markers) == 0 {
+		return nil
+	}
+
+	b := r.newLineBuilder(cam)
+	var vertices []LineVertex
+	for _, m := range markers {
+		size := float64(m.Size)
+		if size <= 0 {
+			size = DefaultMarkerSize
+		}
+		radius := size / 2
+
+		// Use the copy of the marker nearest the camera across the antimeridian
+		lon := m.Lon - 360*math.Round((m.Lon-cam.Lon)/360)
+		cx, cy := cam.GeoToScreen(lon, m.Lat)
+		if cx < -radius || cy < -radius || cx > b.w+radius || cy > b.h+radius {
+			continue
+		}
+
+		center := b.ndc(cx, cy)
+		for i := 0; i < markerSegments; i++ {
+			a0 := 2 * math.Pi * float64(i) / markerSegments
+			a1 := 2 * math.Pi * float64(i+1) / markerSegments
+			vertices = append(vertices,
+				LineVertex{Position: center, Color: m.Color},
+				LineVertex{Position: b.ndc(cx+radius*math.Cos(a0), cy+radius*math.Sin(a0)), Color: m.Color},
+				LineVertex{Position: b.ndc(cx+radius*math.Cos(a1), cy+radius*math.Sin(a1)), Color: m.Color},
+			)
+		}
+	}
+	return vertices
+}
+
+// drawMarkers records the markers into the pass. The returned buffer (if
+// any) must be released after the command buffer is submitted.
+func (r *Renderer) drawMarkers(pass *wgpu.RenderPassEncoder, cam *camera.Camera) *wgpu.Buffer {
+	vertices := r.buildMarkerVertices(cam)
+	if len(vertices) == 0 {
+		return nil
+	}
+
+	buffer, err := r.device.CreateBufferInit(&wgpu.BufferInitDescriptor{
+		Label:    "marker_vertex_buffer",
+		Contents: wgpu.ToBytes(vertices),
+		Usage:    wgpu.BufferUsage_Vertex,
+	})
+	if err != nil {
+		return nil
+	}
+
+	pass.SetPipeline(r.fillPipeline)
+	pass.SetVertexBuffer(0, buffer, 0, wgpu.WholeSize)
+	pass.Draw(uint32(len(vertices)), 1, 0, 0)
+	return buffer
+}
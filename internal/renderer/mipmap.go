@@ -0,0 +1,40 @@
+package renderer
+
+import (
+	"image"
+	"math/bits"
+)
+
+// mipLevelCount returns the number of levels in a full mip chain
+func mipLevelCount(width, height int) int {
+	return bits.Len(uint(max(width, height, 1)))
+}
+
+// downsample halves an image with a 2x2 box filter. Odd edges reuse the
+// last row/column so no pixel is dropped entirely.
+func downsample(src *image.RGBA) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := max(sw/2, 1), max(sh/2, 1)
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		y0 := min(2*y, sh-1)
+		y1 := min(2*y+1, sh-1)
+		for x := 0; x < dw; x++ {
+			x0 := min(2*x, sw-1)
+			x1 := min(2*x+1, sw-1)
+
+			i00 := y0*src.Stride + x0*4
+			i10 := y0*src.Stride + x1*4
+			i01 := y1*src.Stride + x0*4
+			i11 := y1*src.Stride + x1*4
+			o := y*dst.Stride + x*4
+			for c := 0; c < 4; c++ {
+				sum := int(src.Pix[i00+c]) + int(src.Pix[i10+c]) + int(src.Pix[i01+c]) + int(src.Pix[i11+c])
+				dst.Pix[o+c] = uint8((sum + 2) / 4)
+			}
+		}
+	}
+
+	return dst
+}
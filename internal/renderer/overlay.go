@@ -0,0 +1,306 @@
+package renderer
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"unsafe"
+
+	"github.com/paulmach/orb"
+	"github.com/rajveermalviya/go-webgpu/wgpu"
+
+	"mapviewer/internal/camera"
+	"mapviewer/internal/vectortile"
+	"mapviewer/pkg/tiles"
+)
+
+// LineVertex is a vertex of the vector overlay, already in NDC
+type LineVertex struct {
+	Position [2]float32
+	Color    [4]float32
+}
+
+// transportColors maps transportation classes to overlay colors (RGBA).
+// Classes not listed here are not drawn.
+var transportColors = map[string][4]float32{
+	"motorway":  {0.91, 0.55, 0.24, 0.9},
+	"trunk":     {0.95, 0.68, 0.33, 0.9},
+	"primary":   {0.98, 0.82, 0.45, 0.85},
+	"secondary": {0.98, 0.90, 0.60, 0.8},
+	"rail":      {0.35, 0.35, 0.40, 0.9},
+	"transit":   {0.50, 0.40, 0.60, 0.8},
+}
+
+// Boundary overlay styles. Country borders (admin level 2) are drawn wider
+// than sub-national ones.
+var (
+	countryBoundaryColor = [4]float32{0.45, 0.30, 0.50, 0.9}
+	regionBoundaryColor  = [4]float32{0.55, 0.45, 0.60, 0.6}
+)
+
+const (
+	countryBoundaryWidth = 3
+	regionBoundaryWidth  = 1
+)
+
+// boundaryStyle returns the overlay color and width in pixels for a boundary
+func boundaryStyle(b vectortile.Boundary) (color [4]float32, width int) {
+	if b.AdminLevel == 2 {
+		return countryBoundaryColor, countryBoundaryWidth
+	}
+	return regionBoundaryColor, regionBoundaryWidth
+}
+
+// initOverlay creates the line and fill pipelines used for vector overlays
+func (r *Renderer) initOverlay() error {
+	var err error
+	if r.linePipeline, err = r.createOverlayPipeline("line_pipeline", wgpu.PrimitiveTopology_LineList); err != nil {
+		return err
+	}
+	if r.fillPipeline, err = r.createOverlayPipeline("fill_pipeline", wgpu.PrimitiveTopology_TriangleList); err != nil {
+		return err
+	}
+	return nil
+}
+
+// createOverlayPipeline creates a pipeline drawing LineVertex primitives of
+// the given topology
+func (r *Renderer) createOverlayPipeline(label string, topology wgpu.PrimitiveTopology) (*wgpu.RenderPipeline, error) {
+	shader, err := r.device.CreateShaderModule(&wgpu.ShaderModuleDescriptor{
+		Label:          "line_shader",
+		WGSLDescriptor: &wgpu.ShaderModuleWGSLDescriptor{Code: LineShader},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("line shader creation failed: %w", err)
+	}
+	defer shader.Release()
+
+	pipelineLayout, err := r.device.CreatePipelineLayout(&wgpu.PipelineLayoutDescriptor{
+		Label: label + "_layout",
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s layout creation failed: %w", label, err)
+	}
+	defer pipelineLayout.Release()
+
+	pipeline, err := r.device.CreateRenderPipeline(&wgpu.RenderPipelineDescriptor{
+		Label:  label,
+		Layout: pipelineLayout,
+		Vertex: wgpu.VertexState{
+			Module:     shader,
+			EntryPoint: "vs_main",
+			Buffers: []wgpu.VertexBufferLayout{{
+				ArrayStride: uint64(unsafe.Sizeof(LineVertex{})),
+				StepMode:    wgpu.VertexStepMode_Vertex,
+				Attributes: []wgpu.VertexAttribute{
+					{Format: wgpu.VertexFormat_Float32x2, Offset: 0, ShaderLocation: 0},
+					{Format: wgpu.VertexFormat_Float32x4, Offset: 8, ShaderLocation: 1},
+				},
+			}},
+		},
+		Fragment: &wgpu.FragmentState{
+			Module:     shader,
+			EntryPoint: "fs_main",
+			Targets: []wgpu.ColorTargetState{{
+				Format:    r.swapChainFormat,
+				Blend:     &wgpu.BlendState_AlphaBlending,
+				WriteMask: wgpu.ColorWriteMask_All,
+			}},
+		},
+		Primitive: wgpu.PrimitiveState{
+			Topology: topology,
+		},
+		Multisample: r.multisampleState(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s creation failed: %w", label, err)
+	}
+
+	return pipeline, nil
+}
+
+// vectorTileRange returns the vector tiles covering the viewport
+func (r *Renderer) vectorTileRange(cam *camera.Camera) (zoom, minX, minY, maxX, maxY int) {
+	zoom = cam.Zoom
+	if zoom > vectortile.MaxTileZoom {
+		zoom = vectortile.MaxTileZoom
+	}
+
+	lon0, lat0 := cam.ScreenToGeo(0, 0)
+	lon1, lat1 := cam.ScreenToGeo(float64(r.width), float64(r.height))
+	topLeft := tiles.LatLonToTile(lat0, lon0, zoom)
+	bottomRight := tiles.LatLonToTile(lat1, lon1, zoom)
+
+	maxTile := (1 << zoom) - 1
+	return zoom, max(topLeft.X, 0), max(topLeft.Y, 0), min(bottomRight.X, maxTile), min(bottomRight.Y, maxTile)
+}
+
+// visibleVectorTiles returns the vector tiles covering the viewport. Tiles
+// not yet cached are requested in the background and skipped this frame.
+func (r *Renderer) visibleVectorTiles(cam *camera.Camera) []*vectortile.TileData {
+	if r.vectorTileCache == nil {
+		return nil
+	}
+
+	zoom, minX, minY, maxX, maxY := r.vectorTileRange(cam)
+	var result []*vectortile.TileData
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			if data, ok := r.vectorTileCache.Peek(zoom, x, y); ok {
+				result = append(result, data)
+				continue
+			}
+			r.requestVectorTile(zoom, x, y)
+		}
+	}
+	return result
+}
+
+// PreloadVectorTiles fetches the vector tiles for the view and waits for
+// them, so the next frame has complete overlays and labels
+func (r *Renderer) PreloadVectorTiles(cam *camera.Camera) {
+	if r.vectorTileCache == nil {
+		return
+	}
+
+	zoom, minX, minY, maxX, maxY := r.vectorTileRange(cam)
+	var wg sync.WaitGroup
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			wg.Add(1)
+			go func(x, y int) {
+				defer wg.Done()
+				r.vectorTileCache.GetTile(zoom, x, y)
+			}(x, y)
+		}
+	}
+	wg.Wait()
+}
+
+// requestVectorTile fetches a vector tile in the background, once
+func (r *Renderer) requestVectorTile(z, x, y int) {
+	key := tiles.TileCoord{X: x, Y: y, Zoom: z}.String()
+
+	r.overlayMu.Lock()
+	if r.overlayRequested[key] {
+		r.overlayMu.Unlock()
+		return
+	}
+	r.overlayRequested[key] = true
+	r.overlayMu.Unlock()
+
+	go func() {
+		if _, err := r.vectorTileCache.GetTile(z, x, y); err != nil {
+			// Allow a later frame to try again
+			r.overlayMu.Lock()
+			delete(r.overlayRequested, key)
+			r.overlayMu.Unlock()
+			return
+		}
+		r.markChanged()
+	}()
+}
+
+// lineBuilder accumulates NDC line-list vertices for geometries in lon/lat
+type lineBuilder struct {
+	cam      *camera.Camera
+	w, h     float64
+	vertices []LineVertex
+}
+
+func (r *Renderer) newLineBuilder(cam *camera.Camera) *lineBuilder {
+	return &lineBuilder{cam: cam, w: float64(r.width), h: float64(r.height)}
+}
+
+// ndc converts a screen position to NDC
+func (b *lineBuilder) ndc(sx, sy float64) [2]float32 {
+	return [2]float32{float32(sx/b.w*2 - 1), float32(1 - sy/b.h*2)}
+}
+
+// geoNDC converts a lon/lat point to NDC
+func (b *lineBuilder) geoNDC(p orb.Point) [2]float32 {
+	return b.ndc(b.cam.GeoToScreen(p.Lon(), p.Lat()))
+}
+
+// addLine appends the segments of ls, width pixels wide
+func (b *lineBuilder) addLine(ls orb.LineString, color [4]float32, width int) {
+	for i := 0; i+1 < len(ls); i++ {
+		x0, y0 := b.cam.GeoToScreen(ls[i].Lon(), ls[i].Lat())
+		x1, y1 := b.cam.GeoToScreen(ls[i+1].Lon(), ls[i+1].Lat())
+
+		// Skip segments entirely off one side of the screen
+		margin := float64(width)
+		if max(x0, x1) < -margin || min(x0, x1) > b.w+margin || max(y0, y1) < -margin || min(y0, y1) > b.h+margin {
+			continue
+		}
+
+		// Line lists are always 1px wide, so wider lines are drawn as
+		// parallel copies offset along the segment's normal
+		nx, ny := y0-y1, x1-x0
+		if l := math.Hypot(nx, ny); l > 0 {
+			nx, ny = nx/l, ny/l
+		}
+		for k := 0; k < width; k++ {
+			off := float64(k) - float64(width-1)/2
+			b.vertices = append(b.vertices,
+				LineVertex{Position: b.ndc(x0+nx*off, y0+ny*off), Color: color},
+				LineVertex{Position: b.ndc(x1+nx*off, y1+ny*off), Color: color},
+			)
+		}
+	}
+}
+
+// addGeometry appends g if it is a line string or multi line string
+func (b *lineBuilder) addGeometry(g orb.Geometry, color [4]float32, width int) {
+	switch g := g.(type) {
+	case orb.LineString:
+		b.addLine(g, color, width)
+	case orb.MultiLineString:
+		for _, ls := range g {
+			b.addLine(ls, color, width)
+		}
+	}
+}
+
+// buildLineVertices converts visible transport lines and boundaries to NDC
+// line-list vertices
+func (r *Renderer) buildLineVertices(cam *camera.Camera) []LineVertex {
+	b := r.newLineBuilder(cam)
+
+	for _, data := range r.visibleVectorTiles(cam) {
+		for _, line := range data.Transport {
+			if color, ok := transportColors[line.Class]; ok {
+				b.addGeometry(line.Geometry, color, 1)
+			}
+		}
+		for _, boundary := range data.Boundaries {
+			color, width := boundaryStyle(boundary)
+			b.addGeometry(boundary.Geometry, color, width)
+		}
+	}
+
+	return b.vertices
+}
+
+// drawOverlay records the vector overlay into the pass. The returned buffer
+// (if any) must be released after the command buffer is submitted.
+func (r *Renderer) drawOverlay(pass *wgpu.RenderPassEncoder, cam *camera.Camera) *wgpu.Buffer {
+	vertices := r.buildLineVertices(cam)
+	if len(vertices) == 0 {
+		return nil
+	}
+
+	buffer, err := r.device.CreateBufferInit(&wgpu.BufferInitDescriptor{
+		Label:    "line_vertex_buffer",
+		Contents: wgpu.ToBytes(vertices),
+		Usage:    wgpu.BufferUsage_Vertex,
+	})
+	if err != nil {
+		return nil
+	}
+
+	pass.SetPipeline(r.linePipeline)
+	pass.SetVertexBuffer(0, buffer, 0, wgpu.WholeSize)
+	pass.Draw(uint32(len(vertices)), 1, 0, 0)
+	return buffer
+}
@@ -2,25 +2,32 @@ package renderer
 
 import (
 	"bytes"
+	"container/list"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
+	_ "image/jpeg"
 	_ "image/png"
 	"math"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 	"unsafe"
 
+	"github.com/paulmach/orb"
 	"github.com/rajveermalviya/go-webgpu/wgpu"
+	_ "golang.org/x/image/webp"
 
 	"mapviewer/internal/camera"
 	"mapviewer/internal/config"
+	"mapviewer/internal/logging"
 	"mapviewer/internal/vectortile"
 	"mapviewer/pkg/tiles"
 )
 
-const TileSize = 256
-
 // Vertex represents a vertex with position and texture coordinates
 type Vertex struct {
 	Position [2]float32
@@ -31,9 +38,43 @@ type Vertex struct {
 type TileTexture struct {
 	Texture *wgpu.Texture
 	View    *wgpu.TextureView
+
+	// BindGroup binds View for the tile pipeline (nil if not used for tiles)
+	BindGroup *wgpu.BindGroup
+
+	// FadeStart is when the tile was uploaded; zero means always opaque
+	FadeStart time.Time
+}
+
+// TileFadeDuration is how long a newly loaded tile takes to fade in
+const TileFadeDuration = 200 * time.Millisecond
+
+// CityRadiusEaseTime is roughly how long the city mask takes to reach a new
+// radius after CityRadiusPercent changes
+const CityRadiusEaseTime = 300 * time.Millisecond
+
+// fadeAlpha returns the tile's opacity at the given time
+func (t *TileTexture) fadeAlpha(now time.Time) float32 {
+	if t.FadeStart.IsZero() {
+		return 1
+	}
+	elapsed := now.Sub(t.FadeStart)
+	if elapsed >= TileFadeDuration {
+		return 1
+	}
+	return float32(elapsed) / float32(TileFadeDuration)
 }
 
-// CityData represents a city for the mask shader (max 64 cities)
+// Release frees the texture's GPU resources
+func (t *TileTexture) Release() {
+	if t.BindGroup != nil {
+		t.BindGroup.Release()
+	}
+	t.View.Release()
+	t.Texture.Release()
+}
+
+// CityData represents a city for the mask shader
 type CityData struct {
 	X      float32 // Longitude
 	Y      float32 // Latitude
@@ -41,7 +82,82 @@ type CityData struct {
 	_      float32 // Padding for alignment
 }
 
-const MaxCities = 64
+// MaxCities caps the cities sent to the mask shader per frame. Every
+// masked pixel loops over all of them, so this is a fragment cost budget;
+// the storage buffer itself grows with the count, starting at
+// initialCityCapacity.
+const MaxCities = 1024
+
+const initialCityCapacity = 64
+
+// CityViewMargin is how far (degrees) outside the viewport cities are still
+// sent to the shader, enough for the largest city's mask to reach the edge
+const CityViewMargin = 0.5
+
+// CityDataZoom is the deepest zoom city data is read at; one tile covers
+// ~40km, so a 3x3 block spans a metro area
+const CityDataZoom = 10
+
+// MaxCachedCityBlocks bounds how many city blocks UpdateCitiesForView keeps
+const MaxCachedCityBlocks = 16
+
+// cityBlock identifies the 3x3 block of city tiles around a center tile
+type cityBlock struct {
+	x, y, zoom int
+}
+
+// cityBlockData is the city mask input computed for one cityBlock
+type cityBlockData struct {
+	cities []placedCity
+	roads  []RoadSegment
+}
+
+// cityZoomFor picks the zoom to read city data at for a view zoom
+func cityZoomFor(zoom int) int {
+	return min(zoom, CityDataZoom)
+}
+
+// placedCity is a city around the view with its place rank (0 = unranked)
+type placedCity struct {
+	CityData
+	rank int
+}
+
+// RoadSegment is a straight piece of road for the mask shader, with the
+// (radius-adjusted) distance from its midpoint to the nearest city
+type RoadSegment struct {
+	X0, Y0   float32 // Start lon/lat
+	X1, Y1   float32 // End lon/lat
+	CityDist float32 // Degrees to the nearest city, divided by its radius
+	_        [3]float32
+}
+
+// MaxRoadSegments caps the road segments sent to the mask shader
+const MaxRoadSegments = 512
+
+// roadWeightClasses are the road classes that spread the city mask
+var roadWeightClasses = map[string]bool{
+	"motorway":  true,
+	"trunk":     true,
+	"primary":   true,
+	"secondary": true,
+	"tertiary":  true,
+}
+
+// HeadlessFormat is the render target format used without a window surface
+const HeadlessFormat = wgpu.TextureFormat_RGBA8UnormSrgb
+
+// DefaultMaxTextures bounds the number of tile textures kept on the GPU
+const DefaultMaxTextures = 512
+
+// VectorTileSource supplies the vector tile features the renderer draws.
+// *vectortile.VectorTileCache is the default implementation.
+type VectorTileSource interface {
+	GetTile(z, x, y int) (*vectortile.TileData, error)
+
+	// Peek returns a tile only if it is already loaded, without fetching
+	Peek(z, x, y int) (*vectortile.TileData, bool)
+}
 
 // Renderer handles all WebGPU rendering
 type Renderer struct {
@@ -55,31 +171,116 @@ type Renderer struct {
 	sampler         *wgpu.Sampler
 	bindGroupLayout *wgpu.BindGroupLayout
 
+	// Layout of the per-texture bind group stored on each TileTexture
+	textureBindGroupLayout *wgpu.BindGroupLayout
+
+	// Buffers reused across frames (see initFrameResources)
+	quadVertexBuffer  *wgpu.Buffer
+	quadIndexBuffer   *wgpu.Buffer
+	maskParamsBuffer  *wgpu.Buffer
+	cityBuffer        *wgpu.Buffer
+	roadParamsBuffer  *wgpu.Buffer
+	roadBuffer        *wgpu.Buffer
+	themeParamsBuffer *wgpu.Buffer
+	frameBindGroup    *wgpu.BindGroup
+	instanceBuffer    *wgpu.Buffer
+	instanceCapacity  int
+
+	// Multisampled color target, resolved into the frame (nil = no MSAA)
+	msaaSamples uint32
+	msaaTexture *wgpu.Texture
+	msaaView    *wgpu.TextureView
+
 	placeholder *TileTexture
 	textures    map[string]*TileTexture
 	texturesMu  sync.RWMutex
 
+	// LRU bookkeeping for textures (guarded by texturesMu)
+	maxTextures  int
+	textureLRU   *list.List // front = most recently used, values are keys
+	textureElems map[string]*list.Element
+	visible      map[string]bool // tiles drawn in the last frame, never evicted
+	uploading    map[string]bool // tiles being decoded by an UploadTile call
+
+	// Vector overlay
+	linePipeline     *wgpu.RenderPipeline
+	fillPipeline     *wgpu.RenderPipeline
+	overlayRequested map[string]bool
+	overlayMu        sync.Mutex
+
+	// Triangulated water polygons per vector tile (render thread only)
+	waterMeshes map[*vectortile.TileData]*fillMesh
+
+	// Custom points set with SetMarkers
+	markers   []Marker
+	markersMu sync.RWMutex
+
+	// Polyline set with SetRoute (nil = none)
+	route      orb.LineString
+	routeColor [4]float32
+	routeMu    sync.RWMutex
+
+	// Place-name labels
+	textPipeline   *wgpu.RenderPipeline
+	labelBindGroup *wgpu.BindGroup
+	labelSampler   *wgpu.Sampler
+	atlas          *glyphAtlas
+
 	// City mask data
-	vectorTileCache *vectortile.VectorTileCache
-	cities          []CityData
+	vectorTileCache VectorTileSource
+	cities          []placedCity  // Most important first, guarded by citiesMu
+	roads           []RoadSegment // guarded by citiesMu
 	citiesMu        sync.RWMutex
+	cityCapacity    int // Cities cityBuffer can hold
+
+	// Computed city blocks, oldest first in cityBlockOrder (guarded by
+	// citiesMu)
+	cityBlocks     map[cityBlock]cityBlockData
+	cityBlockOrder []cityBlock
+
+	// City mask radius the shader sees, eased toward the config value
+	maskRadius      float64
+	maskRadiusFrame time.Time // Zero until the first frame
+
+	// changed is set when something drawn changes outside Render; animating
+	// when the last frame had a fade or easing in progress (see NeedsRedraw)
+	changed   atomic.Bool
+	animating bool
+
+	// Called after changed is set, from any goroutine (see SetOnChange)
+	onChange func()
 
 	width  uint32
 	height uint32
 }
 
-// NewRenderer creates a new WebGPU renderer
-func NewRenderer(adapter *wgpu.Adapter, device *wgpu.Device, queue *wgpu.Queue, surface *wgpu.Surface, width, height uint32, vectorTileCache *vectortile.VectorTileCache) (*Renderer, error) {
+// NewRenderer creates a new WebGPU renderer that keeps at most maxTextures
+// tile textures on the GPU (0 = DefaultMaxTextures) and anti-aliases with
+// msaaSamples samples per pixel (1 = off, 4 = 4x). With a nil surface the
+// renderer is headless and frames can only be read back with Capture.
+func NewRenderer(adapter *wgpu.Adapter, device *wgpu.Device, queue *wgpu.Queue, surface *wgpu.Surface, width, height uint32, vectorTileCache VectorTileSource, maxTextures, msaaSamples int) (*Renderer, error) {
+	if maxTextures <= 0 {
+		maxTextures = DefaultMaxTextures
+	}
+
 	r := &Renderer{
-		adapter:         adapter,
-		device:          device,
-		queue:           queue,
-		surface:         surface,
-		width:           width,
-		height:          height,
-		textures:        make(map[string]*TileTexture),
-		vectorTileCache: vectorTileCache,
-		cities:          make([]CityData, 0, MaxCities),
+		adapter:          adapter,
+		device:           device,
+		queue:            queue,
+		surface:          surface,
+		width:            width,
+		height:           height,
+		textures:         make(map[string]*TileTexture),
+		maxTextures:      maxTextures,
+		textureLRU:       list.New(),
+		textureElems:     make(map[string]*list.Element),
+		visible:          make(map[string]bool),
+		uploading:        make(map[string]bool),
+		overlayRequested: make(map[string]bool),
+		waterMeshes:      make(map[*vectortile.TileData]*fillMesh),
+		vectorTileCache:  vectorTileCache,
+		cityBlocks:       make(map[cityBlock]cityBlockData),
+		msaaSamples:      normalizeMSAASamples(msaaSamples),
 	}
 
 	if err := r.init(); err != nil {
@@ -90,20 +291,29 @@ func NewRenderer(adapter *wgpu.Adapter, device *wgpu.Device, queue *wgpu.Queue,
 }
 
 func (r *Renderer) init() error {
-	// Get preferred format
-	r.swapChainFormat = r.surface.GetPreferredFormat(r.adapter)
-
-	// Create swap chain
 	var err error
-	r.swapChain, err = r.device.CreateSwapChain(r.surface, &wgpu.SwapChainDescriptor{
-		Usage:       wgpu.TextureUsage_RenderAttachment,
-		Format:      r.swapChainFormat,
-		Width:       r.width,
-		Height:      r.height,
-		PresentMode: wgpu.PresentMode_Fifo,
-	})
-	if err != nil {
-		return fmt.Errorf("swap chain creation failed: %w", err)
+	if r.surface == nil {
+		// Headless: frames only go to offscreen textures via Capture
+		r.swapChainFormat = HeadlessFormat
+	} else {
+		// Get preferred format
+		r.swapChainFormat = r.surface.GetPreferredFormat(r.adapter)
+
+		// Create swap chain
+		r.swapChain, err = r.device.CreateSwapChain(r.surface, &wgpu.SwapChainDescriptor{
+			Usage:       wgpu.TextureUsage_RenderAttachment,
+			Format:      r.swapChainFormat,
+			Width:       r.width,
+			Height:      r.height,
+			PresentMode: wgpu.PresentMode_Fifo,
+		})
+		if err != nil {
+			return fmt.Errorf("swap chain creation failed: %w", err)
+		}
+	}
+
+	if err := r.createMSAATarget(); err != nil {
+		return err
 	}
 
 	// Create shader module with city mask support
@@ -117,13 +327,21 @@ struct VertexOutput {
     @builtin(position) position: vec4<f32>,
     @location(0) texCoord: vec2<f32>,
     @location(1) worldPos: vec2<f32>,
+    @location(2) alpha: f32,
+    @location(3) sampleCoord: vec2<f32>,
 }
 
+// Per-instance tile placement (one instance per tile)
 struct TileInfo {
-    offset: vec2<f32>,
-    scale: vec2<f32>,
+    @location(2) offset: vec2<f32>,
+    @location(3) scale: vec2<f32>,
     // Geo bounds of this tile (minLon, minLat, maxLon, maxLat)
-    geoBounds: vec4<f32>,
+    @location(4) geoBounds: vec4<f32>,
+    // Fade-in opacity while a freshly loaded tile appears
+    @location(5) alpha: f32,
+    // Part of the texture to sample (u, v, width, height); a sub-rectangle
+    // when an ancestor tile stands in for one that is still loading
+    @location(6) uvRect: vec4<f32>,
 }
 
 struct CityMaskParams {
@@ -131,6 +349,10 @@ struct CityMaskParams {
     enableMask: f32,          // 1.0 = enabled, 0.0 = disabled
     cityCount: f32,           // Number of active cities
     baseRadius: f32,          // Base radius in degrees
+    saturation: f32,          // 0 = grayscale, 1 = full color
+    nightMode: f32,           // 1.0 = enabled, 0.0 = disabled
+    _pad1: f32,
+    _pad2: f32,
 }
 
 struct City {
@@ -139,14 +361,37 @@ struct City {
     _padding: f32,
 }
 
-@group(0) @binding(0) var<uniform> tile: TileInfo;
+struct RoadParams {
+    enableRoads: f32,         // 1.0 = enabled, 0.0 = disabled
+    roadCount: f32,           // Number of active road segments
+    influence: f32,           // 0-1, how much cheaper travel along roads is
+    decay: f32,               // How quickly the road discount fades from cities
+}
+
+struct ThemeParams {
+    fog: vec4<f32>,           // Color outside the city mask
+    landTint: vec4<f32>,      // Multiplied into tile colors
+}
+
+struct Road {
+    start: vec2<f32>,   // lon, lat
+    end: vec2<f32>,     // lon, lat
+    cityDist: f32,      // adjusted distance from the segment to the nearest city
+    _pad0: f32,
+    _pad1: f32,
+    _pad2: f32,
+}
+
 @group(0) @binding(1) var tileSampler: sampler;
-@group(0) @binding(2) var tileTexture: texture_2d<f32>;
+@group(1) @binding(0) var tileTexture: texture_2d<f32>;
 @group(0) @binding(3) var<uniform> maskParams: CityMaskParams;
 @group(0) @binding(4) var<storage, read> cities: array<City>;
+@group(0) @binding(5) var<uniform> roadParams: RoadParams;
+@group(0) @binding(6) var<storage, read> roads: array<Road>;
+@group(0) @binding(7) var<uniform> theme: ThemeParams;
 
 @vertex
-fn vs_main(in: VertexInput) -> VertexOutput {
+fn vs_main(in: VertexInput, tile: TileInfo) -> VertexOutput {
     var out: VertexOutput;
     // Transform position: scale by tile size, offset, then to NDC
     let pos = in.position * tile.scale + tile.offset;
@@ -157,6 +402,8 @@ fn vs_main(in: VertexInput) -> VertexOutput {
     let lon = mix(tile.geoBounds.x, tile.geoBounds.z, in.texCoord.x);
     let lat = mix(tile.geoBounds.w, tile.geoBounds.y, in.texCoord.y); // Y is flipped
     out.worldPos = vec2<f32>(lon, lat);
+    out.alpha = tile.alpha;
+    out.sampleCoord = tile.uvRect.xy + in.texCoord * tile.uvRect.zw;
 
     return out;
 }
@@ -169,9 +416,52 @@ fn geoDistance(p1: vec2<f32>, p2: vec2<f32>) -> f32 {
     return sqrt(dx * dx + dy * dy);
 }
 
+// Closest point to p on the segment a-b (in lon/lat, scaled like geoDistance)
+fn closestOnSegment(p: vec2<f32>, a: vec2<f32>, b: vec2<f32>) -> vec2<f32> {
+    let latScale = cos(radians(p.y));
+    let scale = vec2<f32>(latScale, 1.0);
+    let ab = (b - a) * scale;
+    let ap = (p - a) * scale;
+    let lenSq = dot(ab, ab);
+    if (lenSq <= 0.0) {
+        return a;
+    }
+    let t = clamp(dot(ap, ab) / lenSq, 0.0, 1.0);
+    return mix(a, b, t);
+}
+
 @fragment
 fn fs_main(in: VertexOutput) -> @location(0) vec4<f32> {
-    let texColor = textureSample(tileTexture, tileSampler, in.texCoord);
+    let color = shadeTile(in);
+
+    // Desaturate toward luminance for a muted background look
+    let luminance = dot(color.rgb, vec3<f32>(0.2126, 0.7152, 0.0722));
+    let rgb = mix(vec3<f32>(luminance), color.rgb, maskParams.saturation);
+
+    return vec4<f32>(rgb, color.a * in.alpha);
+}
+
+// Night mode: invert lightness so bright land turns dark while keeping hue,
+// then push toward blue and compress the highlights
+fn nightTint(color: vec4<f32>) -> vec4<f32> {
+    let luminance = dot(color.rgb, vec3<f32>(0.2126, 0.7152, 0.0722));
+    let inverted = clamp(color.rgb + vec3<f32>(1.0 - 2.0 * luminance), vec3<f32>(0.0), vec3<f32>(1.0));
+
+    // Columns are the contributions of R, G and B
+    let tint = mat3x3<f32>(
+        vec3<f32>(0.50, 0.06, 0.12),
+        vec3<f32>(0.12, 0.58, 0.18),
+        vec3<f32>(0.06, 0.12, 0.80),
+    );
+    let night = pow(tint * inverted, vec3<f32>(1.4)) * 0.85;
+    return vec4<f32>(night, color.a);
+}
+
+fn shadeTile(in: VertexOutput) -> vec4<f32> {
+    var texColor = textureSample(tileTexture, tileSampler, in.sampleCoord) * vec4<f32>(theme.landTint.rgb, 1.0);
+    if (maskParams.nightMode > 0.5) {
+        texColor = nightTint(texColor);
+    }
 
     // If mask disabled or radius is 100%, show full texture
     if (maskParams.enableMask < 0.5 || maskParams.radiusPercent >= 99.9) {
@@ -181,8 +471,7 @@ fn fs_main(in: VertexOutput) -> @location(0) vec4<f32> {
     // If radius is 0%, show only sea (alpha = 0 for land)
     if (maskParams.radiusPercent <= 0.1) {
         // Return desaturated/fog color for areas outside cities
-        let fog = vec4<f32>(0.7, 0.75, 0.8, 1.0);
-        return fog;
+        return vec4<f32>(theme.fog.rgb, 1.0);
     }
 
     // Calculate minimum distance to any city
@@ -201,12 +490,30 @@ fn fs_main(in: VertexOutput) -> @location(0) vec4<f32> {
     // Base radius is in degrees (~0.1 degrees = ~11km at equator)
     let effectiveRadius = maskParams.baseRadius * (maskParams.radiusPercent / 100.0);
 
+    // Roads leading out of cities carry the mask further: reaching a point
+    // via a road costs less than going cross-country, and the discount
+    // fades the further the road is from its city
+    if (roadParams.enableRoads > 0.5) {
+        let roadCount = i32(roadParams.roadCount);
+        for (var i: i32 = 0; i < roadCount; i = i + 1) {
+            let road = roads[i];
+            let q = closestOnSegment(in.worldPos, road.start, road.end);
+            let offRoad = geoDistance(in.worldPos, q);
+            if (offRoad >= minDist) {
+                continue;
+            }
+            let fade = exp(-roadParams.decay * road.cityDist / max(effectiveRadius, 0.001));
+            let alongRoad = road.cityDist * (1.0 - roadParams.influence * fade);
+            minDist = min(minDist, alongRoad + offRoad);
+        }
+    }
+
     // Smooth falloff at city edges
     let edge = effectiveRadius * 0.8;
     let fade = smoothstep(effectiveRadius, edge, minDist);
 
     // Mix between fog and texture based on distance
-    let fog = vec4<f32>(0.75, 0.8, 0.85, 1.0);
+    let fog = vec4<f32>(theme.fog.rgb, 1.0);
     return mix(fog, texColor, fade);
 }
 `
@@ -226,7 +533,7 @@ fn fs_main(in: VertexOutput) -> @location(0) vec4<f32> {
 		AddressModeW:   wgpu.AddressMode_ClampToEdge,
 		MagFilter:      wgpu.FilterMode_Linear,
 		MinFilter:      wgpu.FilterMode_Linear,
-		MipmapFilter:   wgpu.MipmapFilterMode_Nearest,
+		MipmapFilter:   wgpu.MipmapFilterMode_Linear, // trilinear across the tile mip chain
 		MaxAnisotrophy: 1,
 	})
 	if err != nil {
@@ -237,44 +544,64 @@ fn fs_main(in: VertexOutput) -> @location(0) vec4<f32> {
 	r.bindGroupLayout, err = r.device.CreateBindGroupLayout(&wgpu.BindGroupLayoutDescriptor{
 		Label: "tile_bind_group_layout",
 		Entries: []wgpu.BindGroupLayoutEntry{
-			{
-				Binding:    0,
-				Visibility: wgpu.ShaderStage_Vertex | wgpu.ShaderStage_Fragment,
-				Buffer:     wgpu.BufferBindingLayout{Type: wgpu.BufferBindingType_Uniform},
-			},
 			{
 				Binding:    1,
 				Visibility: wgpu.ShaderStage_Fragment,
 				Sampler:    wgpu.SamplerBindingLayout{Type: wgpu.SamplerBindingType_Filtering},
 			},
 			{
-				Binding:    2,
+				Binding:    3,
 				Visibility: wgpu.ShaderStage_Fragment,
-				Texture: wgpu.TextureBindingLayout{
-					SampleType:    wgpu.TextureSampleType_Float,
-					ViewDimension: wgpu.TextureViewDimension_2D,
-				},
+				Buffer:     wgpu.BufferBindingLayout{Type: wgpu.BufferBindingType_Uniform},
 			},
 			{
-				Binding:    3,
+				Binding:    4,
+				Visibility: wgpu.ShaderStage_Fragment,
+				Buffer:     wgpu.BufferBindingLayout{Type: wgpu.BufferBindingType_ReadOnlyStorage},
+			},
+			{
+				Binding:    5,
 				Visibility: wgpu.ShaderStage_Fragment,
 				Buffer:     wgpu.BufferBindingLayout{Type: wgpu.BufferBindingType_Uniform},
 			},
 			{
-				Binding:    4,
+				Binding:    6,
 				Visibility: wgpu.ShaderStage_Fragment,
 				Buffer:     wgpu.BufferBindingLayout{Type: wgpu.BufferBindingType_ReadOnlyStorage},
 			},
+			{
+				Binding:    7,
+				Visibility: wgpu.ShaderStage_Fragment,
+				Buffer:     wgpu.BufferBindingLayout{Type: wgpu.BufferBindingType_Uniform},
+			},
 		},
 	})
 	if err != nil {
 		return fmt.Errorf("bind group layout creation failed: %w", err)
 	}
 
+	// Per-texture bind group layout, so each tile's bind group is made once
+	r.textureBindGroupLayout, err = r.device.CreateBindGroupLayout(&wgpu.BindGroupLayoutDescriptor{
+		Label: "tile_texture_bind_group_layout",
+		Entries: []wgpu.BindGroupLayoutEntry{
+			{
+				Binding:    0,
+				Visibility: wgpu.ShaderStage_Fragment,
+				Texture: wgpu.TextureBindingLayout{
+					SampleType:    wgpu.TextureSampleType_Float,
+					ViewDimension: wgpu.TextureViewDimension_2D,
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("texture bind group layout creation failed: %w", err)
+	}
+
 	// Create pipeline layout
 	pipelineLayout, err := r.device.CreatePipelineLayout(&wgpu.PipelineLayoutDescriptor{
 		Label:            "tile_pipeline_layout",
-		BindGroupLayouts: []*wgpu.BindGroupLayout{r.bindGroupLayout},
+		BindGroupLayouts: []*wgpu.BindGroupLayout{r.bindGroupLayout, r.textureBindGroupLayout},
 	})
 	if err != nil {
 		return fmt.Errorf("pipeline layout creation failed: %w", err)
@@ -288,36 +615,58 @@ fn fs_main(in: VertexOutput) -> @location(0) vec4<f32> {
 		Vertex: wgpu.VertexState{
 			Module:     shader,
 			EntryPoint: "vs_main",
-			Buffers: []wgpu.VertexBufferLayout{{
-				ArrayStride: uint64(unsafe.Sizeof(Vertex{})),
-				StepMode:    wgpu.VertexStepMode_Vertex,
-				Attributes: []wgpu.VertexAttribute{
-					{Format: wgpu.VertexFormat_Float32x2, Offset: 0, ShaderLocation: 0},
-					{Format: wgpu.VertexFormat_Float32x2, Offset: 8, ShaderLocation: 1},
+			Buffers: []wgpu.VertexBufferLayout{
+				{
+					ArrayStride: uint64(unsafe.Sizeof(Vertex{})),
+					StepMode:    wgpu.VertexStepMode_Vertex,
+					Attributes: []wgpu.VertexAttribute{
+						{Format: wgpu.VertexFormat_Float32x2, Offset: 0, ShaderLocation: 0},
+						{Format: wgpu.VertexFormat_Float32x2, Offset: 8, ShaderLocation: 1},
+					},
 				},
-			}},
+				{
+					ArrayStride: uint64(unsafe.Sizeof(TileInfo{})),
+					StepMode:    wgpu.VertexStepMode_Instance,
+					Attributes: []wgpu.VertexAttribute{
+						{Format: wgpu.VertexFormat_Float32x2, Offset: 0, ShaderLocation: 2},
+						{Format: wgpu.VertexFormat_Float32x2, Offset: 8, ShaderLocation: 3},
+						{Format: wgpu.VertexFormat_Float32x4, Offset: 16, ShaderLocation: 4},
+						{Format: wgpu.VertexFormat_Float32, Offset: 32, ShaderLocation: 5},
+						{Format: wgpu.VertexFormat_Float32x4, Offset: 36, ShaderLocation: 6},
+					},
+				},
+			},
 		},
 		Fragment: &wgpu.FragmentState{
 			Module:     shader,
 			EntryPoint: "fs_main",
 			Targets: []wgpu.ColorTargetState{{
 				Format:    r.swapChainFormat,
-				Blend:     &wgpu.BlendState_Replace,
+				Blend:     &wgpu.BlendState_AlphaBlending, // for tile fade-in
 				WriteMask: wgpu.ColorWriteMask_All,
 			}},
 		},
 		Primitive: wgpu.PrimitiveState{
 			Topology: wgpu.PrimitiveTopology_TriangleList,
 		},
-		Multisample: wgpu.MultisampleState{
-			Count: 1,
-			Mask:  0xFFFFFFFF,
-		},
+		Multisample: r.multisampleState(),
 	})
 	if err != nil {
 		return fmt.Errorf("pipeline creation failed: %w", err)
 	}
 
+	if err := r.initFrameResources(); err != nil {
+		return err
+	}
+
+	if err := r.initOverlay(); err != nil {
+		return err
+	}
+
+	if err := r.initLabels(); err != nil {
+		return err
+	}
+
 	// Create placeholder texture
 	r.placeholder, err = r.createPlaceholder()
 	if err != nil {
@@ -328,14 +677,41 @@ fn fs_main(in: VertexOutput) -> @location(0) vec4<f32> {
 }
 
 func (r *Renderer) createPlaceholder() (*TileTexture, error) {
-	img := image.NewRGBA(image.Rect(0, 0, TileSize, TileSize))
-	// Sea blue color
-	seaBlue := color.RGBA{R: 160, G: 195, B: 207, A: 255}
-	draw.Draw(img, img.Bounds(), &image.Uniform{seaBlue}, image.Point{}, draw.Src)
-	return r.createTileTexture(img)
+	img := image.NewRGBA(image.Rect(0, 0, tiles.DefaultTileSize, tiles.DefaultTileSize))
+	// Sea color of the configured theme
+	sea := config.Snapshot().Rendering.ActiveTheme().Sea
+	seaColor := color.RGBA{R: uint8(sea[0] * 255), G: uint8(sea[1] * 255), B: uint8(sea[2] * 255), A: 255}
+	draw.Draw(img, img.Bounds(), &image.Uniform{seaColor}, image.Point{}, draw.Src)
+	return r.createBoundTileTexture(img)
+}
+
+// createBoundTileTexture uploads a tile image and creates its bind group
+func (r *Renderer) createBoundTileTexture(img *image.RGBA) (*TileTexture, error) {
+	tex, err := r.createTileTexture(img)
+	if err != nil {
+		return nil, err
+	}
+
+	tex.BindGroup, err = r.device.CreateBindGroup(&wgpu.BindGroupDescriptor{
+		Label:  "tile_texture_bind_group",
+		Layout: r.textureBindGroupLayout,
+		Entries: []wgpu.BindGroupEntry{
+			{Binding: 0, TextureView: tex.View},
+		},
+	})
+	if err != nil {
+		tex.Release()
+		return nil, err
+	}
+
+	return tex, nil
 }
 
+// createTileTexture uploads an image with a full, CPU-generated mip chain so
+// tiles drawn smaller than native size don't alias
 func (r *Renderer) createTileTexture(img *image.RGBA) (*TileTexture, error) {
+	levels := mipLevelCount(img.Bounds().Dx(), img.Bounds().Dy())
+
 	texture, err := r.device.CreateTexture(&wgpu.TextureDescriptor{
 		Label: "tile_texture",
 		Size: wgpu.Extent3D{
@@ -343,7 +719,7 @@ func (r *Renderer) createTileTexture(img *image.RGBA) (*TileTexture, error) {
 			Height:             uint32(img.Bounds().Dy()),
 			DepthOrArrayLayers: 1,
 		},
-		MipLevelCount: 1,
+		MipLevelCount: uint32(levels),
 		SampleCount:   1,
 		Dimension:     wgpu.TextureDimension_2D,
 		Format:        wgpu.TextureFormat_RGBA8UnormSrgb,
@@ -353,18 +729,24 @@ func (r *Renderer) createTileTexture(img *image.RGBA) (*TileTexture, error) {
 		return nil, err
 	}
 
-	r.queue.WriteTexture(
-		&wgpu.ImageCopyTexture{Texture: texture, MipLevel: 0, Origin: wgpu.Origin3D{}, Aspect: wgpu.TextureAspect_All},
-		img.Pix,
-		&wgpu.TextureDataLayout{Offset: 0, BytesPerRow: uint32(img.Stride), RowsPerImage: uint32(img.Bounds().Dy())},
-		&wgpu.Extent3D{Width: uint32(img.Bounds().Dx()), Height: uint32(img.Bounds().Dy()), DepthOrArrayLayers: 1},
-	)
+	level := img
+	for i := 0; i < levels; i++ {
+		if i > 0 {
+			level = downsample(level)
+		}
+		r.queue.WriteTexture(
+			&wgpu.ImageCopyTexture{Texture: texture, MipLevel: uint32(i), Origin: wgpu.Origin3D{}, Aspect: wgpu.TextureAspect_All},
+			level.Pix,
+			&wgpu.TextureDataLayout{Offset: 0, BytesPerRow: uint32(level.Stride), RowsPerImage: uint32(level.Bounds().Dy())},
+			&wgpu.Extent3D{Width: uint32(level.Bounds().Dx()), Height: uint32(level.Bounds().Dy()), DepthOrArrayLayers: 1},
+		)
+	}
 
 	view, err := texture.CreateView(&wgpu.TextureViewDescriptor{
 		Format:          wgpu.TextureFormat_RGBA8UnormSrgb,
 		Dimension:       wgpu.TextureViewDimension_2D,
 		BaseMipLevel:    0,
-		MipLevelCount:   1,
+		MipLevelCount:   uint32(levels),
 		BaseArrayLayer:  0,
 		ArrayLayerCount: 1,
 		Aspect:          wgpu.TextureAspect_All,
@@ -377,37 +759,105 @@ func (r *Renderer) createTileTexture(img *image.RGBA) (*TileTexture, error) {
 	return &TileTexture{Texture: texture, View: view}, nil
 }
 
+// ErrCorruptTile is returned by UploadTile when the tile data can't be
+// decoded as an image
+var ErrCorruptTile = errors.New("corrupt tile image")
+
 // UploadTile uploads a tile image to GPU
 func (r *Renderer) UploadTile(coord tiles.TileCoord, data []byte) error {
 	key := coord.String()
 
-	r.texturesMu.RLock()
+	// Only one caller decodes and uploads a tile; concurrent ones for the
+	// same coord skip the work
+	r.texturesMu.Lock()
 	_, exists := r.textures[key]
-	r.texturesMu.RUnlock()
 	if exists {
+		r.touchTextureLocked(key)
+	}
+	busy := exists || r.uploading[key]
+	if !busy {
+		r.uploading[key] = true
+	}
+	r.texturesMu.Unlock()
+	if busy {
 		return nil
 	}
+	defer func() {
+		r.texturesMu.Lock()
+		delete(r.uploading, key)
+		r.texturesMu.Unlock()
+	}()
 
 	img, _, err := image.Decode(bytes.NewReader(data))
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %v", ErrCorruptTile, err)
 	}
 
-	rgba := image.NewRGBA(img.Bounds())
-	draw.Draw(rgba, rgba.Bounds(), img, image.Point{}, draw.Src)
-
-	tex, err := r.createTileTexture(rgba)
+	tex, err := r.createBoundTileTexture(normalizeTile(img))
 	if err != nil {
 		return err
 	}
+	if r.surface != nil {
+		// Headless captures are single frames, so there is nothing to fade
+		tex.FadeStart = time.Now()
+	}
 
 	r.texturesMu.Lock()
 	r.textures[key] = tex
+	r.touchTextureLocked(key)
+	r.evictTexturesLocked()
 	r.texturesMu.Unlock()
+	r.markChanged()
 
 	return nil
 }
 
+// touchTextureLocked marks a texture as most recently used.
+// Caller must hold texturesMu for writing.
+func (r *Renderer) touchTextureLocked(key string) {
+	if el, ok := r.textureElems[key]; ok {
+		r.textureLRU.MoveToFront(el)
+		return
+	}
+	r.textureElems[key] = r.textureLRU.PushFront(key)
+}
+
+// evictTexturesLocked releases least-recently-used textures until the count
+// is within maxTextures, skipping tiles that were visible in the last frame.
+// Caller must hold texturesMu for writing.
+func (r *Renderer) evictTexturesLocked() {
+	el := r.textureLRU.Back()
+	for len(r.textures) > r.maxTextures && el != nil {
+		prev := el.Prev()
+		key := el.Value.(string)
+		if !r.visible[key] {
+			if tex, ok := r.textures[key]; ok {
+				tex.Release()
+				delete(r.textures, key)
+			}
+			r.textureLRU.Remove(el)
+			delete(r.textureElems, key)
+		}
+		el = prev
+	}
+}
+
+// MaxFallbackLevels is how many zoom levels up Render looks for a cached
+// ancestor to stand in for a tile that hasn't loaded yet
+const MaxFallbackLevels = 5
+
+// ancestorTextureLocked finds the closest loaded ancestor of a tile.
+// Caller must hold texturesMu.
+func (r *Renderer) ancestorTextureLocked(coord tiles.TileCoord) (*TileTexture, tiles.TileCoord, bool) {
+	for d := 1; d <= MaxFallbackLevels && d <= coord.Zoom; d++ {
+		ancestor := tiles.TileCoord{X: coord.X >> d, Y: coord.Y >> d, Zoom: coord.Zoom - d}
+		if tex, ok := r.textures[ancestor.String()]; ok {
+			return tex, ancestor, true
+		}
+	}
+	return nil, tiles.TileCoord{}, false
+}
+
 // HasTile checks if a tile is uploaded
 func (r *Renderer) HasTile(coord tiles.TileCoord) bool {
 	r.texturesMu.RLock()
@@ -416,7 +866,21 @@ func (r *Renderer) HasTile(coord tiles.TileCoord) bool {
 	return ok
 }
 
-// TileInfo matches shader uniform
+// CountLoaded returns how many of the tiles are uploaded, for progress
+// reporting
+func (r *Renderer) CountLoaded(coords []tiles.TileCoord) int {
+	r.texturesMu.RLock()
+	defer r.texturesMu.RUnlock()
+	loaded := 0
+	for _, coord := range coords {
+		if _, ok := r.textures[coord.String()]; ok {
+			loaded++
+		}
+	}
+	return loaded
+}
+
+// TileInfo matches the shader's per-instance tile attributes
 type TileInfo struct {
 	OffsetX   float32
 	OffsetY   float32
@@ -426,6 +890,13 @@ type TileInfo struct {
 	MinLat    float32
 	MaxLon    float32
 	MaxLat    float32
+	Alpha     float32 // Fade-in opacity (0-1)
+
+	// Sampled texture sub-rectangle (0,0,1,1 = whole texture)
+	UVOffsetX float32
+	UVOffsetY float32
+	UVScaleX  float32
+	UVScaleY  float32
 }
 
 // CityMaskParams matches shader uniform
@@ -434,18 +905,23 @@ type CityMaskParams struct {
 	EnableMask    float32
 	CityCount     float32
 	BaseRadius    float32
+	Saturation    float32
+	NightMode     float32
+	_             [2]float32
 }
 
-// tileToGeoBounds converts tile coordinates to geographic bounds
-func tileToGeoBounds(x, y, zoom int) (minLon, minLat, maxLon, maxLat float64) {
-	n := float64(int(1) << zoom)
-	minLon = float64(x)/n*360.0 - 180.0
-	maxLon = float64(x+1)/n*360.0 - 180.0
+// ThemeParams holds the theme colors for the tile shader
+type ThemeParams struct {
+	Fog      [4]float32
+	LandTint [4]float32
+}
 
-	// Web Mercator to latitude conversion
-	maxLat = 180.0 / math.Pi * (2*math.Atan(math.Exp(math.Pi*(1-2*float64(y)/n))) - math.Pi/2)
-	minLat = 180.0 / math.Pi * (2*math.Atan(math.Exp(math.Pi*(1-2*float64(y+1)/n))) - math.Pi/2)
-	return
+// RoadParams holds road-weight parameters for the mask shader
+type RoadParams struct {
+	EnableRoads float32
+	RoadCount   float32
+	Influence   float32
+	Decay       float32
 }
 
 // UpdateCitiesForView fetches vector tile data for the current view and updates city positions
@@ -455,168 +931,296 @@ func (r *Renderer) UpdateCitiesForView(lat, lon float64, zoom int) {
 	}
 
 	// Convert lat/lon to tile coordinates at a lower zoom for city data
-	// Use zoom 10 for city data (covers larger area)
-	cityZoom := 10
-	if zoom < 10 {
-		cityZoom = zoom
-	}
+	cityZoom := cityZoomFor(zoom)
+	center := tiles.LatLonToTile(lat, lon, cityZoom)
+	tileX, tileY := center.X, center.Y
 
-	// Calculate tile coordinates
-	n := float64(int(1) << cityZoom)
-	tileX := int((lon + 180.0) / 360.0 * n)
-	tileY := int((1.0 - math.Log(math.Tan(lat*math.Pi/180.0)+1.0/math.Cos(lat*math.Pi/180.0))/math.Pi) / 2.0 * n)
+	// Panning within the same block reuses the cities computed for it
+	block := cityBlock{x: tileX, y: tileY, zoom: cityZoom}
+	r.citiesMu.Lock()
+	if data, ok := r.cityBlocks[block]; ok {
+		r.cities = data.cities
+		r.roads = data.roads
+		r.markChanged()
+		r.citiesMu.Unlock()
+		return
+	}
+	r.citiesMu.Unlock()
 
-	// Fetch surrounding tiles
-	cities := make([]CityData, 0, MaxCities)
+	// Fetch surrounding tiles; renderTo culls the cities to the viewport
+	complete := true
+	type candidate struct {
+		city placedCity
+		dist float64
+	}
+	var candidates []candidate
+	var roadLines []vectortile.TransportLine
 
 	for dy := -1; dy <= 1; dy++ {
 		for dx := -1; dx <= 1; dx++ {
-			tx := tileX + dx
-			ty := tileY + dy
-			if tx < 0 || ty < 0 || tx >= int(n) || ty >= int(n) {
+			// Neighbours wrap around the antimeridian but stop at the poles
+			neighbour := tiles.TileCoord{X: tileX + dx, Y: tileY + dy, Zoom: cityZoom}.Wrapped()
+			if !neighbour.Valid() {
 				continue
 			}
+			tx, ty := neighbour.X, neighbour.Y
 
 			data, err := r.vectorTileCache.GetTile(cityZoom, tx, ty)
 			if err != nil {
+				complete = false
 				continue
 			}
+			roadLines = append(roadLines, data.Transport...)
 
 			// Filter for cities and towns
 			for _, place := range data.Places {
-				if place.Class == "city" || place.Class == "town" {
-					// Calculate radius based on rank (lower rank = larger city)
-					radius := float32(1.0)
-					if place.Rank > 0 {
-						radius = float32(15.0 / float64(place.Rank+5))
-					}
-
-					cities = append(cities, CityData{
-						X:      float32(place.Location.Lon()),
-						Y:      float32(place.Location.Lat()),
-						Radius: radius,
-					})
-
-					if len(cities) >= MaxCities {
-						break
-					}
+				if place.Class != "city" && place.Class != "town" {
+					continue
 				}
-			}
-			if len(cities) >= MaxCities {
-				break
+
+				dist := tiles.Haversine(lat, lon, place.Location.Lat(), place.Location.Lon())
+
+				// Calculate radius based on rank (lower rank = larger city)
+				radius := float32(1.0)
+				if place.Rank > 0 {
+					radius = float32(15.0 / float64(place.Rank+5))
+				}
+
+				candidates = append(candidates, candidate{
+					city: placedCity{
+						CityData: CityData{
+							X:      float32(place.Location.Lon()),
+							Y:      float32(place.Location.Lat()),
+							Radius: radius,
+						},
+						rank: place.Rank,
+					},
+					dist: dist,
+				})
 			}
 		}
-		if len(cities) >= MaxCities {
-			break
+	}
+
+	// Most important (lowest rank) first, so trimming to MaxCities drops
+	// villages before capitals; ties go to the nearest
+	sort.Slice(candidates, func(i, j int) bool {
+		ri, rj := rankOrder(candidates[i].city.rank), rankOrder(candidates[j].city.rank)
+		if ri != rj {
+			return ri < rj
 		}
+		return candidates[i].dist < candidates[j].dist
+	})
+
+	cities := make([]placedCity, len(candidates))
+	shaderCities := make([]CityData, len(candidates))
+	for i, c := range candidates {
+		cities[i] = c.city
+		shaderCities[i] = c.city.CityData
 	}
 
+	roads := buildRoadSegments(roadLines, shaderCities)
+
 	r.citiesMu.Lock()
 	r.cities = cities
+	r.roads = roads
+	r.markChanged()
+	// Blocks with missing tiles are recomputed next time
+	if complete {
+		r.cacheCityBlockLocked(block, cityBlockData{cities: cities, roads: roads})
+	}
 	r.citiesMu.Unlock()
 }
 
+// cacheCityBlockLocked remembers a block's cities, forgetting the oldest
+// block beyond MaxCachedCityBlocks
+func (r *Renderer) cacheCityBlockLocked(block cityBlock, data cityBlockData) {
+	if _, ok := r.cityBlocks[block]; !ok {
+		r.cityBlockOrder = append(r.cityBlockOrder, block)
+	}
+	r.cityBlocks[block] = data
+	if len(r.cityBlockOrder) > MaxCachedCityBlocks {
+		delete(r.cityBlocks, r.cityBlockOrder[0])
+		r.cityBlockOrder = r.cityBlockOrder[1:]
+	}
+}
+
+// rankOrder sorts unranked places (rank 0) after ranked ones
+func rankOrder(rank int) int {
+	if rank <= 0 {
+		return math.MaxInt
+	}
+	return rank
+}
+
+// citiesInView returns the cities within the viewport plus CityViewMargin,
+// most important first and at most MaxCities
+func (r *Renderer) citiesInView(cam *camera.Camera) []CityData {
+	minLon, maxLat := cam.ScreenToGeo(0, 0)
+	maxLon, minLat := cam.ScreenToGeo(float64(r.width), float64(r.height))
+	minLon, maxLon = minLon-CityViewMargin, maxLon+CityViewMargin
+	minLat, maxLat = minLat-CityViewMargin, maxLat+CityViewMargin
+
+	r.citiesMu.RLock()
+	defer r.citiesMu.RUnlock()
+
+	var visible []CityData
+	for _, c := range r.cities {
+		if len(visible) == MaxCities {
+			break
+		}
+		lat, lon := float64(c.Y), float64(c.X)
+		if lat < minLat || lat > maxLat {
+			continue
+		}
+		// The view may extend past the antimeridian
+		if (lon < minLon || lon > maxLon) && (lon+360 < minLon || lon+360 > maxLon) && (lon-360 < minLon || lon-360 > maxLon) {
+			continue
+		}
+		visible = append(visible, c.CityData)
+	}
+	return visible
+}
+
+// SetOnChange sets a function called whenever NeedsRedraw becomes true
+// outside Render, e.g. when a tile finishes uploading, to wake an idle
+// render loop. It may run on any goroutine. Call it before rendering starts.
+func (r *Renderer) SetOnChange(fn func()) {
+	r.onChange = fn
+}
+
+// markChanged records that the next frame would differ from the last one
+func (r *Renderer) markChanged() {
+	r.changed.Store(true)
+	if r.onChange != nil {
+		r.onChange()
+	}
+}
+
+// NeedsRedraw reports whether a new frame would differ from the last one
+// because tiles, cities, markers or the route changed, or a fade or easing
+// is still in progress. Camera and config changes are the caller's to track.
+func (r *Renderer) NeedsRedraw() bool {
+	return r.changed.Swap(false) || r.animating
+}
+
 // Render draws the map
 func (r *Renderer) Render(cam *camera.Camera) error {
+	if r.swapChain == nil {
+		return fmt.Errorf("renderer has no window surface; use Capture")
+	}
+
 	view, err := r.swapChain.GetCurrentTextureView()
 	if err != nil {
 		return err
 	}
 	defer view.Release()
 
+	if err := r.renderTo(view, cam); err != nil {
+		return err
+	}
+	r.swapChain.Present()
+
+	return nil
+}
+
+// renderTo draws the map into the given render target and submits the work
+func (r *Renderer) renderTo(view *wgpu.TextureView, cam *camera.Camera) error {
 	encoder, err := r.device.CreateCommandEncoder(&wgpu.CommandEncoderDescriptor{})
 	if err != nil {
 		return err
 	}
 	defer encoder.Release()
 
+	// One consistent copy of the config for the whole frame
+	cfg := config.Snapshot()
+	theme := cfg.Rendering.ActiveTheme()
+
 	pass := encoder.BeginRenderPass(&wgpu.RenderPassDescriptor{
-		ColorAttachments: []wgpu.RenderPassColorAttachment{{
-			View:       view,
-			LoadOp:     wgpu.LoadOp_Clear,
-			StoreOp:    wgpu.StoreOp_Store,
-			ClearValue: wgpu.Color{R: 0.627, G: 0.765, B: 0.812, A: 1.0},
-		}},
+		ColorAttachments: []wgpu.RenderPassColorAttachment{r.colorAttachment(view, theme.Sea)},
 	})
 
 	pass.SetPipeline(r.pipeline)
 
-	// Create vertex buffer for a unit quad (0-1 range)
-	vertices := []Vertex{
-		{Position: [2]float32{0, 0}, TexCoord: [2]float32{0, 0}},
-		{Position: [2]float32{1, 0}, TexCoord: [2]float32{1, 0}},
-		{Position: [2]float32{1, 1}, TexCoord: [2]float32{1, 1}},
-		{Position: [2]float32{0, 1}, TexCoord: [2]float32{0, 1}},
-	}
-	vertexBuffer, _ := r.device.CreateBufferInit(&wgpu.BufferInitDescriptor{
-		Label:    "vertex_buffer",
-		Contents: wgpu.ToBytes(vertices),
-		Usage:    wgpu.BufferUsage_Vertex,
-	})
-	defer vertexBuffer.Release()
-
-	indices := []uint16{0, 1, 2, 0, 2, 3}
-	indexBuffer, _ := r.device.CreateBufferInit(&wgpu.BufferInitDescriptor{
-		Label:    "index_buffer",
-		Contents: wgpu.ToBytes(indices),
-		Usage:    wgpu.BufferUsage_Index,
-	})
-	defer indexBuffer.Release()
-
-	pass.SetVertexBuffer(0, vertexBuffer, 0, wgpu.WholeSize)
-	pass.SetIndexBuffer(indexBuffer, wgpu.IndexFormat_Uint16, 0, wgpu.WholeSize)
+	pass.SetVertexBuffer(0, r.quadVertexBuffer, 0, wgpu.WholeSize)
+	pass.SetIndexBuffer(r.quadIndexBuffer, wgpu.IndexFormat_Uint16, 0, wgpu.WholeSize)
 
 	minX, minY, maxX, maxY := cam.GetTileBounds()
 	w := float32(r.width)
 	h := float32(r.height)
 
 	// Scale: tile size in NDC units
-	scaleX := float32(TileSize) / w * 2
-	scaleY := float32(TileSize) / h * 2
+	tileSize := float32(tiles.TileSize())
+	scaleX := tileSize / w * 2
+	scaleY := tileSize / h * 2
 
-	// Get config for city mask
-	cfg := config.Get()
-	radiusPercent := float32(cfg.Rendering.CityRadiusPercent)
+	// City mask parameters
+	radiusPercent := float32(r.easeMaskRadius(cfg.Rendering.CityRadiusPercent, time.Now()))
+	r.animating = r.maskRadius != cfg.Rendering.CityRadiusPercent
 	enableMask := float32(0.0)
 	if cfg.Features.EnableCityMask {
 		enableMask = 1.0
 	}
+	nightMode := float32(0.0)
+	if cfg.Features.NightMode {
+		nightMode = 1.0
+	}
 
-	// Get city data
+	// Upload the cities around the viewport and the road data into the
+	// persistent buffers
+	cities := r.citiesInView(cam)
+	cityCount := len(cities)
+	if cityCount > 0 {
+		if err := r.writeCities(cities); err != nil {
+			pass.End()
+			return err
+		}
+	}
 	r.citiesMu.RLock()
-	cityCount := len(r.cities)
-	cities := make([]CityData, len(r.cities))
-	copy(cities, r.cities)
+	roadCount := len(r.roads)
+	if roadCount > 0 {
+		r.queue.WriteBuffer(r.roadBuffer, 0, wgpu.ToBytes(r.roads))
+	}
 	r.citiesMu.RUnlock()
 
-	// Create mask params uniform buffer
 	maskParams := CityMaskParams{
 		RadiusPercent: radiusPercent,
 		EnableMask:    enableMask,
 		CityCount:     float32(cityCount),
 		BaseRadius:    0.15, // ~16km at equator
+		Saturation:    float32(math.Max(0, math.Min(1, cfg.Rendering.Saturation))),
+		NightMode:     nightMode,
 	}
-	maskParamsBuffer, _ := r.device.CreateBufferInit(&wgpu.BufferInitDescriptor{
-		Label:    "mask_params_uniform",
-		Contents: wgpu.ToBytes([]CityMaskParams{maskParams}),
-		Usage:    wgpu.BufferUsage_Uniform,
-	})
-	defer maskParamsBuffer.Release()
+	r.queue.WriteBuffer(r.maskParamsBuffer, 0, wgpu.ToBytes([]CityMaskParams{maskParams}))
 
-	// Create city storage buffer (need at least 1 element for valid buffer)
-	if len(cities) == 0 {
-		cities = append(cities, CityData{X: 0, Y: 0, Radius: 0})
+	enableRoads := float32(0.0)
+	if cfg.Features.EnableRoadWeights {
+		enableRoads = 1.0
 	}
-	cityBuffer, _ := r.device.CreateBufferInit(&wgpu.BufferInitDescriptor{
-		Label:    "city_storage",
-		Contents: wgpu.ToBytes(cities),
-		Usage:    wgpu.BufferUsage_Storage,
-	})
-	defer cityBuffer.Release()
+	roadParams := RoadParams{
+		EnableRoads: enableRoads,
+		RoadCount:   float32(roadCount),
+		Influence:   float32(cfg.Rendering.RoadWeightInfluence),
+		Decay:       float32(cfg.Rendering.RoadWeightDecay),
+	}
+	r.queue.WriteBuffer(r.roadParamsBuffer, 0, wgpu.ToBytes([]RoadParams{roadParams}))
+
+	themeParams := ThemeParams{
+		Fog:      [4]float32{float32(theme.Fog[0]), float32(theme.Fog[1]), float32(theme.Fog[2]), 1},
+		LandTint: [4]float32{float32(theme.LandTint[0]), float32(theme.LandTint[1]), float32(theme.LandTint[2]), 1},
+	}
+	r.queue.WriteBuffer(r.themeParamsBuffer, 0, wgpu.ToBytes([]ThemeParams{themeParams}))
+
+	drawn := make(map[string]bool, (maxX-minX+1)*(maxY-minY+1))
+
+	// Collect per-tile instance data and textures
+	instances := make([]TileInfo, 0, (maxX-minX+1)*(maxY-minY+1))
+	textures := make([]*TileTexture, 0, cap(instances))
 
+	now := time.Now()
+	r.texturesMu.RLock()
 	for y := minY; y <= maxY; y++ {
 		for x := minX; x <= maxX; x++ {
-			coord := tiles.TileCoord{X: x, Y: y, Zoom: cam.Zoom}
+			coord := tiles.TileCoord{X: tiles.WrapX(x, cam.Zoom), Y: y, Zoom: cam.Zoom}
 			screenX, screenY := cam.GetTileScreenPosition(x, y)
 
 			// Convert screen position to NDC (-1 to 1)
@@ -626,55 +1230,122 @@ func (r *Renderer) Render(cam *camera.Camera) error {
 			ndcY := 1 - (float32(screenY)/h)*2 // Flip Y
 
 			// Get geographic bounds for this tile
-			minLon, minLat, maxLon, maxLat := tileToGeoBounds(x, y, cam.Zoom)
-
-			tileInfo := TileInfo{
-				OffsetX: ndcX,
-				OffsetY: ndcY - scaleY, // Move down by tile height (since we draw from top-left)
-				ScaleX:  scaleX,
-				ScaleY:  -scaleY, // Negative to flip texture vertically
-				MinLon:  float32(minLon),
-				MinLat:  float32(minLat),
-				MaxLon:  float32(maxLon),
-				MaxLat:  float32(maxLat),
+			minLon, minLat, maxLon, maxLat := tiles.TileGeoBounds(coord)
+
+			info := TileInfo{
+				OffsetX:  ndcX,
+				OffsetY:  ndcY - scaleY, // Move down by tile height (since we draw from top-left)
+				ScaleX:   scaleX,
+				ScaleY:   -scaleY, // Negative to flip texture vertically
+				MinLon:   float32(minLon),
+				MinLat:   float32(minLat),
+				MaxLon:   float32(maxLon),
+				MaxLat:   float32(maxLat),
+				Alpha:    1,
+				UVScaleX: 1,
+				UVScaleY: 1,
 			}
 
-			r.texturesMu.RLock()
 			tex, exists := r.textures[coord.String()]
-			r.texturesMu.RUnlock()
-
-			// Create temp uniform buffer for this draw
-			uniformBuffer, _ := r.device.CreateBufferInit(&wgpu.BufferInitDescriptor{
-				Label:    "tile_uniform",
-				Contents: wgpu.ToBytes([]TileInfo{tileInfo}),
-				Usage:    wgpu.BufferUsage_Uniform,
-			})
-
-			// Create temp bind group with correct uniform
-			tempBindGroup, _ := r.device.CreateBindGroup(&wgpu.BindGroupDescriptor{
-				Label:  "temp_tile_bind_group",
-				Layout: r.bindGroupLayout,
-				Entries: []wgpu.BindGroupEntry{
-					{Binding: 0, Buffer: uniformBuffer, Size: uint64(unsafe.Sizeof(TileInfo{}))},
-					{Binding: 1, Sampler: r.sampler},
-					{Binding: 2, TextureView: func() *wgpu.TextureView {
-						if exists && tex != nil {
-							return tex.View
-						}
-						return r.placeholder.View
-					}()},
-					{Binding: 3, Buffer: maskParamsBuffer, Size: uint64(unsafe.Sizeof(CityMaskParams{}))},
-					{Binding: 4, Buffer: cityBuffer, Size: uint64(len(cities) * int(unsafe.Sizeof(CityData{})))},
-				},
-			})
+			if exists {
+				drawn[coord.String()] = true
+				info.Alpha = tex.fadeAlpha(now)
+				if info.Alpha < 1 {
+					r.animating = true
+				}
+			}
+
+			// Until the tile is fully opaque, stretch the matching part of a
+			// loaded parent tile underneath it
+			if !exists || info.Alpha < 1 {
+				if ancestorTex, ancestor, ok := r.ancestorTextureLocked(coord); ok {
+					drawn[ancestor.String()] = true
+					n := 1 << (coord.Zoom - ancestor.Zoom)
+					fallback := info
+					fallback.Alpha = 1
+					fallback.UVScaleX = 1 / float32(n)
+					fallback.UVScaleY = fallback.UVScaleX
+					fallback.UVOffsetX = float32(coord.X%n) * fallback.UVScaleX
+					fallback.UVOffsetY = float32(coord.Y%n) * fallback.UVScaleY
+					instances = append(instances, fallback)
+					textures = append(textures, ancestorTex)
+				} else if !exists {
+					instances = append(instances, info)
+					textures = append(textures, r.placeholder)
+				}
+			}
+
+			if exists {
+				instances = append(instances, info)
+				textures = append(textures, tex)
+			}
+		}
+	}
+	r.texturesMu.RUnlock()
+
+	if len(instances) > 0 {
+		if err := r.writeInstances(instances); err != nil {
+			pass.End()
+			return err
+		}
+
+		pass.SetBindGroup(0, r.frameBindGroup, nil)
+		pass.SetVertexBuffer(1, r.instanceBuffer, 0, wgpu.WholeSize)
+
+		// One instanced draw per run of tiles sharing a texture (e.g. placeholders)
+		for first := 0; first < len(textures); {
+			last := first + 1
+			for last < len(textures) && textures[last] == textures[first] {
+				last++
+			}
+			pass.SetBindGroup(1, textures[first].BindGroup, nil)
+			pass.DrawIndexed(6, uint32(last-first), 0, 0, uint32(first))
+			first = last
+		}
+	}
+
+	if cfg.Features.EnableWaterFill {
+		for _, buffer := range r.drawWater(pass, cam, theme.Sea) {
+			defer buffer.Release()
+		}
+	}
 
-			pass.SetBindGroup(0, tempBindGroup, nil)
-			pass.DrawIndexed(6, 1, 0, 0, 0)
+	if cfg.Features.EnableVectorOverlay {
+		if overlayBuffer := r.drawOverlay(pass, cam); overlayBuffer != nil {
+			defer overlayBuffer.Release()
+		}
+	}
+
+	if cfg.Features.EnableLabels {
+		if labelBuffer := r.drawLabels(pass, cam); labelBuffer != nil {
+			defer labelBuffer.Release()
+		}
+	}
+
+	if routeBuffer := r.drawRoute(pass, cam); routeBuffer != nil {
+		defer routeBuffer.Release()
+	}
+
+	if markerBuffer := r.drawMarkers(pass, cam); markerBuffer != nil {
+		defer markerBuffer.Release()
+	}
+
+	if cfg.Features.ShowTileGrid {
+		for _, buffer := range r.drawTileGrid(pass, cam) {
+			defer buffer.Release()
 		}
 	}
 
 	pass.End()
 
+	// Bump recency of drawn tiles and protect them from eviction
+	r.texturesMu.Lock()
+	for key := range drawn {
+		r.touchTextureLocked(key)
+	}
+	r.visible = drawn
+	r.texturesMu.Unlock()
+
 	cmdBuffer, err := encoder.Finish(&wgpu.CommandBufferDescriptor{})
 	if err != nil {
 		return err
@@ -682,11 +1353,28 @@ func (r *Renderer) Render(cam *camera.Camera) error {
 	defer cmdBuffer.Release()
 
 	r.queue.Submit(cmdBuffer)
-	r.swapChain.Present()
 
 	return nil
 }
 
+// easeMaskRadius moves the mask radius toward target and returns it. The
+// first frame starts at the target; afterwards the gap shrinks exponentially
+// so it is ~95% closed after CityRadiusEaseTime.
+func (r *Renderer) easeMaskRadius(target float64, now time.Time) float64 {
+	if r.maskRadiusFrame.IsZero() {
+		r.maskRadius = target
+	} else {
+		dt := now.Sub(r.maskRadiusFrame).Seconds()
+		k := 1 - math.Exp(-3*dt/CityRadiusEaseTime.Seconds())
+		r.maskRadius += (target - r.maskRadius) * k
+		if math.Abs(target-r.maskRadius) < 0.01 {
+			r.maskRadius = target
+		}
+	}
+	r.maskRadiusFrame = now
+	return r.maskRadius
+}
+
 // Resize handles window resize
 func (r *Renderer) Resize(width, height uint32) {
 	if width == 0 || height == 0 {
@@ -694,6 +1382,15 @@ func (r *Renderer) Resize(width, height uint32) {
 	}
 	r.width = width
 	r.height = height
+	r.markChanged()
+
+	if err := r.createMSAATarget(); err != nil {
+		logging.Errorf("failed to recreate MSAA target: %v", err)
+	}
+
+	if r.surface == nil {
+		return
+	}
 
 	if r.swapChain != nil {
 		r.swapChain.Release()
@@ -708,26 +1405,53 @@ func (r *Renderer) Resize(width, height uint32) {
 		PresentMode: wgpu.PresentMode_Fifo,
 	})
 	if err != nil {
-		fmt.Printf("Failed to recreate swap chain: %v\n", err)
+		logging.Errorf("failed to recreate swap chain: %v", err)
 	}
 }
 
-// Release frees all GPU resources
-func (r *Renderer) Release() {
+// ReleaseTextures frees every uploaded tile texture, so tiles are uploaded
+// again as they are requested. Call it from the thread that renders.
+func (r *Renderer) ReleaseTextures() {
 	r.texturesMu.Lock()
+	defer r.texturesMu.Unlock()
+
 	for _, tex := range r.textures {
-		tex.View.Release()
-		tex.Texture.Release()
+		tex.Release()
 	}
-	r.texturesMu.Unlock()
+	r.textures = make(map[string]*TileTexture)
+	r.textureLRU.Init()
+	r.textureElems = make(map[string]*list.Element)
+	r.markChanged()
+}
+
+// ResetVectorTiles forgets which vector tiles were requested, so tiles
+// dropped from the vector tile cache are fetched again
+func (r *Renderer) ResetVectorTiles() {
+	r.overlayMu.Lock()
+	r.overlayRequested = make(map[string]bool)
+	r.overlayMu.Unlock()
+}
+
+// Release frees all GPU resources
+func (r *Renderer) Release() {
+	r.ReleaseTextures()
 
 	if r.placeholder != nil {
-		r.placeholder.View.Release()
-		r.placeholder.Texture.Release()
+		r.placeholder.Release()
 	}
 
+	r.releaseFrameResources()
+	r.releaseMSAATarget()
 	r.bindGroupLayout.Release()
+	r.textureBindGroupLayout.Release()
 	r.pipeline.Release()
+	if r.linePipeline != nil {
+		r.linePipeline.Release()
+	}
+	if r.fillPipeline != nil {
+		r.fillPipeline.Release()
+	}
+	r.releaseLabels()
 	r.sampler.Release()
 	if r.swapChain != nil {
 		r.swapChain.Release()
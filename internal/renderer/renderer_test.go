@@ -0,0 +1,164 @@
+package renderer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/rajveermalviya/go-webgpu/wgpu"
+
+	"mapviewer/internal/camera"
+	"mapviewer/pkg/tiles"
+)
+
+// newTestRenderer creates a headless renderer on the platform backend, or
+// on GL (e.g. Mesa's llvmpipe) when that has no adapter. It skips when the
+// machine has no usable adapter at all.
+func newTestRenderer(tb testing.TB, width, height uint32) *Renderer {
+	tb.Helper()
+	for _, backend := range []wgpu.InstanceBackend{defaultBackend, wgpu.InstanceBackend_GL} {
+		instance := wgpu.CreateInstance(&wgpu.InstanceDescriptor{Backends: backend})
+		adapter, err := instance.RequestAdapter(&wgpu.RequestAdapterOptions{
+			PowerPreference: wgpu.PowerPreference_HighPerformance,
+		})
+		if err != nil {
+			instance.Release()
+			continue
+		}
+		device, err := adapter.RequestDevice(&wgpu.DeviceDescriptor{Label: "RendererTestDevice"})
+		if err != nil {
+			adapter.Release()
+			instance.Release()
+			continue
+		}
+		queue := device.GetQueue()
+
+		r, err := NewRenderer(adapter, device, queue, nil, width, height, nil, 0, 1)
+		if err != nil {
+			tb.Fatalf("renderer on %s: %v", BackendName(backend), err)
+		}
+		tb.Cleanup(func() {
+			r.Release()
+			queue.Release()
+			device.Release()
+			adapter.Release()
+			instance.Release()
+		})
+		return r
+	}
+	tb.Skip("no WebGPU adapter available")
+	return nil
+}
+
+// offscreenView creates a render target the size of the renderer's viewport
+func offscreenView(tb testing.TB, r *Renderer) *wgpu.TextureView {
+	tb.Helper()
+	texture, err := r.device.CreateTexture(&wgpu.TextureDescriptor{
+		Label:         "test_target",
+		Size:          wgpu.Extent3D{Width: r.width, Height: r.height, DepthOrArrayLayers: 1},
+		MipLevelCount: 1,
+		SampleCount:   1,
+		Dimension:     wgpu.TextureDimension_2D,
+		Format:        r.swapChainFormat,
+		Usage:         wgpu.TextureUsage_RenderAttachment,
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	view, err := texture.CreateView(nil)
+	if err != nil {
+		texture.Release()
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() {
+		view.Release()
+		texture.Release()
+	})
+	return view
+}
+
+// uploadVisibleTiles gives every tile in view a texture and returns how
+// many there are
+func uploadVisibleTiles(tb testing.TB, r *Renderer, cam *camera.Camera) int {
+	tb.Helper()
+	size := tiles.TileSize()
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for i := range img.Pix {
+		img.Pix[i] = 200
+	}
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		tb.Fatal(err)
+	}
+
+	n := 0
+	minX, minY, maxX, maxY := cam.GetTileBounds()
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			coord := tiles.TileCoord{X: x, Y: y, Zoom: cam.Zoom}
+			if err := r.UploadTile(coord, buf.Bytes()); err != nil {
+				tb.Fatal(err)
+			}
+			n++
+		}
+	}
+	return n
+}
+
+// BenchmarkRender draws every tile of a full HD view per frame and waits
+// for the GPU to finish it. allocs/op tracks the per-frame buffers and bind
+// groups that instancing and persistent frame resources removed.
+func BenchmarkRender(b *testing.B) {
+	const width, height = 1920, 1080
+	r := newTestRenderer(b, width, height)
+	cam := camera.NewCamera(camera.DefaultLat, camera.DefaultLon, camera.DefaultZoom, width, height)
+	n := uploadVisibleTiles(b, r, cam)
+	view := offscreenView(b, r)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := r.renderTo(view, cam); err != nil {
+			b.Fatal(err)
+		}
+		r.device.Poll(true, nil)
+	}
+	b.ReportMetric(float64(n), "tiles/frame")
+}
+
+// Once the first frame has sized them, later frames of the same view reuse
+// the quad, uniform, storage and instance buffers and the frame bind group
+func TestRenderReusesFrameResources(t *testing.T) {
+	const width, height = 640, 480
+	r := newTestRenderer(t, width, height)
+	cam := camera.NewCamera(camera.DefaultLat, camera.DefaultLon, camera.DefaultZoom, width, height)
+	uploadVisibleTiles(t, r, cam)
+	view := offscreenView(t, r)
+
+	resources := func() []any {
+		return []any{
+			r.quadVertexBuffer, r.quadIndexBuffer,
+			r.maskParamsBuffer, r.cityBuffer, r.roadParamsBuffer, r.roadBuffer, r.themeParamsBuffer,
+			r.instanceBuffer, r.frameBindGroup,
+		}
+	}
+
+	if err := r.renderTo(view, cam); err != nil {
+		t.Fatal(err)
+	}
+	first := resources()
+	for frame := 0; frame < 3; frame++ {
+		if err := r.renderTo(view, cam); err != nil {
+			t.Fatal(err)
+		}
+		r.device.Poll(true, nil)
+	}
+	for i, res := range resources() {
+		if res != first[i] {
+			t.Errorf("frame resource %d was recreated", i)
+		}
+	}
+}
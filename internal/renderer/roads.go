@@ -0,0 +1,73 @@
+package renderer
+
+import (
+	"math"
+	"sort"
+
+	"github.com/paulmach/orb"
+
+	"mapviewer/internal/vectortile"
+)
+
+// geoDistanceDeg mirrors the shader's geoDistance: an approximate distance
+// in degrees with longitude scaled by the cosine of the mean latitude
+func geoDistanceDeg(lon1, lat1, lon2, lat2 float64) float64 {
+	latScale := math.Cos((lat1 + lat2) * 0.5 * math.Pi / 180.0)
+	dx := (lon2 - lon1) * latScale
+	dy := lat2 - lat1
+	return math.Sqrt(dx*dx + dy*dy)
+}
+
+// buildRoadSegments splits major roads into segments for the mask shader and
+// tags each with its adjusted distance to the nearest city. Segments closest
+// to cities are kept first, up to MaxRoadSegments.
+func buildRoadSegments(lines []vectortile.TransportLine, cities []CityData) []RoadSegment {
+	if len(cities) == 0 {
+		return nil
+	}
+
+	var segments []RoadSegment
+	addLine := func(ls orb.LineString) {
+		for i := 0; i+1 < len(ls); i++ {
+			a, b := ls[i], ls[i+1]
+			midLon := (a.Lon() + b.Lon()) / 2
+			midLat := (a.Lat() + b.Lat()) / 2
+
+			cityDist := math.MaxFloat64
+			for _, c := range cities {
+				d := geoDistanceDeg(midLon, midLat, float64(c.X), float64(c.Y)) / math.Max(float64(c.Radius), 0.1)
+				cityDist = math.Min(cityDist, d)
+			}
+
+			segments = append(segments, RoadSegment{
+				X0:       float32(a.Lon()),
+				Y0:       float32(a.Lat()),
+				X1:       float32(b.Lon()),
+				Y1:       float32(b.Lat()),
+				CityDist: float32(cityDist),
+			})
+		}
+	}
+
+	for _, line := range lines {
+		if !roadWeightClasses[line.Class] {
+			continue
+		}
+		switch g := line.Geometry.(type) {
+		case orb.LineString:
+			addLine(g)
+		case orb.MultiLineString:
+			for _, ls := range g {
+				addLine(ls)
+			}
+		}
+	}
+
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].CityDist < segments[j].CityDist
+	})
+	if len(segments) > MaxRoadSegments {
+		segments = segments[:MaxRoadSegments]
+	}
+	return segments
+}
@@ -0,0 +1,68 @@
+package renderer
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/rajveermalviya/go-webgpu/wgpu"
+
+	"mapviewer/internal/camera"
+)
+
+// RouteWidth is the width in pixels of the route polyline
+const RouteWidth = 3
+
+// SetRoute replaces the polyline drawn over the map, e.g. a GPS track.
+// Points are lon/lat; fewer than two clears the route. Consecutive points
+// are joined the short way across the antimeridian. It is safe to call from
+// any goroutine.
+func (r *Renderer) SetRoute(points []orb.Point, color [4]float32) {
+	var route orb.LineString
+	if len(points) >= 2 {
+		route = make(orb.LineString, len(points))
+		copy(route, points)
+		for i := 1; i < len(route); i++ {
+			for route[i][0]-route[i-1][0] > 180 {
+				route[i][0] -= 360
+			}
+			for route[i][0]-route[i-1][0] < -180 {
+				route[i][0] += 360
+			}
+		}
+	}
+
+	r.routeMu.Lock()
+	r.route = route
+	r.routeColor = color
+	r.routeMu.Unlock()
+	r.markChanged()
+}
+
+// drawRoute records the route into the pass. The returned buffer (if any)
+// must be released after the command buffer is submitted.
+func (r *Renderer) drawRoute(pass *wgpu.RenderPassEncoder, cam *camera.Camera) *wgpu.Buffer {
+	r.routeMu.RLock()
+	route, color := r.route, r.routeColor
+	r.routeMu.RUnlock()
+	if len(route) < 2 {
+		return nil
+	}
+
+	b := r.newLineBuilder(cam)
+	b.addLine(route, color, RouteWidth)
+	if len(b.vertices) == 0 {
+		return nil
+	}
+
+	buffer, err := r.device.CreateBufferInit(&wgpu.BufferInitDescriptor{
+		Label:    "route_vertex_buffer",
+		Contents: wgpu.ToBytes(b.vertices),
+		Usage:    wgpu.BufferUsage_Vertex,
+	})
+	if err != nil {
+		return nil
+	}
+
+	pass.SetPipeline(r.linePipeline)
+	pass.SetVertexBuffer(0, buffer, 0, wgpu.WholeSize)
+	pass.Draw(uint32(len(b.vertices)), 1, 0, 0)
+	return buffer
+}
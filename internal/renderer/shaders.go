@@ -33,3 +33,62 @@ fn fs_main(in: VertexOutput) -> @location(0) vec4<f32> {
     return textureSample(tileTexture, tileSampler, in.texCoord);
 }
 `
+
+// LineShader draws pre-projected, per-vertex colored lines for vector overlays
+const LineShader = `
+struct VertexInput {
+    @location(0) position: vec2<f32>,
+    @location(1) color: vec4<f32>,
+}
+
+struct VertexOutput {
+    @builtin(position) position: vec4<f32>,
+    @location(0) color: vec4<f32>,
+}
+
+@vertex
+fn vs_main(in: VertexInput) -> VertexOutput {
+    var out: VertexOutput;
+    out.position = vec4<f32>(in.position, 0.0, 1.0);
+    out.color = in.color;
+    return out;
+}
+
+@fragment
+fn fs_main(in: VertexOutput) -> @location(0) vec4<f32> {
+    return in.color;
+}
+`
+
+// TextShader draws glyph quads sampled from the label font atlas
+const TextShader = `
+@group(0) @binding(0) var atlasSampler: sampler;
+@group(0) @binding(1) var atlasTexture: texture_2d<f32>;
+
+struct VertexInput {
+    @location(0) position: vec2<f32>,
+    @location(1) texCoord: vec2<f32>,
+    @location(2) color: vec4<f32>,
+}
+
+struct VertexOutput {
+    @builtin(position) position: vec4<f32>,
+    @location(0) texCoord: vec2<f32>,
+    @location(1) color: vec4<f32>,
+}
+
+@vertex
+fn vs_main(in: VertexInput) -> VertexOutput {
+    var out: VertexOutput;
+    out.position = vec4<f32>(in.position, 0.0, 1.0);
+    out.texCoord = in.texCoord;
+    out.color = in.color;
+    return out;
+}
+
+@fragment
+fn fs_main(in: VertexOutput) -> @location(0) vec4<f32> {
+    let coverage = textureSample(atlasTexture, atlasSampler, in.texCoord).a;
+    return vec4<f32>(in.color.rgb, in.color.a * coverage);
+}
+`
@@ -0,0 +1,88 @@
+package renderer
+
+import (
+	"fmt"
+
+	"github.com/rajveermalviya/go-webgpu/wgpu"
+
+	"mapviewer/internal/camera"
+	"mapviewer/pkg/tiles"
+)
+
+// gridColor is used for the debug tile grid's borders and labels
+var gridColor = [4]float32{0.9, 0.1, 0.1, 0.9}
+
+// buildTileGridVertices outlines every tile the frame draws and labels it
+// with its z/x/y, placed exactly like the tiles (GetTileScreenPosition)
+func (r *Renderer) buildTileGridVertices(cam *camera.Camera) ([]LineVertex, []TextVertex) {
+	size := float64(tiles.TileSize())
+	b := r.newLineBuilder(cam)
+	w, h := float32(r.width), float32(r.height)
+
+	var lines []LineVertex
+	var text []TextVertex
+	minX, minY, maxX, maxY := cam.GetTileBounds()
+	for y := minY; y <= maxY; y++ {
+		for x := minX; x <= maxX; x++ {
+			sx, sy := cam.GetTileScreenPosition(x, y)
+			if sx+size < 0 || sy+size < 0 || sx > b.w || sy > b.h {
+				continue
+			}
+
+			// Top and left edges; the neighbours draw the other two
+			corner := b.ndc(sx, sy)
+			lines = append(lines,
+				LineVertex{Position: corner, Color: gridColor},
+				LineVertex{Position: b.ndc(sx+size, sy), Color: gridColor},
+				LineVertex{Position: corner, Color: gridColor},
+				LineVertex{Position: b.ndc(sx, sy+size), Color: gridColor},
+			)
+
+			coord := tiles.TileCoord{X: tiles.WrapX(x, cam.Zoom), Y: y, Zoom: cam.Zoom}
+			label := fmt.Sprintf("%d/%d/%d", coord.Zoom, coord.X, coord.Y)
+			left, top := int(sx)+4, int(sy)+4
+			for _, off := range [][2]int{{-1, 0}, {1, 0}, {0, -1}, {0, 1}} {
+				text = r.appendText(text, label, left+off[0], top+off[1], 1, haloColor, w, h)
+			}
+			text = r.appendText(text, label, left, top, 1, gridColor, w, h)
+		}
+	}
+	return lines, text
+}
+
+// drawTileGrid records the debug tile grid into the pass. The returned
+// buffers must be released after the command buffer is submitted.
+func (r *Renderer) drawTileGrid(pass *wgpu.RenderPassEncoder, cam *camera.Camera) []*wgpu.Buffer {
+	lines, text := r.buildTileGridVertices(cam)
+	var buffers []*wgpu.Buffer
+
+	if len(lines) > 0 {
+		buffer, err := r.device.CreateBufferInit(&wgpu.BufferInitDescriptor{
+			Label:    "tile_grid_line_buffer",
+			Contents: wgpu.ToBytes(lines),
+			Usage:    wgpu.BufferUsage_Vertex,
+		})
+		if err == nil {
+			pass.SetPipeline(r.linePipeline)
+			pass.SetVertexBuffer(0, buffer, 0, wgpu.WholeSize)
+			pass.Draw(uint32(len(lines)), 1, 0, 0)
+			buffers = append(buffers, buffer)
+		}
+	}
+
+	if len(text) > 0 {
+		buffer, err := r.device.CreateBufferInit(&wgpu.BufferInitDescriptor{
+			Label:    "tile_grid_text_buffer",
+			Contents: wgpu.ToBytes(text),
+			Usage:    wgpu.BufferUsage_Vertex,
+		})
+		if err == nil {
+			pass.SetPipeline(r.textPipeline)
+			pass.SetBindGroup(0, r.labelBindGroup, nil)
+			pass.SetVertexBuffer(0, buffer, 0, wgpu.WholeSize)
+			pass.Draw(uint32(len(text)), 1, 0, 0)
+			buffers = append(buffers, buffer)
+		}
+	}
+	return buffers
+}
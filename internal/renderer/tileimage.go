@@ -0,0 +1,26 @@
+package renderer
+
+import (
+	"image"
+
+	xdraw "golang.org/x/image/draw"
+
+	"mapviewer/pkg/tiles"
+)
+
+// normalizeTile converts a decoded tile of any color model (paletted,
+// 16-bit, grayscale, ...) into a freshly allocated RGBA image at the origin
+// with a tight stride, as WriteTexture expects. Tiles that aren't the
+// configured tile size are resampled to it.
+func normalizeTile(img image.Image) *image.RGBA {
+	size := tiles.TileSize()
+	src := img.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+
+	if src.Dx() == size && src.Dy() == size {
+		xdraw.Draw(dst, dst.Bounds(), img, src.Min, xdraw.Src)
+	} else {
+		xdraw.BiLinear.Scale(dst, dst.Bounds(), img, src, xdraw.Src, nil)
+	}
+	return dst
+}
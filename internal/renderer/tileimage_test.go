@@ -0,0 +1,135 @@
+package renderer
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"mapviewer/pkg/tiles"
+)
+
+var (
+	red  = color.RGBA{R: 255, A: 255}
+	blue = color.RGBA{B: 255, A: 255}
+)
+
+// halves fills the top half of img with top and the bottom half with bottom
+func halves(img interface {
+	image.Image
+	Set(x, y int, c color.Color)
+}, top, bottom color.Color) {
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := top
+			if y >= b.Min.Y+b.Dy()/2 {
+				c = bottom
+			}
+			img.Set(x, y, c)
+		}
+	}
+}
+
+// pngRoundTrip encodes and decodes img the way tiles arrive from upstream
+func pngRoundTrip(t *testing.T, img image.Image) image.Image {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := png.Decode(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decoded
+}
+
+func TestNormalizeTile(t *testing.T) {
+	size := tiles.TileSize()
+	palette := color.Palette{red, blue}
+
+	tests := []struct {
+		name string
+		img  func() image.Image
+	}{
+		{"rgba", func() image.Image {
+			img := image.NewRGBA(image.Rect(0, 0, size, size))
+			halves(img, red, blue)
+			return img
+		}},
+		{"paletted png", func() image.Image {
+			img := image.NewPaletted(image.Rect(0, 0, size, size), palette)
+			halves(img, red, blue)
+			decoded := pngRoundTrip(t, img)
+			if _, ok := decoded.(*image.Paletted); !ok {
+				t.Fatalf("decoded %T, want a paletted image", decoded)
+			}
+			return decoded
+		}},
+		{"16-bit png", func() image.Image {
+			img := image.NewNRGBA64(image.Rect(0, 0, size, size))
+			halves(img, red, blue)
+			return pngRoundTrip(t, img)
+		}},
+		{"sub-image off the origin", func() image.Image {
+			img := image.NewRGBA(image.Rect(0, 0, 2*size, 2*size))
+			sub := img.SubImage(image.Rect(size/2, size/2, size/2+size, size/2+size)).(*image.RGBA)
+			halves(sub, red, blue)
+			return sub
+		}},
+		{"non-square", func() image.Image {
+			img := image.NewRGBA(image.Rect(0, 0, size, size/2))
+			halves(img, red, blue)
+			return img
+		}},
+		{"non-square paletted", func() image.Image {
+			img := image.NewPaletted(image.Rect(0, 0, size/2, 3*size/2), palette)
+			halves(img, red, blue)
+			return img
+		}},
+		{"too large", func() image.Image {
+			img := image.NewRGBA(image.Rect(0, 0, 2*size, 2*size))
+			halves(img, red, blue)
+			return img
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := normalizeTile(tt.img())
+
+			if got.Bounds() != image.Rect(0, 0, size, size) {
+				t.Fatalf("bounds %v, want %dx%d at the origin", got.Bounds(), size, size)
+			}
+			if got.Stride != 4*size || len(got.Pix) != 4*size*size {
+				t.Errorf("stride %d with %d bytes, want a tight %d", got.Stride, len(got.Pix), 4*size)
+			}
+			// Away from the seam, where resampling blends the halves
+			for _, p := range []struct {
+				x, y int
+				want color.RGBA
+			}{
+				{0, 0, red},
+				{size - 1, size/2 - 8, red},
+				{size / 2, size/2 + 8, blue},
+				{size - 1, size - 1, blue},
+			} {
+				if c := got.RGBAAt(p.x, p.y); c != p.want {
+					t.Errorf("pixel %d,%d = %v, want %v", p.x, p.y, c, p.want)
+				}
+			}
+		})
+	}
+}
+
+// A tile that is already tight RGBA is copied, not reused
+func TestNormalizeTileCopies(t *testing.T) {
+	size := tiles.TileSize()
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	got := normalizeTile(img)
+	img.Pix[0] = 200
+	if got.Pix[0] == 200 {
+		t.Error("normalized tile shares pixels with the decoded image")
+	}
+}
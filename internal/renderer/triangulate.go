@@ -0,0 +1,258 @@
+package renderer
+
+import (
+	"math"
+	"slices"
+	"sort"
+
+	"github.com/paulmach/orb"
+
+	"mapviewer/internal/logging"
+)
+
+// Triangulate splits a polygon (outer ring plus holes, in either winding)
+// into triangles for an indexed draw. The vertices are the polygon's ring
+// points with Position in lon/lat, and every three indices form a
+// counter-clockwise triangle. Polygons with more points than a uint16
+// index can address are logged and return nil.
+func Triangulate(poly orb.Polygon) ([]Vertex, []uint16) {
+	// Check before clipping, which is slow on polygons this large
+	if n := polygonPoints(poly); n > math.MaxUint16+1 {
+		logging.Warnf("skipping polygon with %d points, more than uint16 indices can address", n)
+		return nil, nil
+	}
+
+	points, indices := triangulateIndexed(poly)
+	if len(indices) == 0 {
+		return nil, nil
+	}
+
+	vertices := make([]Vertex, len(points))
+	for i, p := range points {
+		vertices[i] = Vertex{Position: [2]float32{float32(p[0]), float32(p[1])}}
+	}
+	out := make([]uint16, len(indices))
+	for i, idx := range indices {
+		out[i] = uint16(idx)
+	}
+	return vertices, out
+}
+
+// polygonPoints counts the points of poly's rings, not counting closing points
+func polygonPoints(poly orb.Polygon) int {
+	n := 0
+	for _, r := range poly {
+		n += len(r)
+		if len(r) > 1 && r[0] == r[len(r)-1] {
+			n--
+		}
+	}
+	return n
+}
+
+// triangulateIndexed triangulates poly by ear clipping. Holes are first
+// joined to the outer ring through bridge edges so there is a single ring
+// to clip. It returns the ring points and three indices into them per
+// triangle; self-intersecting input yields as many triangles as could be
+// clipped.
+func triangulateIndexed(poly orb.Polygon) ([]orb.Point, []int) {
+	if len(poly) == 0 {
+		return nil, nil
+	}
+
+	var points []orb.Point
+	addRing := func(r orb.Ring, ccw bool) []int {
+		pts := openRing(r, ccw)
+		ring := make([]int, len(pts))
+		for i := range pts {
+			ring[i] = len(points) + i
+		}
+		points = append(points, pts...)
+		return ring
+	}
+
+	ring := addRing(poly[0], true)
+	if len(ring) < 3 {
+		return nil, nil
+	}
+	holes := make([][]int, 0, len(poly)-1)
+	for _, r := range poly[1:] {
+		if h := addRing(r, false); len(h) >= 3 {
+			holes = append(holes, h)
+		}
+	}
+
+	// Bridge the rightmost holes first so later bridges can't cross them
+	maxX := func(h []int) float64 { return points[h[rightmost(points, h)]][0] }
+	sort.Slice(holes, func(i, j int) bool { return maxX(holes[i]) > maxX(holes[j]) })
+	for i, h := range holes {
+		ring = bridgeHole(points, ring, h, holes[i+1:])
+	}
+
+	return points, earClip(points, ring)
+}
+
+// openRing copies a ring without its closing point, oriented
+// counter-clockwise (ccw) or clockwise
+func openRing(r orb.Ring, ccw bool) []orb.Point {
+	pts := slices.Clone([]orb.Point(r))
+	if n := len(pts); n > 1 && pts[0] == pts[n-1] {
+		pts = pts[:n-1]
+	}
+	if (signedArea(pts) > 0) != ccw {
+		slices.Reverse(pts)
+	}
+	return pts
+}
+
+// signedArea is positive for counter-clockwise rings
+func signedArea(pts []orb.Point) float64 {
+	area := 0.0
+	for i, p := range pts {
+		q := pts[(i+1)%len(pts)]
+		area += p[0]*q[1] - q[0]*p[1]
+	}
+	return area / 2
+}
+
+// cross is positive when a, b, c turn counter-clockwise
+func cross(a, b, c orb.Point) float64 {
+	return (b[0]-a[0])*(c[1]-a[1]) - (b[1]-a[1])*(c[0]-a[0])
+}
+
+// rightmost returns the position in ring of the point with the largest X
+func rightmost(points []orb.Point, ring []int) int {
+	best := 0
+	for i, idx := range ring {
+		if points[idx][0] > points[ring[best]][0] {
+			best = i
+		}
+	}
+	return best
+}
+
+// bridgeHole splices a (clockwise) hole into the (counter-clockwise) ring
+// through an edge from the hole's rightmost point to the nearest ring point
+// it can see. Holes with no visible ring point are dropped.
+func bridgeHole(points []orb.Point, ring, hole []int, otherHoles [][]int) []int {
+	m := rightmost(points, hole)
+	mp := points[hole[m]]
+
+	// Candidates are ring positions, nearest first. A point an earlier
+	// bridge touched appears twice; inWedge picks the side facing the hole.
+	candidates := make([]int, len(ring))
+	for i := range candidates {
+		candidates[i] = i
+	}
+	dist := func(at int) float64 {
+		dx, dy := points[ring[at]][0]-mp[0], points[ring[at]][1]-mp[1]
+		return dx*dx + dy*dy
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return dist(candidates[i]) < dist(candidates[j]) })
+
+	n := len(ring)
+	for _, at := range candidates {
+		vp := points[ring[at]]
+		if !inWedge(points[ring[(at+n-1)%n]], vp, points[ring[(at+1)%n]], mp) {
+			continue
+		}
+		if crossesAny(points, mp, vp, ring) || crossesAny(points, mp, vp, hole) {
+			continue
+		}
+		blocked := false
+		for _, h := range otherHoles {
+			if crossesAny(points, mp, vp, h) {
+				blocked = true
+				break
+			}
+		}
+		if blocked {
+			continue
+		}
+
+		// ... v, m, rest of the hole, m, v, ...
+		out := make([]int, 0, len(ring)+len(hole)+2)
+		out = append(out, ring[:at+1]...)
+		out = append(out, hole[m:]...)
+		out = append(out, hole[:m+1]...)
+		out = append(out, ring[at:]...)
+		return out
+	}
+	return ring
+}
+
+// inWedge reports whether direction v->m points into the ring's interior
+// at corner prev, v, next of a counter-clockwise ring
+func inWedge(prev, v, next, m orb.Point) bool {
+	if cross(prev, v, next) >= 0 {
+		return cross(prev, v, m) >= 0 && cross(v, next, m) >= 0
+	}
+	return cross(prev, v, m) >= 0 || cross(v, next, m) >= 0
+}
+
+// crossesAny reports whether segment ab properly crosses an edge of ring.
+// Edges sharing an endpoint with ab don't count.
+func crossesAny(points []orb.Point, a, b orb.Point, ring []int) bool {
+	for i, idx := range ring {
+		c, d := points[idx], points[ring[(i+1)%len(ring)]]
+		if c == a || c == b || d == a || d == b {
+			continue
+		}
+		if cross(c, d, a)*cross(c, d, b) < 0 && cross(a, b, c)*cross(a, b, d) < 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// earClip triangulates a simple counter-clockwise ring, returning three
+// point indices per triangle
+func earClip(points []orb.Point, ring []int) []int {
+	if len(ring) < 3 {
+		return nil
+	}
+	ring = slices.Clone(ring)
+	out := make([]int, 0, 3*(len(ring)-2))
+
+	i, stalled := 0, 0
+	for len(ring) > 3 && stalled < len(ring) {
+		n := len(ring)
+		i %= n
+		ia, ib, ic := ring[(i+n-1)%n], ring[i], ring[(i+1)%n]
+		a, b, c := points[ia], points[ib], points[ic]
+
+		switch turn := cross(a, b, c); {
+		case turn == 0:
+			// Collinear or a bridge's zero-width spike: drop b, no triangle
+			ring = slices.Delete(ring, i, i+1)
+			stalled = 0
+		case turn > 0 && !anyInTriangle(points, ring, a, b, c):
+			out = append(out, ia, ib, ic)
+			ring = slices.Delete(ring, i, i+1)
+			stalled = 0
+		default:
+			i++
+			stalled++
+		}
+	}
+
+	if len(ring) == 3 && cross(points[ring[0]], points[ring[1]], points[ring[2]]) > 0 {
+		out = append(out, ring...)
+	}
+	return out
+}
+
+// anyInTriangle reports whether a remaining ring point other than the
+// corners lies in (or on) triangle abc
+func anyInTriangle(points []orb.Point, ring []int, a, b, c orb.Point) bool {
+	for _, idx := range ring {
+		p := points[idx]
+		if p == a || p == b || p == c {
+			continue
+		}
+		if cross(a, b, p) >= 0 && cross(b, c, p) >= 0 && cross(c, a, p) >= 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package renderer
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/paulmach/orb"
+)
+
+// ringArea is the absolute area enclosed by r
+func ringArea(r orb.Ring) float64 {
+	return math.Abs(signedArea([]orb.Point(r)))
+}
+
+// reversed returns r in the opposite winding
+func reversed(r orb.Ring) orb.Ring {
+	out := slices.Clone(r)
+	slices.Reverse(out)
+	return out
+}
+
+func TestTriangulate(t *testing.T) {
+	square := orb.Ring{{0, 0}, {4, 0}, {4, 4}, {0, 4}, {0, 0}}
+	// An arrow pointing right with its notch at (1, 2)
+	concave := orb.Ring{{0, 0}, {4, 2}, {0, 4}, {1, 2}, {0, 0}}
+	// A U shape: two reflex corners at the bottom of the notch
+	u := orb.Ring{{0, 0}, {3, 0}, {3, 3}, {2, 3}, {2, 1}, {1, 1}, {1, 3}, {0, 3}, {0, 0}}
+	hole := orb.Ring{{1, 1}, {1, 3}, {3, 3}, {3, 1}, {1, 1}}
+	smallHole := orb.Ring{{0.5, 0.5}, {1.5, 0.5}, {1.5, 1.5}, {0.5, 1.5}, {0.5, 0.5}}
+	otherHole := orb.Ring{{2.5, 2.5}, {3.5, 2.5}, {3.5, 3.5}, {2.5, 3.5}, {2.5, 2.5}}
+
+	tests := []struct {
+		name      string
+		poly      orb.Polygon
+		triangles int
+		area      float64
+	}{
+		{"square", orb.Polygon{square}, 2, 16},
+		{"square clockwise", orb.Polygon{reversed(square)}, 2, 16},
+		{"square unclosed", orb.Polygon{square[:4]}, 2, 16},
+		{"concave", orb.Polygon{concave}, 2, 6},
+		{"concave clockwise", orb.Polygon{reversed(concave)}, 2, 6},
+		{"u shape", orb.Polygon{u}, 6, 7},
+		{"hole", orb.Polygon{square, hole}, 8, 12},
+		{"hole same winding as outer", orb.Polygon{square, reversed(hole)}, 8, 12},
+		{"two holes", orb.Polygon{square, smallHole, otherHole}, 14, 14},
+		{"degenerate hole ignored", orb.Polygon{square, {{1, 1}, {2, 2}, {1, 1}}}, 2, 16},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vertices, indices := Triangulate(tt.poly)
+			if len(indices)%3 != 0 {
+				t.Fatalf("%d indices, not a multiple of 3", len(indices))
+			}
+			if got := len(indices) / 3; got != tt.triangles {
+				t.Errorf("got %d triangles, want %d", got, tt.triangles)
+			}
+
+			area := 0.0
+			for i := 0; i < len(indices); i += 3 {
+				var tri [3]orb.Point
+				for j := range tri {
+					idx := int(indices[i+j])
+					if idx >= len(vertices) {
+						t.Fatalf("index %d out of range (%d vertices)", idx, len(vertices))
+					}
+					pos := vertices[idx].Position
+					tri[j] = orb.Point{float64(pos[0]), float64(pos[1])}
+				}
+				a := signedArea(tri[:])
+				if a <= 0 {
+					t.Errorf("triangle %v is not counter-clockwise", tri)
+				}
+				area += a
+
+				// No triangle may cover a hole
+				centroid := orb.Point{(tri[0][0] + tri[1][0] + tri[2][0]) / 3, (tri[0][1] + tri[1][1] + tri[2][1]) / 3}
+				for _, h := range tt.poly[1:] {
+					if ringArea(h) > 0 && inRing(centroid, h) {
+						t.Errorf("triangle %v lies inside hole %v", tri, h)
+					}
+				}
+			}
+			if math.Abs(area-tt.area) > 1e-9 {
+				t.Errorf("triangles cover %.3f, want %.3f", area, tt.area)
+			}
+		})
+	}
+}
+
+func TestTriangulateDegenerate(t *testing.T) {
+	tests := []struct {
+		name string
+		poly orb.Polygon
+	}{
+		{"empty", nil},
+		{"two points", orb.Polygon{{{0, 0}, {1, 1}, {0, 0}}}},
+		{"collinear", orb.Polygon{{{0, 0}, {1, 0}, {2, 0}, {0, 0}}}},
+	}
+	for _, tt := range tests {
+		if vertices, indices := Triangulate(tt.poly); vertices != nil || indices != nil {
+			t.Errorf("%s: got %d vertices, %d indices, want none", tt.name, len(vertices), len(indices))
+		}
+	}
+}
+
+// Polygons too large for uint16 indices are skipped, not truncated
+func TestTriangulateTooManyPoints(t *testing.T) {
+	n := math.MaxUint16 + 2
+	ring := make(orb.Ring, n+1)
+	for i := range n {
+		a := 2 * math.Pi * float64(i) / float64(n)
+		ring[i] = orb.Point{math.Cos(a), math.Sin(a)}
+	}
+	ring[n] = ring[0]
+
+	if vertices, indices := Triangulate(orb.Polygon{ring}); vertices != nil || indices != nil {
+		t.Errorf("got %d vertices, %d indices for a %d point polygon", len(vertices), len(indices), n)
+	}
+}
+
+// inRing reports whether p is strictly inside r (even-odd rule)
+func inRing(p orb.Point, r orb.Ring) bool {
+	in := false
+	for i, j := 0, len(r)-1; i < len(r); j, i = i, i+1 {
+		a, b := r[i], r[j]
+		if (a[1] > p[1]) != (b[1] > p[1]) && p[0] < (b[0]-a[0])*(p[1]-a[1])/(b[1]-a[1])+a[0] {
+			in = !in
+		}
+	}
+	return in
+}
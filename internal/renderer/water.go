@@ -0,0 +1,130 @@
+package renderer
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/rajveermalviya/go-webgpu/wgpu"
+
+	"mapviewer/internal/camera"
+	"mapviewer/internal/config"
+	"mapviewer/internal/vectortile"
+)
+
+// MaxWaterMeshes bounds how many vector tiles' water triangles are kept;
+// past it, the meshes of tiles that are off screen are dropped
+const MaxWaterMeshes = 64
+
+// fillMesh is a set of triangulated polygons: lon/lat vertices and three
+// indices into them per triangle
+type fillMesh struct {
+	vertices []Vertex
+	indices  []uint32
+}
+
+// add appends poly's triangles to the mesh
+func (m *fillMesh) add(poly orb.Polygon) {
+	vertices, indices := Triangulate(poly)
+	base := uint32(len(m.vertices))
+	m.vertices = append(m.vertices, vertices...)
+	for _, idx := range indices {
+		m.indices = append(m.indices, base+uint32(idx))
+	}
+}
+
+// waterMesh returns the tile's water polygons as an indexed mesh,
+// triangulating them on first use
+func (r *Renderer) waterMesh(data *vectortile.TileData) *fillMesh {
+	if mesh, ok := r.waterMeshes[data]; ok {
+		return mesh
+	}
+
+	mesh := &fillMesh{}
+	for _, water := range data.Water {
+		switch g := water.Geometry.(type) {
+		case orb.Polygon:
+			mesh.add(g)
+		case orb.MultiPolygon:
+			for _, poly := range g {
+				mesh.add(poly)
+			}
+		}
+	}
+	r.waterMeshes[data] = mesh
+	return mesh
+}
+
+// pruneWaterMeshes drops off-screen meshes once there are too many
+func (r *Renderer) pruneWaterMeshes(visible []*vectortile.TileData) {
+	if len(r.waterMeshes) <= MaxWaterMeshes {
+		return
+	}
+	keep := make(map[*vectortile.TileData]*fillMesh, len(visible))
+	for _, data := range visible {
+		if mesh, ok := r.waterMeshes[data]; ok {
+			keep[data] = mesh
+		}
+	}
+	r.waterMeshes = keep
+}
+
+// drawWater fills the visible water polygons and draws water lines (e.g.
+// rivers) in the sea color. The returned buffers must be released after the
+// command buffer is submitted.
+func (r *Renderer) drawWater(pass *wgpu.RenderPassEncoder, cam *camera.Camera, sea config.Color) []*wgpu.Buffer {
+	color := [4]float32{float32(sea[0]), float32(sea[1]), float32(sea[2]), 1}
+
+	visible := r.visibleVectorTiles(cam)
+	var fill []LineVertex
+	var indices []uint32
+	lines := r.newLineBuilder(cam)
+	for _, data := range visible {
+		mesh := r.waterMesh(data)
+		base := uint32(len(fill))
+		for _, v := range mesh.vertices {
+			p := orb.Point{float64(v.Position[0]), float64(v.Position[1])}
+			fill = append(fill, LineVertex{Position: lines.geoNDC(p), Color: color})
+		}
+		for _, idx := range mesh.indices {
+			indices = append(indices, base+idx)
+		}
+		for _, water := range data.Water {
+			lines.addGeometry(water.Geometry, color, 1)
+		}
+	}
+	r.pruneWaterMeshes(visible)
+
+	vertices := append(fill, lines.vertices...)
+	if len(vertices) == 0 {
+		return nil
+	}
+
+	vertexBuffer, err := r.device.CreateBufferInit(&wgpu.BufferInitDescriptor{
+		Label:    "water_vertex_buffer",
+		Contents: wgpu.ToBytes(vertices),
+		Usage:    wgpu.BufferUsage_Vertex,
+	})
+	if err != nil {
+		return nil
+	}
+	buffers := []*wgpu.Buffer{vertexBuffer}
+
+	if len(indices) > 0 {
+		indexBuffer, err := r.device.CreateBufferInit(&wgpu.BufferInitDescriptor{
+			Label:    "water_index_buffer",
+			Contents: wgpu.ToBytes(indices),
+			Usage:    wgpu.BufferUsage_Index,
+		})
+		if err == nil {
+			buffers = append(buffers, indexBuffer)
+			pass.SetPipeline(r.fillPipeline)
+			pass.SetVertexBuffer(0, vertexBuffer, 0, wgpu.WholeSize)
+			pass.SetIndexBuffer(indexBuffer, wgpu.IndexFormat_Uint32, 0, wgpu.WholeSize)
+			pass.DrawIndexed(uint32(len(indices)), 1, 0, 0, 0)
+		}
+	}
+	if len(lines.vertices) > 0 {
+		pass.SetPipeline(r.linePipeline)
+		pass.SetVertexBuffer(0, vertexBuffer, 0, wgpu.WholeSize)
+		pass.Draw(uint32(len(lines.vertices)), 1, uint32(len(fill)), 0)
+	}
+	return buffers
+}
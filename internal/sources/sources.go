@@ -0,0 +1,163 @@
+// Package sources opens the raster and vector tile sources the viewer and
+// the headless renderer read from.
+package sources
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"mapviewer/internal/config"
+	"mapviewer/internal/fetch"
+	"mapviewer/internal/logging"
+	"mapviewer/internal/mbtiles"
+	"mapviewer/internal/renderer"
+	"mapviewer/internal/tileserver"
+	"mapviewer/internal/vectortile"
+	"mapviewer/pkg/tiles"
+)
+
+// RasterTileSource supplies encoded raster tile images.
+// *tileserver.TileCache is the default implementation.
+type RasterTileSource interface {
+	GetTile(coord tiles.TileCoord) ([]byte, error)
+	GetTileCtx(ctx context.Context, coord tiles.TileCoord) ([]byte, error)
+
+	// Invalidate drops any cached copy of a tile, e.g. one that failed to decode
+	Invalidate(coord tiles.TileCoord)
+
+	// Clear drops every cached tile
+	Clear() error
+	Close()
+}
+
+// VectorTileSource supplies vector tile features for the renderer and for
+// feature queries. *vectortile.VectorTileCache is the default implementation.
+type VectorTileSource interface {
+	renderer.VectorTileSource
+	QueryPoint(lat, lon float64, zoom int) (*vectortile.TileData, error)
+	URLTemplate() string
+	Clear()
+	Close()
+}
+
+// Sources are the tile sources the viewer reads from. A nil source is
+// created from config.
+type Sources struct {
+	Raster RasterTileSource
+	Vector VectorTileSource
+}
+
+// Open fills in the sources src leaves nil from config. On error
+// every source, passed in or created, is closed.
+func Open(cfg *config.Config, src Sources) (Sources, error) {
+	if err := cfg.Cache.Validate(); err != nil {
+		src.Close()
+		return Sources{}, fmt.Errorf("invalid cache config: %w", err)
+	}
+	if err := configureTiles(cfg); err != nil {
+		src.Close()
+		return Sources{}, err
+	}
+
+	retry := fetch.DefaultRetryPolicy()
+	retry.MaxAttempts = cfg.Tiles.FetchMaxAttempts
+	retry.BaseDelay = time.Duration(cfg.Tiles.FetchRetryBaseMs) * time.Millisecond
+	retry.AttemptTimeout = time.Duration(cfg.Tiles.FetchTimeoutMs) * time.Millisecond
+
+	if src.Raster == nil {
+		cache, err := newTileCache(cfg, retry)
+		if err != nil {
+			src.Close()
+			return Sources{}, err
+		}
+		src.Raster = cache
+	}
+	if src.Vector == nil {
+		vectorCache, err := newVectorTileCache(cfg, retry)
+		if err != nil {
+			src.Close()
+			return Sources{}, err
+		}
+		src.Vector = vectorCache
+	}
+	return src, nil
+}
+
+// IsTileNotFound reports whether err means the tile doesn't exist, which is
+// expected (e.g. over oceans or past the poles) and drawn as the placeholder
+func IsTileNotFound(err error) bool {
+	return errors.Is(err, tileserver.ErrTileNotFound) || errors.Is(err, tileserver.ErrInvalidTile) || errors.Is(err, mbtiles.ErrTileNotFound)
+}
+
+// Close closes every non-nil source
+func (s Sources) Close() {
+	if s.Raster != nil {
+		s.Raster.Close()
+	}
+	if s.Vector != nil {
+		s.Vector.Close()
+	}
+}
+
+// configureTiles applies the global tile URL, size and subdomain settings
+func configureTiles(cfg *config.Config) error {
+	if cfg.Tiles.URLTemplate != "" {
+		if err := tiles.SetURLTemplate(cfg.Tiles.URLTemplate); err != nil {
+			return fmt.Errorf("invalid tile URL template: %w", err)
+		}
+	}
+	if cfg.Tiles.TileSize != 0 {
+		if err := tiles.SetTileSize(cfg.Tiles.TileSize); err != nil {
+			return fmt.Errorf("invalid tile size: %w", err)
+		}
+	}
+	if len(cfg.Tiles.Subdomains) > 0 {
+		if err := tiles.SetSubdomains(cfg.Tiles.Subdomains...); err != nil {
+			return fmt.Errorf("invalid tile subdomains: %w", err)
+		}
+	}
+	return nil
+}
+
+// newTileCache creates the raster tile cache from config
+func newTileCache(cfg *config.Config, retry fetch.RetryPolicy) (*tileserver.TileCache, error) {
+	cache, err := tileserver.NewTileCache(cfg.Cache.Dir, cfg.Cache.Workers, cfg.Tiles.MaxCacheMB*1024*1024, cfg.Tiles.MaxConcurrentDownloads)
+	if err != nil {
+		return nil, fmt.Errorf("tile cache creation failed: %w", err)
+	}
+
+	cache.SetMaxAge(time.Duration(cfg.Tiles.TileTTLHours * float64(time.Hour)))
+	cache.SetRetryPolicy(retry)
+	if err := cache.SetMirrors(cfg.Tiles.Mirrors...); err != nil {
+		cache.Close()
+		return nil, fmt.Errorf("invalid tile mirrors: %w", err)
+	}
+	if cfg.Tiles.MBTiles != "" {
+		src, err := mbtiles.Open(cfg.Tiles.MBTiles)
+		if err != nil {
+			cache.Close()
+			return nil, err
+		}
+		cache.SetSource(src)
+		logging.Infof("Raster tiles: %s (%s)", cfg.Tiles.MBTiles, src.Metadata("name"))
+	}
+	return cache, nil
+}
+
+// newVectorTileCache creates the vector tile cache from config
+func newVectorTileCache(cfg *config.Config, retry fetch.RetryPolicy) (*vectortile.VectorTileCache, error) {
+	vectorCache, err := vectortile.NewVectorTileCache(".vector_cache")
+	if err != nil {
+		return nil, fmt.Errorf("vector tile cache creation failed: %w", err)
+	}
+	vectorCache.SetRetryPolicy(retry)
+	if cfg.Tiles.VectorURLTemplate != "" {
+		if err := vectorCache.SetURLTemplate(cfg.Tiles.VectorURLTemplate); err != nil {
+			vectorCache.Close()
+			return nil, fmt.Errorf("invalid vector tile URL template: %w", err)
+		}
+	}
+	return vectorCache, nil
+}
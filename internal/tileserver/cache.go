@@ -1,6 +1,8 @@
 package tileserver
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,32 +11,99 @@ import (
 	"sync"
 	"time"
 
+	"mapviewer/internal/atomicfile"
+	"mapviewer/internal/fetch"
+	"mapviewer/internal/logging"
 	"mapviewer/pkg/tiles"
 )
 
+// DefaultMaxConcurrent is a polite cap on simultaneous upstream downloads
+const DefaultMaxConcurrent = 6
+
+// ErrTileNotFound is returned for tiles the server doesn't have (HTTP 404).
+// Callers can draw a placeholder instead of reporting an error.
+var ErrTileNotFound = errors.New("tile not found")
+
+// ErrInvalidTile is returned, without fetching, for coordinates outside the
+// tile grid (see tiles.TileCoord.Valid)
+var ErrInvalidTile = errors.New("tile coordinates out of range")
+
 // TileCache manages tile fetching and caching
 type TileCache struct {
 	cacheDir   string
 	client     *http.Client
-	inFlight   map[string]chan struct{}
+	inFlight   map[string]*inFlightFetch
 	inFlightMu sync.Mutex
+	clearMu    sync.RWMutex // Held for writing by Clear, for reading while caching a tile
 	fetchQueue chan tiles.TileCoord
+	queueMu    sync.RWMutex // Guards sends on fetchQueue against Close
+	closed     bool
 	wg         sync.WaitGroup
+
+	// Disk size limit (0 = unlimited) and LRU bookkeeping
+	maxBytes int64
+	lru      *diskLRU
+	evictCh  chan struct{}
+	evictWg  sync.WaitGroup
+
+	// Cached tiles older than maxAge are re-fetched (0 = never expire)
+	maxAge time.Duration
+
+	// Retry behaviour for upstream requests; ctx is cancelled on Close
+	retry  fetch.RetryPolicy
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// sem limits simultaneous upstream downloads across all callers
+	sem chan struct{}
+
+	// Optional mirrors tried in order of health (nil = tiles.URLTemplate)
+	mirrors   *mirrorSet
+	mirrorsMu sync.RWMutex
+
+	// Optional local source replacing the network (nil = download)
+	source   Source
+	sourceMu sync.RWMutex
+
+	stats cacheStats
 }
 
-// NewTileCache creates a new tile cache
-func NewTileCache(cacheDir string, workers int) (*TileCache, error) {
+// NewTileCache creates a new tile cache. When maxBytes is positive, the least
+// recently used tiles are evicted from disk once the cache grows past it.
+// At most maxConcurrent downloads run at once (0 = DefaultMaxConcurrent).
+func NewTileCache(cacheDir string, workers int, maxBytes int64, maxConcurrent int) (*TileCache, error) {
+	if maxConcurrent <= 0 {
+		maxConcurrent = DefaultMaxConcurrent
+	}
+
 	if err := os.MkdirAll(cacheDir, 0755); err != nil {
 		return nil, fmt.Errorf("failed to create cache directory: %w", err)
 	}
 
+	lru := newDiskLRU()
+	if err := lru.load(cacheDir); err != nil {
+		return nil, fmt.Errorf("failed to scan cache directory: %w", err)
+	}
+
 	tc := &TileCache{
 		cacheDir: cacheDir,
 		client: &http.Client{
 			Timeout: 30 * time.Second,
 		},
-		inFlight:   make(map[string]chan struct{}),
+		inFlight:   make(map[string]*inFlightFetch),
 		fetchQueue: make(chan tiles.TileCoord, 1000),
+		maxBytes:   maxBytes,
+		lru:        lru,
+		evictCh:    make(chan struct{}, 1),
+		retry:      fetch.DefaultRetryPolicy(),
+		sem:        make(chan struct{}, maxConcurrent),
+	}
+	tc.ctx, tc.cancel = context.WithCancel(context.Background())
+
+	if maxBytes > 0 {
+		tc.evictWg.Add(1)
+		go tc.evictor()
+		tc.requestEviction()
 	}
 
 	// Start background workers for prefetching
@@ -49,33 +118,194 @@ func NewTileCache(cacheDir string, workers int) (*TileCache, error) {
 func (tc *TileCache) worker() {
 	defer tc.wg.Done()
 	for coord := range tc.fetchQueue {
-		tc.fetchTile(coord)
+		tc.fetchTile(tc.ctx, coord)
+	}
+}
+
+// evictor trims the disk cache whenever an eviction is requested
+func (tc *TileCache) evictor() {
+	defer tc.evictWg.Done()
+	for range tc.evictCh {
+		tc.lru.evict(tc.maxBytes)
+	}
+}
+
+// requestEviction schedules a background eviction pass if over the limit
+func (tc *TileCache) requestEviction() {
+	if tc.maxBytes <= 0 || tc.lru.totalSize() <= tc.maxBytes {
+		return
+	}
+	select {
+	case tc.evictCh <- struct{}{}:
+	default:
+		// A pass is already pending
+	}
+}
+
+// SetMaxAge sets how long a cached tile is considered fresh (0 = forever)
+func (tc *TileCache) SetMaxAge(maxAge time.Duration) {
+	tc.maxAge = maxAge
+}
+
+// SetRetryPolicy sets how failed upstream requests are retried
+func (tc *TileCache) SetRetryPolicy(policy fetch.RetryPolicy) {
+	tc.retry = policy
+}
+
+// SetHTTPClient sets the client used for upstream requests, e.g. one whose
+// transport points at a local test server. Call it before fetching tiles.
+func (tc *TileCache) SetHTTPClient(client *http.Client) {
+	tc.client = client
+}
+
+// SetMirrors sets upstream URL templates to fail over between. Requests go
+// to the healthiest mirror first and move on to the next one on failure.
+func (tc *TileCache) SetMirrors(templates ...string) error {
+	var ms *mirrorSet
+	if len(templates) > 0 {
+		var err error
+		if ms, err = newMirrorSet(templates); err != nil {
+			return err
+		}
 	}
+
+	tc.mirrorsMu.Lock()
+	tc.mirrors = ms
+	tc.mirrorsMu.Unlock()
+	return nil
 }
 
-// Close shuts down the tile cache
+// readCached reads a cached tile and reports whether it is still fresh
+func (tc *TileCache) readCached(path string) (data []byte, fresh bool, err error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, false, err
+	}
+	data, err = os.ReadFile(path)
+	if err != nil {
+		return nil, false, err
+	}
+	fresh = tc.maxAge <= 0 || time.Since(info.ModTime()) < tc.maxAge
+	return data, fresh, nil
+}
+
+// Invalidate deletes the cached copy of a tile in every format, e.g. after it
+// failed to decode, so the next GetTile downloads it again
+func (tc *TileCache) Invalidate(coord tiles.TileCoord) {
+	for _, ext := range tileExtensions {
+		path := tc.tilePath(coord, ext)
+		tc.lru.remove(path)
+		os.Remove(path)
+		os.Remove(path + metaSuffix)
+	}
+}
+
+// Clear deletes every cached tile from disk and aborts in-progress
+// downloads, so the next GetTile fetches afresh. Callers waiting on an
+// aborted download get an error.
+func (tc *TileCache) Clear() error {
+	tc.inFlightMu.Lock()
+	for key, f := range tc.inFlight {
+		f.cancel(errCacheCleared)
+		delete(tc.inFlight, key)
+	}
+	tc.inFlightMu.Unlock()
+
+	// Wait for tiles being written, then keep new writes out
+	tc.clearMu.Lock()
+	defer tc.clearMu.Unlock()
+
+	var firstErr error
+	for _, path := range tc.lru.reset() {
+		for _, p := range []string{path, path + metaSuffix} {
+			if err := os.Remove(p); err != nil && !os.IsNotExist(err) && firstErr == nil {
+				firstErr = fmt.Errorf("failed to clear tile cache: %w", err)
+			}
+		}
+	}
+	return firstErr
+}
+
+// Size returns the current size of the disk cache in bytes
+func (tc *TileCache) Size() int64 {
+	return tc.lru.totalSize()
+}
+
+// Close shuts down the tile cache, aborting in-progress downloads and
+// retries. Calling it again does nothing.
 func (tc *TileCache) Close() {
+	tc.queueMu.Lock()
+	if tc.closed {
+		tc.queueMu.Unlock()
+		return
+	}
+	tc.closed = true
+	tc.cancel()
 	close(tc.fetchQueue)
+	tc.queueMu.Unlock()
 	tc.wg.Wait()
+
+	// Workers are done writing, so no more evictions can be requested
+	close(tc.evictCh)
+	tc.evictWg.Wait()
+
+	tc.SetSource(nil)
 }
 
-// tilePath returns the file path for a cached tile
-func (tc *TileCache) tilePath(coord tiles.TileCoord) string {
-	return filepath.Join(tc.cacheDir, fmt.Sprintf("%d_%d_%d.png", coord.Zoom, coord.X, coord.Y))
+// tilePath returns the file path for a cached tile in the given format
+func (tc *TileCache) tilePath(coord tiles.TileCoord, ext string) string {
+	return filepath.Join(tc.cacheDir, fmt.Sprintf("%d_%d_%d%s", coord.Zoom, coord.X, coord.Y, ext))
+}
+
+// cachedPath returns the path of the cached tile in whichever format it was
+// stored, or "" if the tile is not cached
+func (tc *TileCache) cachedPath(coord tiles.TileCoord) string {
+	for _, ext := range tileExtensions {
+		path := tc.tilePath(coord, ext)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	return ""
 }
 
 // GetTile returns tile data, fetching and caching if necessary
 func (tc *TileCache) GetTile(coord tiles.TileCoord) ([]byte, error) {
-	path := tc.tilePath(coord)
+	return tc.GetTileCtx(tc.ctx, coord)
+}
+
+// GetTileCtx is like GetTile but gives up when ctx is cancelled, e.g. once
+// the tile has scrolled out of view
+func (tc *TileCache) GetTileCtx(ctx context.Context, coord tiles.TileCoord) ([]byte, error) {
+	if !coord.Valid() {
+		return nil, fmt.Errorf("%s: %w", coord.String(), ErrInvalidTile)
+	}
+	if src := tc.localSource(); src != nil {
+		return src.FetchTile(ctx, coord)
+	}
+
+	path := tc.cachedPath(coord)
 
 	// Check cache first
-	if data, err := os.ReadFile(path); err == nil {
-		return data, nil
+	stale, fresh, err := tc.readCached(path)
+	if err == nil && fresh {
+		tc.stats.hits.Add(1)
+		tc.lru.touch(path)
+		return stale, nil
 	}
+	tc.stats.misses.Add(1)
 
-	// Fetch the tile
-	data, err := tc.fetchTile(coord)
+	// Fetch the tile (missing or expired)
+	data, err := tc.fetchTile(ctx, coord)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		if stale != nil {
+			// Network failed, but an expired copy beats a hole in the map
+			tc.lru.touch(path)
+			return stale, nil
+		}
 		return nil, err
 	}
 
@@ -85,63 +315,190 @@ func (tc *TileCache) GetTile(coord tiles.TileCoord) ([]byte, error) {
 	return data, nil
 }
 
-// fetchTile downloads a tile from OSM and caches it
-func (tc *TileCache) fetchTile(coord tiles.TileCoord) ([]byte, error) {
+// inFlightFetch is a download shared by every caller asking for the same tile.
+// It is only cancelled once all interested callers have given up.
+type inFlightFetch struct {
+	done    chan struct{}
+	data    []byte
+	err     error
+	waiters int
+	cancel  context.CancelCauseFunc
+}
+
+// errCacheCleared aborts downloads that were in flight when Clear ran
+var errCacheCleared = errors.New("tile cache cleared")
+
+// fetchTile downloads a tile from OSM and caches it. Concurrent calls for the
+// same tile share one download; cancelling ctx only abandons this caller.
+func (tc *TileCache) fetchTile(ctx context.Context, coord tiles.TileCoord) ([]byte, error) {
+	// Prefetch neighbours of edge tiles fall off the grid
+	if !coord.Valid() {
+		return nil, fmt.Errorf("%s: %w", coord.String(), ErrInvalidTile)
+	}
 	key := coord.String()
-	path := tc.tilePath(coord)
+	path := tc.cachedPath(coord)
 
-	// Check if already cached
-	if data, err := os.ReadFile(path); err == nil {
-		return data, nil
+	// Check if already cached and still fresh
+	cached, fresh, err := tc.readCached(path)
+	if err == nil && fresh {
+		return cached, nil
 	}
 
-	// Check if fetch is already in progress
+	// Join an in-progress fetch or start a new one
 	tc.inFlightMu.Lock()
-	if ch, exists := tc.inFlight[key]; exists {
-		tc.inFlightMu.Unlock()
-		<-ch // Wait for the in-flight request to complete
-		return os.ReadFile(path)
+	f, exists := tc.inFlight[key]
+	if !exists {
+		dlCtx, cancel := context.WithCancelCause(tc.ctx)
+		f = &inFlightFetch{done: make(chan struct{}), cancel: cancel}
+		tc.inFlight[key] = f
+		go tc.download(dlCtx, key, coord, cached, f)
 	}
-
-	// Mark as in-flight
-	ch := make(chan struct{})
-	tc.inFlight[key] = ch
+	f.waiters++
 	tc.inFlightMu.Unlock()
 
-	defer func() {
+	select {
+	case <-f.done:
+		return f.data, f.err
+	case <-ctx.Done():
 		tc.inFlightMu.Lock()
-		delete(tc.inFlight, key)
-		close(ch)
+		f.waiters--
+		if f.waiters == 0 {
+			// Nobody wants this tile anymore; let a later request start afresh
+			f.cancel(nil)
+			if tc.inFlight[key] == f {
+				delete(tc.inFlight, key)
+			}
+		}
 		tc.inFlightMu.Unlock()
-	}()
+		return nil, ctx.Err()
+	}
+}
+
+// download performs the upstream request for an in-flight fetch
+func (tc *TileCache) download(ctx context.Context, key string, coord tiles.TileCoord, cached []byte, f *inFlightFetch) {
+	data, err := tc.downloadTile(ctx, coord, cached)
+
+	tc.inFlightMu.Lock()
+	if tc.inFlight[key] == f {
+		delete(tc.inFlight, key)
+	}
+	f.data, f.err = data, err
+	close(f.done)
+	f.cancel(nil)
+	tc.inFlightMu.Unlock()
+}
+
+// downloadTile fetches a tile from the first mirror that serves it and
+// writes it to disk
+func (tc *TileCache) downloadTile(ctx context.Context, coord tiles.TileCoord, cached []byte) ([]byte, error) {
+	tc.mirrorsMu.RLock()
+	ms := tc.mirrors
+	tc.mirrorsMu.RUnlock()
 
-	// Fetch from server
-	url := coord.URL()
-	req, err := http.NewRequest("GET", url, nil)
+	if ms == nil {
+		return tc.downloadFrom(ctx, coord.URL(), coord, cached)
+	}
+
+	var lastErr error
+	for _, m := range ms.ordered() {
+		data, err := tc.downloadFrom(ctx, coord.URLFromTemplate(m.template), coord, cached)
+		if err == nil {
+			ms.recordSuccess(m)
+			return data, nil
+		}
+		if ctx.Err() != nil {
+			return nil, err
+		}
+		// A mirror without the tile is still healthy
+		if !errors.Is(err, ErrTileNotFound) {
+			ms.recordFailure(m)
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// downloadFrom fetches a tile from a single URL and writes it to disk
+func (tc *TileCache) downloadFrom(ctx context.Context, url string, coord tiles.TileCoord, cached []byte) ([]byte, error) {
+	path := tc.cachedPath(coord)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 	req.Header.Set("User-Agent", "MapViewer/1.0 (educational project)")
 
-	resp, err := tc.client.Do(req)
+	// Revalidate an expired copy instead of downloading it again
+	if cached != nil {
+		if meta, ok := readMeta(path); ok {
+			meta.setConditionalHeaders(req)
+		}
+	}
+
+	tc.stats.fetches.Add(1)
+	tc.stats.inFlight.Add(1)
+	start := time.Now()
+	// Each attempt waits for a download slot, freed again while backing off
+	resp, err := fetch.DoLimited(tc.client, req, tc.retry, tc.sem)
+	tc.stats.fetchDuration.observe(time.Since(start))
+	tc.stats.inFlight.Add(-1)
 	if err != nil {
+		tc.stats.fetchErrors.Add(1)
 		return nil, fmt.Errorf("failed to fetch tile: %w", err)
 	}
 	defer resp.Body.Close()
 
+	// A download Clear aborted must not touch the cache again
+	tc.clearMu.RLock()
+	defer tc.clearMu.RUnlock()
+	if err := context.Cause(ctx); err == errCacheCleared {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		// Cached copy is still good; restart its TTL
+		now := time.Now()
+		if err := os.Chtimes(path, now, now); err != nil {
+			logging.Warnf("failed to refresh tile timestamp: %v", err)
+		}
+		tc.lru.touch(path)
+		return cached, nil
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%s: %w", coord.String(), ErrTileNotFound)
+	}
 	if resp.StatusCode != http.StatusOK {
+		tc.stats.fetchErrors.Add(1)
 		return nil, fmt.Errorf("tile server returned status %d", resp.StatusCode)
 	}
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
+		tc.stats.fetchErrors.Add(1)
 		return nil, fmt.Errorf("failed to read tile data: %w", err)
 	}
+	tc.stats.bytesDownloaded.Add(int64(len(data)))
+
+	// Cache to disk with an extension matching the actual format
+	oldPath := path
+	path = tc.tilePath(coord, detectFormat(resp.Header.Get("Content-Type"), data))
+	if oldPath != "" && oldPath != path {
+		// Upstream switched formats; drop the copy in the old one
+		tc.lru.remove(oldPath)
+		os.Remove(oldPath)
+		os.Remove(oldPath + metaSuffix)
+	}
 
-	// Cache to disk
-	if err := os.WriteFile(path, data, 0644); err != nil {
+	if err := atomicfile.Write(path, data); err != nil {
 		// Log but don't fail - we still have the data
-		fmt.Printf("Warning: failed to cache tile: %v\n", err)
+		logging.Warnf("failed to cache tile: %v", err)
+	} else {
+		if err := writeMeta(path, resp.Header); err != nil {
+			logging.Warnf("failed to cache tile metadata: %v", err)
+		}
+		tc.lru.add(path, int64(len(data)))
+		tc.requestEviction()
 	}
 
 	return data, nil
@@ -149,14 +506,23 @@ func (tc *TileCache) fetchTile(coord tiles.TileCoord) ([]byte, error) {
 
 // queuePrefetch adds adjacent tiles to the prefetch queue
 func (tc *TileCache) queuePrefetch(coord tiles.TileCoord) {
-	adjacent := tiles.GetAdjacentTiles(coord)
-	for _, adj := range adjacent {
-		// Non-blocking send to queue
-		select {
-		case tc.fetchQueue <- adj:
-		default:
-			// Queue full, skip this tile
-		}
+	for _, adj := range tiles.GetAdjacentTiles(coord) {
+		tc.enqueue(adj)
+	}
+}
+
+// enqueue hands a tile to the prefetch workers unless the queue is full or
+// the cache is closed
+func (tc *TileCache) enqueue(coord tiles.TileCoord) {
+	tc.queueMu.RLock()
+	defer tc.queueMu.RUnlock()
+	if tc.closed {
+		return
+	}
+	select {
+	case tc.fetchQueue <- coord:
+	default:
+		// Queue full, skip this tile
 	}
 }
 
@@ -164,17 +530,11 @@ func (tc *TileCache) queuePrefetch(coord tiles.TileCoord) {
 func (tc *TileCache) PrefetchArea(centerLat, centerLon float64, zoom int, viewportWidth, viewportHeight int) {
 	tilesToFetch := tiles.GetPrefetchTiles(centerLat, centerLon, zoom, viewportWidth, viewportHeight)
 	for _, coord := range tilesToFetch {
-		select {
-		case tc.fetchQueue <- coord:
-		default:
-			// Queue full
-		}
+		tc.enqueue(coord)
 	}
 }
 
 // IsCached checks if a tile is already cached
 func (tc *TileCache) IsCached(coord tiles.TileCoord) bool {
-	path := tc.tilePath(coord)
-	_, err := os.Stat(path)
-	return err == nil
+	return tc.cachedPath(coord) != ""
 }
@@ -0,0 +1,471 @@
+package tileserver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mapviewer/internal/fetch"
+	"mapviewer/pkg/tiles"
+)
+
+// noRetry makes upstream failures show up on the first attempt
+var noRetry = fetch.RetryPolicy{MaxAttempts: 1}
+
+// pngTile is enough of a PNG for format detection; the cache never decodes it
+var pngTile = []byte("\x89PNG\r\n\x1a\nfake tile")
+
+// newTestCache returns a cache in a temp dir whose only mirror is a test
+// server running handler. workers is the number of prefetch workers.
+func newTestCache(t *testing.T, workers int, handler http.HandlerFunc) (*TileCache, string) {
+	t.Helper()
+	return newTestCacheIn(t, t.TempDir(), workers, 0, handler)
+}
+
+// newTestCacheIn is newTestCache over an existing directory, with a disk
+// size limit (0 = none)
+func newTestCacheIn(t *testing.T, dir string, workers int, maxBytes int64, handler http.HandlerFunc) (*TileCache, string) {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	tc, err := NewTileCache(dir, workers, maxBytes, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(tc.Close)
+
+	tc.SetHTTPClient(srv.Client())
+	tc.SetRetryPolicy(noRetry)
+	if err := tc.SetMirrors(srv.URL + "/{z}/{x}/{y}.png"); err != nil {
+		t.Fatal(err)
+	}
+	return tc, dir
+}
+
+// countingHandler serves pngTile and counts requests
+func countingHandler(hits *atomic.Int32) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(pngTile)
+	}
+}
+
+func TestClearEmptiesCacheAndRefetches(t *testing.T) {
+	var hits atomic.Int32
+	tc, dir := newTestCache(t, 0, countingHandler(&hits))
+	coord := tiles.TileCoord{X: 1, Y: 1, Zoom: 2}
+
+	for i := 0; i < 2; i++ {
+		if _, err := tc.GetTile(coord); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := hits.Load(); got != 1 {
+		t.Fatalf("before Clear: %d upstream requests, want 1", got)
+	}
+
+	if err := tc.Clear(); err != nil {
+		t.Fatalf("Clear: %v", err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("cache dir has %d entries after Clear, want 0", len(entries))
+	}
+	if tc.Size() != 0 || tc.IsCached(coord) {
+		t.Errorf("after Clear: size %d, cached %v", tc.Size(), tc.IsCached(coord))
+	}
+
+	data, err := tc.GetTile(coord)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(pngTile) {
+		t.Errorf("refetched %q", data)
+	}
+	if got := hits.Load(); got != 2 {
+		t.Errorf("after Clear: %d upstream requests, want 2", got)
+	}
+}
+
+func TestClearAbortsInFlightDownloads(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	tc, dir := newTestCache(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(pngTile)
+	})
+	defer close(release)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := tc.GetTile(tiles.TileCoord{X: 0, Y: 0, Zoom: 1})
+		done <- err
+	}()
+	<-started
+
+	if err := tc.Clear(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err == nil {
+		t.Error("download aborted by Clear succeeded")
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("aborted download left %d files in the cache", len(entries))
+	}
+}
+
+// Prefetch requests must not race Close (send on closed channel)
+func TestCloseDuringPrefetch(t *testing.T) {
+	var hits atomic.Int32
+	tc, _ := newTestCache(t, 2, countingHandler(&hits))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				tc.PrefetchArea(52.37, 4.9, 12, 256, 256)
+			}
+		}()
+	}
+	tc.Close()
+	wg.Wait()
+}
+
+// expire backdates every cached tile so the next GetTile revalidates it
+func expire(t *testing.T, dir string) {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	for _, e := range entries {
+		if err := os.Chtimes(filepath.Join(dir, e.Name()), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestRevalidateExpiredTile(t *testing.T) {
+	const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+	tests := []struct {
+		name        string
+		validator   string // response header carrying the validator
+		value       string
+		conditional string // request header expected on revalidation
+		changed     bool   // upstream content changed since the first fetch
+	}{
+		{"etag unchanged", "ETag", `"v1"`, "If-None-Match", false},
+		{"etag changed", "ETag", `"v1"`, "If-None-Match", true},
+		{"last-modified unchanged", "Last-Modified", lastModified, "If-Modified-Since", false},
+		{"last-modified changed", "Last-Modified", lastModified, "If-Modified-Since", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := append(slices.Clone(pngTile), '1')
+			second := append(slices.Clone(pngTile), '2')
+
+			var full, notModified atomic.Int32
+			var changed atomic.Bool
+			tc, dir := newTestCache(t, 0, func(w http.ResponseWriter, r *http.Request) {
+				if got := r.Header.Get(tt.conditional); got == tt.value && !changed.Load() {
+					notModified.Add(1)
+					w.WriteHeader(http.StatusNotModified)
+					return
+				}
+				full.Add(1)
+				body := first
+				if changed.Load() {
+					body = second
+				}
+				w.Header().Set(tt.validator, tt.value)
+				w.Header().Set("Content-Type", "image/png")
+				w.Write(body)
+			})
+			tc.SetMaxAge(time.Minute)
+			coord := tiles.TileCoord{X: 2, Y: 3, Zoom: 4}
+
+			if _, err := tc.GetTile(coord); err != nil {
+				t.Fatal(err)
+			}
+			expire(t, dir)
+			changed.Store(tt.changed)
+
+			data, err := tc.GetTile(coord)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want, wantFull, want304 := first, int32(1), int32(1)
+			if tt.changed {
+				want, wantFull, want304 = second, 2, 0
+			}
+			if string(data) != string(want) {
+				t.Errorf("got %q, want %q", data, want)
+			}
+			if full.Load() != wantFull || notModified.Load() != want304 {
+				t.Errorf("%d full responses and %d 304s, want %d and %d",
+					full.Load(), notModified.Load(), wantFull, want304)
+			}
+
+			// Either way the tile is fresh again and served from disk
+			if _, err := tc.GetTile(coord); err != nil {
+				t.Fatal(err)
+			}
+			if got := full.Load() + notModified.Load(); got != wantFull+want304 {
+				t.Errorf("revalidated tile was fetched again (%d requests)", got)
+			}
+		})
+	}
+}
+
+// Expired tiles without stored validators are downloaded unconditionally
+func TestExpiredTileWithoutValidators(t *testing.T) {
+	var conditional atomic.Int32
+	var hits atomic.Int32
+	tc, dir := newTestCache(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" || r.Header.Get("If-Modified-Since") != "" {
+			conditional.Add(1)
+		}
+		countingHandler(&hits)(w, r)
+	})
+	tc.SetMaxAge(time.Minute)
+	coord := tiles.TileCoord{X: 0, Y: 0, Zoom: 0}
+
+	if _, err := tc.GetTile(coord); err != nil {
+		t.Fatal(err)
+	}
+	expire(t, dir)
+	if _, err := tc.GetTile(coord); err != nil {
+		t.Fatal(err)
+	}
+	if hits.Load() != 2 || conditional.Load() != 0 {
+		t.Errorf("%d requests, %d conditional; want 2 and 0", hits.Load(), conditional.Load())
+	}
+}
+
+// An expired tile is still served when upstream fails to refresh it
+func TestServeStaleOnUpstreamFailure(t *testing.T) {
+	tests := []struct {
+		name string
+		fail func(w http.ResponseWriter, r *http.Request)
+	}{
+		{"server error", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "down", http.StatusInternalServerError)
+		}},
+		{"throttled", func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+		}},
+		{"connection dropped", func(w http.ResponseWriter, r *http.Request) {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var failing atomic.Bool
+			var hits atomic.Int32
+			tc, dir := newTestCache(t, 0, func(w http.ResponseWriter, r *http.Request) {
+				hits.Add(1)
+				if failing.Load() {
+					tt.fail(w, r)
+					return
+				}
+				w.Write(pngTile)
+			})
+			tc.SetMaxAge(time.Minute)
+			coord := tiles.TileCoord{X: 2, Y: 1, Zoom: 3}
+
+			if _, err := tc.GetTile(coord); err != nil {
+				t.Fatal(err)
+			}
+			expire(t, dir)
+			failing.Store(true)
+
+			data, err := tc.GetTile(coord)
+			if err != nil {
+				t.Fatalf("expired tile with upstream down: %v", err)
+			}
+			if !bytes.Equal(data, pngTile) {
+				t.Errorf("got %q, want the stale copy", data)
+			}
+			// The transport may retry a dropped connection itself
+			if hits.Load() < 2 {
+				t.Errorf("%d upstream requests, want a refresh attempt", hits.Load())
+			}
+			if onDisk, err := os.ReadFile(tc.cachedPath(coord)); err != nil || !bytes.Equal(onDisk, pngTile) {
+				t.Errorf("cached copy changed after the failed refresh: %q, %v", onDisk, err)
+			}
+
+			// Without a stale copy the failure is reported
+			if _, err := tc.GetTile(tiles.TileCoord{X: 3, Y: 1, Zoom: 3}); err == nil {
+				t.Error("uncached tile with upstream down succeeded")
+			}
+		})
+	}
+}
+
+func TestInvalidate(t *testing.T) {
+	tests := []struct {
+		name   string
+		stored []string // extensions with a cached copy before Invalidate
+	}{
+		{"not cached", nil},
+		{"png", []string{extPNG}},
+		{"jpeg", []string{extJPEG}},
+		{"left over in two formats", []string{extPNG, extWebP}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var hits atomic.Int32
+			tc, dir := newTestCache(t, 0, countingHandler(&hits))
+			coord := tiles.TileCoord{X: 5, Y: 6, Zoom: 4}
+			other := tiles.TileCoord{X: 1, Y: 1, Zoom: 4}
+			if _, err := tc.GetTile(other); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, ext := range tt.stored {
+				path := tc.tilePath(coord, ext)
+				if err := os.WriteFile(path, []byte("corrupt"), 0644); err != nil {
+					t.Fatal(err)
+				}
+				if err := os.WriteFile(path+metaSuffix, []byte(`{"etag":"\"x\""}`), 0644); err != nil {
+					t.Fatal(err)
+				}
+				tc.lru.add(path, int64(len("corrupt")))
+			}
+
+			tc.Invalidate(coord)
+
+			if tc.IsCached(coord) {
+				t.Error("tile still cached after Invalidate")
+			}
+			for _, ext := range tileExtensions {
+				path := tc.tilePath(coord, ext)
+				for _, p := range []string{path, path + metaSuffix} {
+					if _, err := os.Stat(p); !os.IsNotExist(err) {
+						t.Errorf("%s still on disk", filepath.Base(p))
+					}
+				}
+			}
+			if got := tc.Size(); got != int64(len(pngTile)) {
+				t.Errorf("cache size %d, want only the other tile (%d)", got, len(pngTile))
+			}
+			if !tc.IsCached(other) {
+				t.Error("Invalidate removed an unrelated tile")
+			}
+
+			// The next request downloads a good copy
+			before := hits.Load()
+			data, err := tc.GetTile(coord)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != string(pngTile) || hits.Load() != before+1 {
+				t.Errorf("after Invalidate got %q with %d new requests", data, hits.Load()-before)
+			}
+			if entries, _ := os.ReadDir(dir); len(entries) != 2 {
+				t.Errorf("%d files in the cache, want the two tiles", len(entries))
+			}
+		})
+	}
+}
+
+// However many callers fetch at once, at most the configured number of
+// downloads reach upstream together
+func TestDownloadLimit(t *testing.T) {
+	var current, peak atomic.Int32
+	tc, _ := newTestCache(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		n := current.Add(1)
+		defer current.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		w.Write(pngTile)
+	})
+	limit := int32(cap(tc.sem))
+
+	var wg sync.WaitGroup
+	for x := 0; x < 8*int(limit); x++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := tc.GetTile(tiles.TileCoord{X: x, Y: 0, Zoom: 6}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := peak.Load(); got != limit {
+		t.Errorf("peak of %d concurrent downloads, want %d", got, limit)
+	}
+}
+
+// A download waiting to retry doesn't hold a slot other tiles need
+func TestRetryBackoffFreesSlot(t *testing.T) {
+	var failed sync.Map
+	tc, _ := newTestCache(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/6/9/9.png" {
+			if _, seen := failed.LoadOrStore(r.URL.Path, true); !seen {
+				w.Header().Set("Retry-After", "2")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+		}
+		w.Write(pngTile)
+	})
+	tc.SetRetryPolicy(fetch.RetryPolicy{MaxAttempts: 2, MaxDelay: 10 * time.Second})
+
+	// Fill every slot with a download that backs off after its first try
+	var wg sync.WaitGroup
+	for x := 0; x < cap(tc.sem); x++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := tc.GetTile(tiles.TileCoord{X: x, Y: 0, Zoom: 6}); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	defer wg.Wait()
+	for seen := 0; seen < cap(tc.sem); {
+		seen = 0
+		failed.Range(func(any, any) bool { seen++; return true })
+		time.Sleep(time.Millisecond)
+	}
+
+	start := time.Now()
+	if _, err := tc.GetTile(tiles.TileCoord{X: 9, Y: 9, Zoom: 6}); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited > time.Second {
+		t.Errorf("tile took %v behind downloads waiting to retry", waited)
+	}
+}
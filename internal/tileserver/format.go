@@ -0,0 +1,37 @@
+package tileserver
+
+import (
+	"bytes"
+	"mime"
+)
+
+// Cached tile file extensions, in lookup order
+const (
+	extPNG  = ".png"
+	extJPEG = ".jpg"
+	extWebP = ".webp"
+)
+
+var tileExtensions = []string{extPNG, extJPEG, extWebP}
+
+// detectFormat picks a file extension for tile data, trusting the magic bytes
+// over the upstream Content-Type. Unknown data is stored as PNG.
+func detectFormat(contentType string, data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, []byte("\x89PNG\r\n\x1a\n")):
+		return extPNG
+	case bytes.HasPrefix(data, []byte{0xFF, 0xD8, 0xFF}):
+		return extJPEG
+	case len(data) >= 12 && bytes.Equal(data[0:4], []byte("RIFF")) && bytes.Equal(data[8:12], []byte("WEBP")):
+		return extWebP
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch mediaType {
+	case "image/jpeg":
+		return extJPEG
+	case "image/webp":
+		return extWebP
+	}
+	return extPNG
+}
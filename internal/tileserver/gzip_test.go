@@ -0,0 +1,136 @@
+package tileserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWithGzip(t *testing.T) {
+	jsonBody := []byte(strings.Repeat(`{"type":"Feature","properties":{}},`, 50))
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string // "" = let the writer sniff it
+		status         int
+		body           []byte
+		wantGzip       bool
+		wantVary       bool // responses differ by Accept-Encoding
+	}{
+		{"json", "gzip", "application/json", 200, jsonBody, true, true},
+		{"geojson", "br, gzip;q=0.8", "application/geo+json", 200, jsonBody, true, true},
+		{"text", "GZIP", "text/plain; version=0.0.4", 200, jsonBody, true, true},
+		{"sniffed text", "gzip", "", 200, []byte("plain text body"), true, true},
+		{"png passes through", "gzip", "image/png", 200, pngTile, false, true},
+		{"client without gzip", "", "application/json", 200, jsonBody, false, false},
+		{"gzip refused", "gzip;q=0", "application/json", 200, jsonBody, false, false},
+		{"gzip refused with decimals", "br, gzip; q=0.000", "application/json", 200, jsonBody, false, false},
+		{"gzip refused uppercase", "gzip;Q=0.0", "application/json", 200, jsonBody, false, false},
+		{"gzip with a low weight", "gzip;q=0.001", "application/json", 200, jsonBody, true, true},
+		{"gzip with a bad weight", "gzip;q=high", "application/json", 200, jsonBody, false, false},
+		{"other encodings only", "br, deflate", "application/json", 200, jsonBody, false, false},
+		{"not modified", "gzip", "application/json", 304, nil, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := withGzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				// Like most handlers, only set the status when it isn't 200
+				if tt.status != http.StatusOK {
+					w.WriteHeader(tt.status)
+				}
+				w.Write(tt.body)
+			}))
+			req := httptest.NewRequest("GET", "/tile", nil)
+			if tt.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			gotGzip := rec.Header().Get("Content-Encoding") == "gzip"
+			if gotGzip != tt.wantGzip {
+				t.Fatalf("Content-Encoding %q, want gzip=%v", rec.Header().Get("Content-Encoding"), tt.wantGzip)
+			}
+			if rec.Code != tt.status {
+				t.Errorf("status %d, want %d", rec.Code, tt.status)
+			}
+
+			body := rec.Body.Bytes()
+			if gotGzip {
+				zr, err := gzip.NewReader(rec.Body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if body, err = io.ReadAll(zr); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !bytes.Equal(body, tt.body) {
+				t.Errorf("body %q, want %q", body, tt.body)
+			}
+			if vary := rec.Header().Get("Vary"); (vary == "Accept-Encoding") != tt.wantVary {
+				t.Errorf("Vary %q, want Accept-Encoding=%v", vary, tt.wantVary)
+			}
+		})
+	}
+}
+
+// A handler's own Content-Encoding (e.g. pre-gzipped vector tiles) must
+// not be compressed twice
+func TestWithGzipKeepsExistingEncoding(t *testing.T) {
+	var compressed bytes.Buffer
+	zw := gzip.NewWriter(&compressed)
+	zw.Write([]byte(`{"already":"compressed"}`))
+	zw.Close()
+
+	handler := withGzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.Write(compressed.Bytes())
+	}))
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if !bytes.Equal(rec.Body.Bytes(), compressed.Bytes()) {
+		t.Error("pre-compressed body was compressed again")
+	}
+}
+
+// Through a real connection, a standard client decodes the response
+func TestWithGzipOverHTTP(t *testing.T) {
+	body := strings.Repeat("hello tiles ", 100)
+	srv := httptest.NewServer(withGzip(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Length", "1200")
+		io.WriteString(w, body)
+	})))
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The transport asked for gzip and transparently decoded it
+	if !resp.Uncompressed {
+		t.Error("response was not gzip encoded")
+	}
+	if string(got) != body {
+		t.Errorf("got %d bytes, want %d", len(got), len(body))
+	}
+}
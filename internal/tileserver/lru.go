@@ -0,0 +1,172 @@
+package tileserver
+
+import (
+	"container/list"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"mapviewer/internal/atomicfile"
+)
+
+// diskLRU tracks cached tile files in least-recently-used order
+type diskLRU struct {
+	mu      sync.Mutex
+	order   *list.List // front = most recently used
+	entries map[string]*list.Element
+	size    int64
+}
+
+type lruEntry struct {
+	path string
+	size int64
+}
+
+func newDiskLRU() *diskLRU {
+	return &diskLRU{
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// load seeds the tracker from files already on disk, oldest first
+func (l *diskLRU) load(dir string) error {
+	dirEntries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	type fileInfo struct {
+		path string
+		size int64
+		mod  int64
+	}
+	files := make([]fileInfo, 0, len(dirEntries))
+	for _, e := range dirEntries {
+		if strings.HasPrefix(e.Name(), atomicfile.TempPrefix) {
+			// Interrupted write; the tile will be fetched again
+			os.Remove(filepath.Join(dir, e.Name()))
+			continue
+		}
+		if e.IsDir() || strings.HasSuffix(e.Name(), metaSuffix) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, fileInfo{
+			path: filepath.Join(dir, e.Name()),
+			size: info.Size(),
+			mod:  info.ModTime().UnixNano(),
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].mod < files[j].mod
+	})
+	for _, f := range files {
+		l.add(f.path, f.size)
+	}
+	return nil
+}
+
+// add records a file (or updates its size) and marks it most recently used
+func (l *diskLRU) add(path string, size int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.entries[path]; ok {
+		entry := el.Value.(*lruEntry)
+		l.size += size - entry.size
+		entry.size = size
+		l.order.MoveToFront(el)
+		return
+	}
+
+	l.entries[path] = l.order.PushFront(&lruEntry{path: path, size: size})
+	l.size += size
+}
+
+// touch marks a file as most recently used
+func (l *diskLRU) touch(path string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.entries[path]; ok {
+		l.order.MoveToFront(el)
+	}
+}
+
+// remove stops tracking a file
+func (l *diskLRU) remove(path string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if el, ok := l.entries[path]; ok {
+		l.size -= el.Value.(*lruEntry).size
+		l.order.Remove(el)
+		delete(l.entries, path)
+	}
+}
+
+// paths returns every tracked file
+func (l *diskLRU) paths() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	paths := make([]string, 0, len(l.entries))
+	for path := range l.entries {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+// reset stops tracking every file and returns their paths
+func (l *diskLRU) reset() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	paths := make([]string, 0, len(l.entries))
+	for path := range l.entries {
+		paths = append(paths, path)
+	}
+	l.order.Init()
+	l.entries = make(map[string]*list.Element)
+	l.size = 0
+	return paths
+}
+
+// totalSize returns the tracked size in bytes
+func (l *diskLRU) totalSize() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.size
+}
+
+// evict deletes least-recently-used files until the total is within maxBytes
+func (l *diskLRU) evict(maxBytes int64) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	evicted := 0
+	for l.size > maxBytes {
+		el := l.order.Back()
+		if el == nil {
+			break
+		}
+		entry := el.Value.(*lruEntry)
+		if err := os.Remove(entry.path); err != nil && !os.IsNotExist(err) {
+			// Leave it tracked; another pass may succeed
+			break
+		}
+		os.Remove(entry.path + metaSuffix)
+		l.size -= entry.size
+		l.order.Remove(el)
+		delete(l.entries, entry.path)
+		evicted++
+	}
+	return evicted
+}
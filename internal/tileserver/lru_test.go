@@ -0,0 +1,138 @@
+package tileserver
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mapviewer/internal/atomicfile"
+	"mapviewer/pkg/tiles"
+)
+
+// waitForSize waits for background eviction to bring the cache within limit
+func waitForSize(t *testing.T, tc *TileCache, limit int64) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for tc.Size() > limit {
+		if time.Now().After(deadline) {
+			t.Fatalf("cache size %d, still over the %d byte limit", tc.Size(), limit)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// cachedTiles reports which of coords have a tile file on disk
+func cachedTiles(tc *TileCache, coords []tiles.TileCoord) []bool {
+	cached := make([]bool, len(coords))
+	for i, coord := range coords {
+		_, err := os.Stat(tc.cachedPath(coord))
+		cached[i] = err == nil
+	}
+	return cached
+}
+
+func TestEvictLeastRecentlyUsed(t *testing.T) {
+	tileSize := int64(len(pngTile))
+	limit := 3 * tileSize
+	var hits atomic.Int32
+	tc, _ := newTestCacheIn(t, t.TempDir(), 0, limit, countingHandler(&hits))
+
+	coords := []tiles.TileCoord{
+		{X: 0, Y: 0, Zoom: 3},
+		{X: 1, Y: 0, Zoom: 3},
+		{X: 2, Y: 0, Zoom: 3},
+		{X: 3, Y: 0, Zoom: 3},
+		{X: 4, Y: 0, Zoom: 3},
+	}
+	get := func(coord tiles.TileCoord) {
+		t.Helper()
+		if _, err := tc.GetTile(coord); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, coord := range coords[:3] {
+		get(coord)
+	}
+	if got := tc.Size(); got != limit {
+		t.Fatalf("size %d after three tiles, want %d", got, limit)
+	}
+
+	// Reading the oldest tile makes the second one least recently used
+	get(coords[0])
+	get(coords[3])
+	waitForSize(t, tc, limit)
+	if got, want := cachedTiles(tc, coords), []bool{true, false, true, true, false}; !slices.Equal(got, want) {
+		t.Errorf("cached %v, want %v", got, want)
+	}
+
+	get(coords[4])
+	waitForSize(t, tc, limit)
+	if got, want := cachedTiles(tc, coords), []bool{true, false, false, true, true}; !slices.Equal(got, want) {
+		t.Errorf("cached %v, want %v", got, want)
+	}
+	if got := tc.Size(); got != limit {
+		t.Errorf("size %d, want %d", got, limit)
+	}
+}
+
+// A cache opened over a directory already past the limit trims the oldest
+// files first
+func TestEvictOnOpen(t *testing.T) {
+	dir := t.TempDir()
+	tileSize := int64(len(pngTile))
+	base := time.Now().Add(-time.Hour)
+	var names []string
+	for i := 0; i < 4; i++ {
+		name := filepath.Join(dir, fmt.Sprintf("3_%d_0%s", i, extPNG))
+		if err := os.WriteFile(name, pngTile, 0644); err != nil {
+			t.Fatal(err)
+		}
+		mod := base.Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(name, mod, mod); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, name)
+	}
+
+	var hits atomic.Int32
+	tc, _ := newTestCacheIn(t, dir, 0, 2*tileSize, countingHandler(&hits))
+	waitForSize(t, tc, 2*tileSize)
+
+	for i, name := range names {
+		_, err := os.Stat(name)
+		if kept := err == nil; kept != (i >= 2) {
+			t.Errorf("%s: kept %v, want %v", filepath.Base(name), kept, i >= 2)
+		}
+	}
+}
+
+// Temp files left by a crash mid-write are removed when the cache opens and
+// don't count towards its size
+func TestNewTileCacheRemovesTempFiles(t *testing.T) {
+	dir := t.TempDir()
+	tile := filepath.Join(dir, "1_0_0.png")
+	leftover := filepath.Join(dir, atomicfile.TempPrefix+"12345")
+	if err := os.WriteFile(tile, pngTile, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(leftover, []byte("half a ti"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tc, err := NewTileCache(dir, 0, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tc.Close()
+
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Errorf("leftover temp file still present: %v", err)
+	}
+	if got := tc.Size(); got != int64(len(pngTile)) {
+		t.Errorf("cache size %d, want %d", got, len(pngTile))
+	}
+}
@@ -0,0 +1,72 @@
+package tileserver
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"mapviewer/pkg/tiles"
+)
+
+// ExportManifest writes the coordinates of every cached tile to w as a
+// manifest: one "z/x/y" line per tile, sorted by zoom, x and y
+func (tc *TileCache) ExportManifest(w io.Writer) error {
+	var coords []tiles.TileCoord
+	for _, path := range tc.lru.paths() {
+		name := filepath.Base(path)
+		var coord tiles.TileCoord
+		n, err := fmt.Sscanf(strings.TrimSuffix(name, filepath.Ext(name)), "%d_%d_%d", &coord.Zoom, &coord.X, &coord.Y)
+		if err != nil || n != 3 {
+			continue
+		}
+		coords = append(coords, coord)
+	}
+	sort.Slice(coords, func(i, j int) bool {
+		a, b := coords[i], coords[j]
+		if a.Zoom != b.Zoom {
+			return a.Zoom < b.Zoom
+		}
+		if a.X != b.X {
+			return a.X < b.X
+		}
+		return a.Y < b.Y
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, coord := range coords {
+		fmt.Fprintf(bw, "%d/%d/%d\n", coord.Zoom, coord.X, coord.Y)
+	}
+	return bw.Flush()
+}
+
+// ImportManifest fetches every tile listed in a manifest written by
+// ExportManifest, skipping blank lines and "#" comments. Tiles already
+// cached and fresh are skipped and, unlike GetTile, no neighbours are
+// prefetched. Downloads share the cache's concurrency limit and stop when
+// ctx is cancelled; it returns once all are done, with the number of tiles
+// now cached. A malformed manifest fetches nothing.
+func (tc *TileCache) ImportManifest(ctx context.Context, r io.Reader) (int, error) {
+	var coords []tiles.TileCoord
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		coord, err := parseTilePath(text, "")
+		if err != nil {
+			return 0, fmt.Errorf("manifest line %d: %w", line, err)
+		}
+		coords = append(coords, coord)
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	// One worker per download slot; fetchTile waits on the shared limiter
+	return tc.fetchAll(ctx, coords, cap(tc.sem), nil)
+}
@@ -0,0 +1,102 @@
+package tileserver
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"mapviewer/pkg/tiles"
+)
+
+// A manifest exported from one cache fills another with the same tiles,
+// without queueing prefetch work for their neighbours
+func TestManifestRoundTrip(t *testing.T) {
+	var srcHits, dstHits atomic.Int32
+	src, _ := newTestCache(t, 0, countingHandler(&srcHits))
+	dst, dstDir := newTestCache(t, 0, countingHandler(&dstHits))
+
+	coords := []tiles.TileCoord{
+		{X: 3, Y: 1, Zoom: 2},
+		{X: 0, Y: 0, Zoom: 0},
+		{X: 1, Y: 2, Zoom: 2},
+		{X: 4, Y: 5, Zoom: 3},
+	}
+	for _, coord := range coords {
+		if _, err := src.GetTile(coord); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var manifest bytes.Buffer
+	if err := src.ExportManifest(&manifest); err != nil {
+		t.Fatal(err)
+	}
+	want := "0/0/0\n2/1/2\n2/3/1\n3/4/5\n"
+	if manifest.String() != want {
+		t.Fatalf("manifest:\n%s\nwant:\n%s", manifest.String(), want)
+	}
+
+	input := "# exported tiles\n\n" + manifest.String()
+	n, err := dst.ImportManifest(context.Background(), strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(coords) {
+		t.Errorf("imported %d tiles, want %d", n, len(coords))
+	}
+	if got := dstHits.Load(); got != int32(len(coords)) {
+		t.Errorf("%d upstream requests, want %d", got, len(coords))
+	}
+	if queued := len(dst.fetchQueue); queued != 0 {
+		t.Errorf("import queued %d prefetches", queued)
+	}
+	for _, coord := range coords {
+		if _, err := os.Stat(dst.cachedPath(coord)); err != nil {
+			t.Errorf("%s not cached in %s: %v", coord.String(), dstDir, err)
+		}
+	}
+
+	var exported bytes.Buffer
+	if err := dst.ExportManifest(&exported); err != nil {
+		t.Fatal(err)
+	}
+	if exported.String() != want {
+		t.Errorf("re-exported manifest:\n%s\nwant:\n%s", exported.String(), want)
+	}
+
+	// Importing again finds every tile fresh on disk
+	if n, err := dst.ImportManifest(context.Background(), strings.NewReader(input)); err != nil || n != len(coords) {
+		t.Errorf("second import: %d tiles, %v", n, err)
+	}
+	if got := dstHits.Load(); got != int32(len(coords)) {
+		t.Errorf("second import made %d more requests", got-int32(len(coords)))
+	}
+}
+
+func TestImportManifestMalformed(t *testing.T) {
+	for _, manifest := range []string{"1/2", "1/0/0\nz/0/0", "3/x/1", "2/1/y.png"} {
+		var hits atomic.Int32
+		tc, _ := newTestCache(t, 0, countingHandler(&hits))
+		if n, err := tc.ImportManifest(context.Background(), strings.NewReader(manifest)); err == nil {
+			t.Errorf("%q: imported %d tiles, want an error", manifest, n)
+		}
+		if got := hits.Load(); got != 0 {
+			t.Errorf("%q: %d tiles fetched from a malformed manifest", manifest, got)
+		}
+	}
+}
+
+func TestImportManifestCancelled(t *testing.T) {
+	var hits atomic.Int32
+	tc, _ := newTestCache(t, 0, countingHandler(&hits))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := tc.ImportManifest(ctx, strings.NewReader("1/0/0\n1/1/0\n1/0/1\n1/1/1\n"))
+	if err != context.Canceled {
+		t.Errorf("err %v, want %v", err, context.Canceled)
+	}
+}
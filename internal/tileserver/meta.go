@@ -0,0 +1,63 @@
+package tileserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+
+	"mapviewer/internal/atomicfile"
+)
+
+// metaSuffix is appended to a tile path to get its sidecar metadata file
+const metaSuffix = ".meta"
+
+// tileMeta holds upstream validators used for conditional re-fetches
+type tileMeta struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// readMeta loads the sidecar metadata for a cached tile, if any
+func readMeta(tilePath string) (tileMeta, bool) {
+	var meta tileMeta
+	data, err := os.ReadFile(tilePath + metaSuffix)
+	if err != nil {
+		return meta, false
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, false
+	}
+	return meta, meta.ETag != "" || meta.LastModified != ""
+}
+
+// writeMeta stores the validators from a response next to the cached tile.
+// Any stale sidecar is removed when the response carries no validators.
+func writeMeta(tilePath string, header http.Header) error {
+	meta := tileMeta{
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+	}
+	if meta.ETag == "" && meta.LastModified == "" {
+		err := os.Remove(tilePath + metaSuffix)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return atomicfile.Write(tilePath+metaSuffix, data)
+}
+
+// setConditionalHeaders adds If-None-Match / If-Modified-Since from meta
+func (m tileMeta) setConditionalHeaders(req *http.Request) {
+	if m.ETag != "" {
+		req.Header.Set("If-None-Match", m.ETag)
+	}
+	if m.LastModified != "" {
+		req.Header.Set("If-Modified-Since", m.LastModified)
+	}
+}
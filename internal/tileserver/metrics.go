@@ -0,0 +1,69 @@
+package tileserver
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// fetchDurationBuckets are the upper bounds, in seconds, of the upstream
+// fetch duration histogram
+var fetchDurationBuckets = [...]float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// durationHistogram is a lock-free Prometheus-style histogram
+type durationHistogram struct {
+	buckets [len(fetchDurationBuckets)]atomic.Int64
+	count   atomic.Int64
+	sumNs   atomic.Int64
+}
+
+// observe records one duration
+func (h *durationHistogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	for i, le := range fetchDurationBuckets {
+		if seconds <= le {
+			h.buckets[i].Add(1)
+			break
+		}
+	}
+	h.count.Add(1)
+	h.sumNs.Add(int64(d))
+}
+
+// write prints the histogram in Prometheus text format. Buckets are stored
+// non-cumulatively and summed here.
+func (h *durationHistogram) write(w io.Writer, name, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+	var cumulative int64
+	for i, le := range fetchDurationBuckets {
+		cumulative += h.buckets[i].Load()
+		fmt.Fprintf(w, "%s_bucket{le=\"%g\"} %d\n", name, le, cumulative)
+	}
+	count := h.count.Load()
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", name, count)
+	fmt.Fprintf(w, "%s_sum %g\n", name, time.Duration(h.sumNs.Load()).Seconds())
+	fmt.Fprintf(w, "%s_count %d\n", name, count)
+}
+
+// writeMetric prints a single counter or gauge in Prometheus text format
+func writeMetric(w io.Writer, name, kind, help string, value int64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", name, help, name, kind, name, value)
+}
+
+// handleMetrics exposes the server and cache counters for Prometheus
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+	stats := s.cache.Stats()
+	writeMetric(w, "tile_requests_total", "counter", "Tile requests received by the server.", s.requests.Load())
+	writeMetric(w, "tile_cache_hits_total", "counter", "Tiles served fresh from the disk cache.", stats.Hits)
+	writeMetric(w, "tile_cache_misses_total", "counter", "Tiles that had to be fetched.", stats.Misses)
+	writeMetric(w, "tile_fetches_total", "counter", "Upstream tile requests sent.", stats.Fetches)
+	writeMetric(w, "tile_fetch_errors_total", "counter", "Upstream tile requests that failed.", stats.FetchErrors)
+	writeMetric(w, "tile_downloaded_bytes_total", "counter", "Tile bytes received from upstream.", stats.BytesDownloaded)
+	writeMetric(w, "tile_fetches_in_flight", "gauge", "Upstream tile requests in progress.", s.cache.stats.inFlight.Load())
+	writeMetric(w, "tile_cache_disk_bytes", "gauge", "Current size of the disk cache.", stats.DiskBytes)
+	s.cache.stats.fetchDuration.write(w, "tile_fetch_duration_seconds", "Upstream tile fetch latency.")
+}
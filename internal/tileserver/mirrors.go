@@ -0,0 +1,79 @@
+package tileserver
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"mapviewer/pkg/tiles"
+)
+
+const (
+	// mirrorFailureThreshold consecutive failures mark a mirror unhealthy
+	mirrorFailureThreshold = 3
+
+	// mirrorCooldown is how long an unhealthy mirror is tried last
+	mirrorCooldown = 30 * time.Second
+)
+
+// mirror is one upstream URL template with its health record
+type mirror struct {
+	template    string
+	failures    int // consecutive failures
+	lastFailure time.Time
+}
+
+// mirrorSet tracks mirror health and orders mirrors by preference
+type mirrorSet struct {
+	mu      sync.Mutex
+	mirrors []*mirror
+}
+
+func newMirrorSet(templates []string) (*mirrorSet, error) {
+	ms := &mirrorSet{mirrors: make([]*mirror, 0, len(templates))}
+	for _, t := range templates {
+		if err := tiles.ValidateURLTemplate(t); err != nil {
+			return nil, fmt.Errorf("invalid mirror: %w", err)
+		}
+		ms.mirrors = append(ms.mirrors, &mirror{template: t})
+	}
+	return ms, nil
+}
+
+// ordered returns mirrors healthiest first; configured order breaks ties
+func (ms *mirrorSet) ordered() []*mirror {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	now := time.Now()
+	healthy := func(m *mirror) bool {
+		return m.failures < mirrorFailureThreshold || now.Sub(m.lastFailure) > mirrorCooldown
+	}
+
+	out := make([]*mirror, len(ms.mirrors))
+	copy(out, ms.mirrors)
+	sort.SliceStable(out, func(i, j int) bool {
+		hi, hj := healthy(out[i]), healthy(out[j])
+		if hi != hj {
+			return hi
+		}
+		return out[i].failures < out[j].failures
+	})
+	return out
+}
+
+// recordSuccess resets a mirror's failure count
+func (ms *mirrorSet) recordSuccess(m *mirror) {
+	ms.mu.Lock()
+	m.failures = 0
+	ms.mu.Unlock()
+}
+
+// recordFailure counts a failed request against a mirror
+func (ms *mirrorSet) recordFailure(m *mirror) {
+	ms.mu.Lock()
+	m.failures++
+	m.lastFailure = time.Now()
+	ms.mu.Unlock()
+}
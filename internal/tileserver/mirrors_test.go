@@ -0,0 +1,84 @@
+package tileserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mapviewer/pkg/tiles"
+)
+
+// With one mirror always failing, tiles fall back to the working one, which
+// is tried first from then on since it has fewer failures
+func TestMirrorFailover(t *testing.T) {
+	var goodHits, badHits atomic.Int32
+	tc, _ := newTestCache(t, 0, countingHandler(&goodHits))
+	good := tc.mirrors.mirrors[0].template
+
+	bad := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		badHits.Add(1)
+		http.Error(w, "down", http.StatusInternalServerError)
+	}))
+	defer bad.Close()
+	badTemplate := bad.URL + "/{z}/{x}/{y}.png"
+	if err := tc.SetMirrors(badTemplate, good); err != nil {
+		t.Fatal(err)
+	}
+
+	const n = 5
+	for x := 0; x < n; x++ {
+		data, err := tc.GetTile(tiles.TileCoord{X: x, Y: 0, Zoom: 4})
+		if err != nil {
+			t.Fatalf("tile %d: %v", x, err)
+		}
+		if string(data) != string(pngTile) {
+			t.Fatalf("tile %d: got %q", x, data)
+		}
+	}
+
+	if got := goodHits.Load(); got != n {
+		t.Errorf("working mirror served %d tiles, want %d", got, n)
+	}
+	if got := badHits.Load(); got != 1 {
+		t.Errorf("failing mirror tried %d times, want only the first", got)
+	}
+	if first := tc.mirrors.ordered()[0].template; first != good {
+		t.Errorf("preferred mirror %s, want the working %s", first, good)
+	}
+}
+
+func TestMirrorOrder(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name     string
+		failures []int
+		ago      []time.Duration // since each mirror's last failure
+		want     []int           // mirror indices, preferred first
+	}{
+		{"all healthy keep config order", []int{0, 0, 0}, []time.Duration{0, 0, 0}, []int{0, 1, 2}},
+		{"fewer failures first", []int{2, 1, 0}, []time.Duration{0, 0, 0}, []int{2, 1, 0}},
+		{"unhealthy last", []int{mirrorFailureThreshold, mirrorFailureThreshold + 5, 0}, []time.Duration{0, 0, 0}, []int{2, 0, 1}},
+		{"cooled down is healthy again", []int{mirrorFailureThreshold, mirrorFailureThreshold + 1, mirrorFailureThreshold}, []time.Duration{2 * mirrorCooldown, 0, 0}, []int{0, 2, 1}},
+	}
+	for _, tt := range tests {
+		ms, err := newMirrorSet([]string{"https://a/{z}/{x}/{y}.png", "https://b/{z}/{x}/{y}.png", "https://c/{z}/{x}/{y}.png"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, m := range ms.mirrors {
+			m.failures = tt.failures[i]
+			m.lastFailure = now.Add(-tt.ago[i])
+		}
+
+		var got []int
+		for _, m := range ms.ordered() {
+			got = append(got, slices.Index(ms.mirrors, m))
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%s: order %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,148 @@
+package tileserver
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"mapviewer/internal/logging"
+	"mapviewer/pkg/tiles"
+)
+
+// MaxRegionTiles bounds a single DownloadRegion call. Tile counts grow 4x per
+// zoom level, so a city at zoom 18 is already hundreds of thousands of tiles.
+const MaxRegionTiles = 100000
+
+// RegionTileCount returns how many tiles cover the box across the zoom range
+func RegionTileCount(minLat, minLon, maxLat, maxLon float64, minZoom, maxZoom int) int {
+	total := 0
+	for z := minZoom; z <= maxZoom; z++ {
+		for _, r := range regionRanges(minLat, minLon, maxLat, maxLon, z) {
+			total += (r.bottomRight.X - r.topLeft.X + 1) * (r.bottomRight.Y - r.topLeft.Y + 1)
+		}
+	}
+	return total
+}
+
+// tileRange is a rectangle of tiles between two corners, both included
+type tileRange struct {
+	topLeft, bottomRight tiles.TileCoord
+}
+
+// regionRanges returns the tiles covering a box at zoom. A box whose minLon
+// is east of its maxLon crosses the antimeridian; it is split into the
+// columns from minLon to the east edge of the map and from the west edge to
+// maxLon.
+func regionRanges(minLat, minLon, maxLat, maxLon float64, zoom int) []tileRange {
+	if minLat > maxLat {
+		minLat, maxLat = maxLat, minLat
+	}
+	if minLon <= maxLon {
+		return []tileRange{{tiles.LatLonToTile(maxLat, minLon, zoom), tiles.LatLonToTile(minLat, maxLon, zoom)}}
+	}
+
+	east := tileRange{tiles.LatLonToTile(maxLat, minLon, zoom), tiles.LatLonToTile(minLat, 180, zoom)}
+	west := tileRange{tiles.LatLonToTile(maxLat, -180, zoom), tiles.LatLonToTile(minLat, maxLon, zoom)}
+	if west.bottomRight.X >= east.topLeft.X {
+		// At low zooms the halves share a column, so the box spans them all
+		west.bottomRight.X = east.bottomRight.X
+		return []tileRange{west}
+	}
+	return []tileRange{east, west}
+}
+
+// DownloadRegion fetches every tile in the box across the zoom range into the
+// disk cache for offline use. A box with minLon east of maxLon crosses the
+// antimeridian. Tiles already cached and fresh are skipped.
+// progress (may be nil) is called after each tile, never concurrently.
+// Downloads share the cache's concurrency limit and stop when ctx is
+// cancelled. Failed tiles don't stop the download; they are reported in the
+// returned error.
+func (tc *TileCache) DownloadRegion(ctx context.Context, minLat, minLon, maxLat, maxLon float64, minZoom, maxZoom int, progress func(done, total int)) error {
+	if minZoom < 0 || minZoom > maxZoom {
+		return fmt.Errorf("invalid zoom range %d-%d", minZoom, maxZoom)
+	}
+
+	total := RegionTileCount(minLat, minLon, maxLat, maxLon, minZoom, maxZoom)
+	if total > MaxRegionTiles {
+		return fmt.Errorf("region needs %d tiles at zoom %d-%d (max %d); shrink the box or lower the max zoom", total, minZoom, maxZoom, MaxRegionTiles)
+	}
+	logging.Infof("Downloading region: %d tiles at zoom %d-%d", total, minZoom, maxZoom)
+
+	coords := make([]tiles.TileCoord, 0, total)
+	for z := minZoom; z <= maxZoom; z++ {
+		for _, r := range regionRanges(minLat, minLon, maxLat, maxLon, z) {
+			for y := r.topLeft.Y; y <= r.bottomRight.Y; y++ {
+				for x := r.topLeft.X; x <= r.bottomRight.X; x++ {
+					coords = append(coords, tiles.TileCoord{X: x, Y: y, Zoom: z})
+				}
+			}
+		}
+	}
+
+	// One worker per download slot; fetchTile waits on the shared limiter
+	_, err := tc.fetchAll(ctx, coords, cap(tc.sem), progress)
+	return err
+}
+
+// fetchAll fetches coords with the given number of workers and returns how
+// many are now cached. progress (may be nil) is called after each tile,
+// never concurrently. Tiles still queued when ctx is cancelled are skipped.
+// Failed tiles don't stop the others; they are reported in the returned
+// error.
+func (tc *TileCache) fetchAll(ctx context.Context, coords []tiles.TileCoord, workers int, progress func(done, total int)) (int, error) {
+	queue := make(chan tiles.TileCoord)
+	go func() {
+		defer close(queue)
+		for _, coord := range coords {
+			select {
+			case queue <- coord:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var (
+		mu       sync.Mutex
+		done     int
+		fetched  int
+		failed   int
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for coord := range queue {
+				_, err := tc.fetchTile(ctx, coord)
+
+				mu.Lock()
+				done++
+				switch {
+				case err == nil:
+					fetched++
+				case ctx.Err() == nil:
+					if failed == 0 {
+						firstErr = fmt.Errorf("tile %s: %w", coord.String(), err)
+					}
+					failed++
+				}
+				if progress != nil {
+					progress(done, len(coords))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return fetched, err
+	}
+	if failed > 0 {
+		return fetched, fmt.Errorf("%d of %d tiles failed, first: %w", failed, len(coords), firstErr)
+	}
+	return fetched, nil
+}
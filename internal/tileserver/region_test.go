@@ -0,0 +1,113 @@
+package tileserver
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"mapviewer/pkg/tiles"
+)
+
+func TestRegionTileCount(t *testing.T) {
+	tests := []struct {
+		name                           string
+		minLat, minLon, maxLat, maxLon float64
+		minZoom, maxZoom               int
+		want                           int
+	}{
+		{"one tile", 52, 4, 53, 5, 4, 4, 1},
+		{"corners swapped", 53, 4, 52, 5, 4, 4, 1},
+		{"across the map", -19, -178, -16, 177, 4, 4, 16},
+		{"across the antimeridian", -19, 177, -16, -178, 4, 4, 2},
+		{"antimeridian at low zoom", -19, 10, -16, -10, 0, 1, 1 + 2},
+		{"antimeridian halves sharing a column", -19, 100, -16, 90, 2, 2, 4},
+	}
+	for _, tt := range tests {
+		got := RegionTileCount(tt.minLat, tt.minLon, tt.maxLat, tt.maxLon, tt.minZoom, tt.maxZoom)
+		if got != tt.want {
+			t.Errorf("%s: %d tiles, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+// A box across the antimeridian fetches the columns at both map edges and
+// nothing in between
+func TestDownloadRegionAntimeridian(t *testing.T) {
+	var mu sync.Mutex
+	var fetched []string
+	tc, _ := newTestCache(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		fetched = append(fetched, r.URL.Path)
+		mu.Unlock()
+		w.Write(pngTile)
+	})
+
+	// Fiji
+	if err := tc.DownloadRegion(context.Background(), -19, 177, -16, -178, 3, 4, nil); err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(fetched)
+	want := []string{"/3/0/4.png", "/3/7/4.png", "/4/0/8.png", "/4/15/8.png"}
+	if !slices.Equal(fetched, want) {
+		t.Errorf("fetched %v, want %v", fetched, want)
+	}
+}
+
+// Failed tiles are counted and reported without stopping the rest, and
+// progress sees every tile once
+func TestFetchAll(t *testing.T) {
+	var hits atomic.Int32
+	tc, _ := newTestCache(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/2/3/") {
+			http.Error(w, "down", http.StatusInternalServerError)
+			return
+		}
+		countingHandler(&hits)(w, r)
+	})
+
+	var coords []tiles.TileCoord
+	for y := 0; y < 4; y++ {
+		for x := 0; x < 4; x++ {
+			coords = append(coords, tiles.TileCoord{X: x, Y: y, Zoom: 2})
+		}
+	}
+	var calls []int
+	fetched, err := tc.fetchAll(context.Background(), coords, 3, func(done, total int) {
+		if total != len(coords) {
+			t.Errorf("progress total %d, want %d", total, len(coords))
+		}
+		calls = append(calls, done)
+	})
+
+	if fetched != 12 || hits.Load() != 12 {
+		t.Errorf("fetched %d tiles with %d upstream requests, want 12", fetched, hits.Load())
+	}
+	if err == nil || !strings.HasPrefix(err.Error(), "4 of 16 tiles failed") {
+		t.Errorf("error %v, want the 4 failed tiles reported", err)
+	}
+	for i, done := range calls {
+		if done != i+1 {
+			t.Fatalf("progress %v, want 1 to %d in order", calls, len(coords))
+		}
+	}
+	if len(calls) != len(coords) {
+		t.Errorf("%d progress calls, want %d", len(calls), len(coords))
+	}
+}
+
+func TestFetchAllCancelled(t *testing.T) {
+	var hits atomic.Int32
+	tc, _ := newTestCache(t, 0, countingHandler(&hits))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	coords := []tiles.TileCoord{{X: 0, Y: 0, Zoom: 1}, {X: 1, Y: 0, Zoom: 1}}
+	if _, err := tc.fetchAll(ctx, coords, 2, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("error %v, want context.Canceled", err)
+	}
+}
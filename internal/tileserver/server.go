@@ -1,95 +1,173 @@
 package tileserver
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"path"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"mapviewer/internal/logging"
+	"mapviewer/internal/vectortile"
 	"mapviewer/pkg/tiles"
 )
 
 // Server provides HTTP endpoints for tile fetching
 type Server struct {
-	cache  *TileCache
-	port   int
-	server *http.Server
+	cache       *TileCache
+	vectorCache *vectortile.VectorTileCache
+	port        int
+	server      *http.Server
+
+	// AllowedOrigins lists browser origins that may call /tile, /vector and
+	// /health cross-origin ("*" = any). Empty = same-origin only. Set it
+	// before Start.
+	AllowedOrigins []string
+
+	// Tile requests received, for /metrics
+	requests atomic.Int64
 }
 
-// NewServer creates a new tile server
-func NewServer(cache *TileCache, port int) *Server {
-	return &Server{
-		cache: cache,
-		port:  port,
+// NewServer creates a new tile server. vectorCache may be nil, which
+// disables the /vector endpoint.
+func NewServer(cache *TileCache, vectorCache *vectortile.VectorTileCache, port int) *Server {
+	s := &Server{
+		cache:       cache,
+		vectorCache: vectorCache,
+		port:        port,
 	}
-}
 
-// Start starts the tile server
-func (s *Server) Start() error {
 	mux := http.NewServeMux()
-	mux.HandleFunc("/tile/", s.handleTile)
+	mux.HandleFunc("/tile/", s.withCORS(s.handleTile))
+	if s.vectorCache != nil {
+		mux.HandleFunc("/vector/", s.withCORS(s.handleVector))
+	}
 	mux.HandleFunc("/prefetch", s.handlePrefetch)
-	mux.HandleFunc("/health", s.handleHealth)
+	mux.HandleFunc("/health", s.withCORS(s.handleHealth))
+	mux.HandleFunc("/stats", s.handleStats)
+	mux.HandleFunc("/metrics", s.handleMetrics)
 
+	// Created here rather than in Start so Stop, called from another
+	// goroutine, never sees it unset
 	s.server = &http.Server{
-		Addr:    fmt.Sprintf(":%d", s.port),
-		Handler: mux,
+		Addr:    fmt.Sprintf(":%d", port),
+		Handler: withGzip(mux),
 	}
+	return s
+}
 
-	fmt.Printf("Tile server starting on port %d\n", s.port)
-	return s.server.ListenAndServe()
+// Start starts the tile server and blocks until it fails or Stop is called
+func (s *Server) Start() error {
+	logging.Infof("Tile server starting on port %d", s.port)
+	if err := s.server.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
 }
 
-// Stop stops the tile server
+// ShutdownTimeout is how long Stop waits for in-flight responses to finish
+const ShutdownTimeout = 10 * time.Second
+
+// Stop stops accepting connections and waits up to ShutdownTimeout for
+// active requests to complete before closing the rest. If Stop runs before
+// Start, Start returns immediately.
 func (s *Server) Stop() error {
-	if s.server != nil {
-		return s.server.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.server.Close()
+		return fmt.Errorf("tile server shutdown: %w", err)
 	}
 	return nil
 }
 
 // handleTile serves tile requests: /tile/{zoom}/{x}/{y}
 func (s *Server) handleTile(w http.ResponseWriter, r *http.Request) {
-	// Parse path: /tile/zoom/x/y
-	path := strings.TrimPrefix(r.URL.Path, "/tile/")
-	parts := strings.Split(path, "/")
+	s.requests.Add(1)
 
-	if len(parts) != 3 {
-		http.Error(w, "Invalid tile path", http.StatusBadRequest)
+	coord, err := parseTilePath(r.URL.Path, "/tile/")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
-
-	zoom, err := strconv.Atoi(parts[0])
-	if err != nil {
-		http.Error(w, "Invalid zoom", http.StatusBadRequest)
+	if !coord.Valid() {
+		http.Error(w, fmt.Sprintf("Tile %s is outside the zoom 0-%d grid", coord.String(), tiles.MaxTileZoom), http.StatusBadRequest)
 		return
 	}
 
-	x, err := strconv.Atoi(parts[1])
+	data, err := s.cache.GetTile(coord)
+	if errors.Is(err, ErrTileNotFound) {
+		http.Error(w, "Tile not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		http.Error(w, "Invalid x", http.StatusBadRequest)
+		http.Error(w, fmt.Sprintf("Failed to get tile: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Remove .png extension if present
-	yStr := strings.TrimSuffix(parts[2], ".png")
-	y, err := strconv.Atoi(yStr)
+	w.Header().Set("Content-Type", http.DetectContentType(data))
+	w.Header().Set("Cache-Control", "max-age=86400") // Cache for 24 hours
+	w.Write(data)
+}
+
+// handleVector serves a vector tile's features as GeoJSON:
+// /vector/{zoom}/{x}/{y}.json
+func (s *Server) handleVector(w http.ResponseWriter, r *http.Request) {
+	coord, err := parseTilePath(r.URL.Path, "/vector/")
 	if err != nil {
-		http.Error(w, "Invalid y", http.StatusBadRequest)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !coord.Valid() || coord.Zoom > vectortile.MaxTileZoom {
+		http.Error(w, fmt.Sprintf("Tile %s is outside the zoom 0-%d grid", coord.String(), vectortile.MaxTileZoom), http.StatusBadRequest)
 		return
 	}
 
-	coord := tiles.TileCoord{X: x, Y: y, Zoom: zoom}
-	data, err := s.cache.GetTile(coord)
+	data, err := s.vectorCache.GetTileCtx(r.Context(), coord.Zoom, coord.X, coord.Y)
+	if errors.Is(err, vectortile.ErrTileNotFound) {
+		http.Error(w, "Vector tile not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get tile: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Failed to get vector tile: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Content-Type", "application/geo+json")
 	w.Header().Set("Cache-Control", "max-age=86400") // Cache for 24 hours
-	w.Write(data)
+	json.NewEncoder(w).Encode(data.ToGeoJSON())
+}
+
+// parseTilePath parses "{prefix}{zoom}/{x}/{y}[.ext]"
+func parseTilePath(urlPath, prefix string) (tiles.TileCoord, error) {
+	parts := strings.Split(strings.TrimPrefix(urlPath, prefix), "/")
+	if len(parts) != 3 {
+		return tiles.TileCoord{}, fmt.Errorf("Invalid tile path")
+	}
+
+	zoom, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return tiles.TileCoord{}, fmt.Errorf("Invalid zoom")
+	}
+
+	x, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return tiles.TileCoord{}, fmt.Errorf("Invalid x")
+	}
+
+	// Remove extension if present
+	yStr := strings.TrimSuffix(parts[2], path.Ext(parts[2]))
+	y, err := strconv.Atoi(yStr)
+	if err != nil {
+		return tiles.TileCoord{}, fmt.Errorf("Invalid y")
+	}
+
+	return tiles.TileCoord{X: x, Y: y, Zoom: zoom}, nil
 }
 
 // PrefetchRequest represents a prefetch request
@@ -126,3 +204,9 @@ func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.Write([]byte(`{"status":"ok"}`))
 }
+
+// handleStats reports the tile cache counters as JSON
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.cache.Stats())
+}
@@ -0,0 +1,168 @@
+package tileserver
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mapviewer/internal/vectortile"
+	"mapviewer/pkg/tiles"
+)
+
+func TestHandleTile(t *testing.T) {
+	var hits atomic.Int32
+	tc, _ := newTestCache(t, 0, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/3/0/0.png" {
+			http.NotFound(w, r)
+			return
+		}
+		countingHandler(&hits)(w, r)
+	})
+	srv := httptest.NewServer(http.HandlerFunc(NewServer(tc, nil, 0).handleTile))
+	defer srv.Close()
+
+	tests := []struct {
+		path        string
+		wantStatus  int
+		wantFetches int32 // upstream requests expected for this path
+	}{
+		{"/tile/2/1/1", http.StatusOK, 1},
+		{"/tile/2/1/1", http.StatusOK, 0}, // now cached
+		{"/tile/2/4/0", http.StatusBadRequest, 0},
+		{"/tile/2/0/-1", http.StatusBadRequest, 0},
+		{"/tile/-1/0/0", http.StatusBadRequest, 0},
+		{"/tile/31/0/0", http.StatusBadRequest, 0},
+		{"/tile/2/1", http.StatusBadRequest, 0},
+		{"/tile/a/b/c", http.StatusBadRequest, 0},
+		{"/tile/3/0/0", http.StatusNotFound, 0},
+	}
+	for _, tt := range tests {
+		before := hits.Load()
+		resp, err := srv.Client().Get(srv.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d", tt.path, resp.StatusCode, tt.wantStatus)
+		}
+		if got := hits.Load() - before; got != tt.wantFetches {
+			t.Errorf("%s: %d upstream requests, want %d", tt.path, got, tt.wantFetches)
+		}
+	}
+}
+
+func TestHandleVector(t *testing.T) {
+	fixture, err := os.ReadFile("../vectortile/testdata/amsterdam_12_2103_1346.pbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var hits atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/12/2103/1346.pbf":
+			w.Write(fixture)
+		case "/12/0/0.pbf":
+			http.Error(w, "down", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer upstream.Close()
+
+	vc, err := vectortile.NewVectorTileCache("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vc.Close()
+	vc.SetHTTPClient(upstream.Client())
+	vc.SetRetryPolicy(noRetry)
+	if err := vc.SetURLTemplate(upstream.URL + "/{z}/{x}/{y}.pbf"); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(NewServer(nil, vc, 0).handleVector))
+	defer srv.Close()
+
+	tests := []struct {
+		path        string
+		wantStatus  int
+		wantFetches int32 // upstream requests expected for this path
+	}{
+		{"/vector/12/2103/1346.json", http.StatusOK, 1},
+		{"/vector/12/2103/1346.json", http.StatusOK, 0}, // now cached
+		{"/vector/12/2103/1347.json", http.StatusNotFound, 1},
+		{"/vector/12/0/0.json", http.StatusInternalServerError, 1},
+		{"/vector/2/4/0.json", http.StatusBadRequest, 0},
+		{"/vector/2/0/-1.json", http.StatusBadRequest, 0},
+		{"/vector/-1/0/0.json", http.StatusBadRequest, 0},
+		{"/vector/15/0/0.json", http.StatusBadRequest, 0},
+		{"/vector/2/1", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		before := hits.Load()
+		resp, err := srv.Client().Get(srv.URL + tt.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.wantStatus {
+			t.Errorf("%s: status %d, want %d", tt.path, resp.StatusCode, tt.wantStatus)
+		}
+		if got := hits.Load() - before; got != tt.wantFetches {
+			t.Errorf("%s: %d upstream requests, want %d", tt.path, got, tt.wantFetches)
+		}
+	}
+}
+
+// Invalid coordinates are rejected before any network traffic
+func TestGetTileInvalid(t *testing.T) {
+	var hits atomic.Int32
+	tc, _ := newTestCache(t, 0, countingHandler(&hits))
+
+	for _, coord := range []tiles.TileCoord{
+		{X: 8, Y: 0, Zoom: 3},
+		{X: 0, Y: -1, Zoom: 3},
+		{X: 0, Y: 0, Zoom: tiles.MaxTileZoom + 1},
+	} {
+		if _, err := tc.GetTile(coord); !errors.Is(err, ErrInvalidTile) {
+			t.Errorf("GetTile(%v) = %v, want ErrInvalidTile", coord, err)
+		}
+	}
+	if hits.Load() != 0 {
+		t.Errorf("%d upstream requests for invalid tiles", hits.Load())
+	}
+}
+
+// Stop ends Start however the two race, including a signal arriving
+// before Start has run
+func TestStopStart(t *testing.T) {
+	for _, stopFirst := range []bool{true, false} {
+		s := NewServer(nil, nil, 0)
+		errCh := make(chan error, 1)
+		if stopFirst {
+			if err := s.Stop(); err != nil {
+				t.Fatal(err)
+			}
+			go func() { errCh <- s.Start() }()
+		} else {
+			go func() { errCh <- s.Start() }()
+			if err := s.Stop(); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		select {
+		case err := <-errCh:
+			if err != nil {
+				t.Errorf("stop first %v: Start returned %v", stopFirst, err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("stop first %v: Start still running after Stop", stopFirst)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package tileserver
+
+import (
+	"context"
+
+	"mapviewer/pkg/tiles"
+)
+
+// Source supplies tile images from somewhere other than the network, such as
+// an MBTiles file
+type Source interface {
+	FetchTile(ctx context.Context, coord tiles.TileCoord) ([]byte, error)
+	Close() error
+}
+
+// SetSource serves tiles from src instead of downloading them. Local sources
+// are already on disk, so the tile cache directory is bypassed. The cache
+// takes ownership and closes src on Close.
+func (tc *TileCache) SetSource(src Source) {
+	tc.sourceMu.Lock()
+	defer tc.sourceMu.Unlock()
+	if tc.source != nil {
+		tc.source.Close()
+	}
+	tc.source = src
+}
+
+// localSource returns the configured Source, or nil for the network
+func (tc *TileCache) localSource() Source {
+	tc.sourceMu.RLock()
+	defer tc.sourceMu.RUnlock()
+	return tc.source
+}
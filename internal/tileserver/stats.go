@@ -0,0 +1,38 @@
+package tileserver
+
+import "sync/atomic"
+
+// Stats is a snapshot of the tile cache's counters
+type Stats struct {
+	Hits            int64 `json:"hits"`             // GetTile served fresh from disk
+	Misses          int64 `json:"misses"`           // GetTile had to fetch
+	Fetches         int64 `json:"fetches"`          // Upstream requests sent
+	FetchErrors     int64 `json:"fetch_errors"`     // Upstream requests that failed
+	BytesDownloaded int64 `json:"bytes_downloaded"` // Tile bytes received
+	DiskBytes       int64 `json:"disk_bytes"`       // Current disk cache size
+}
+
+// cacheStats holds the live counters; atomics keep the hot path lock-free
+type cacheStats struct {
+	hits            atomic.Int64
+	misses          atomic.Int64
+	fetches         atomic.Int64
+	fetchErrors     atomic.Int64
+	bytesDownloaded atomic.Int64
+
+	// Exported only as Prometheus metrics
+	inFlight      atomic.Int64
+	fetchDuration durationHistogram
+}
+
+// Stats returns the current counters
+func (tc *TileCache) Stats() Stats {
+	return Stats{
+		Hits:            tc.stats.hits.Load(),
+		Misses:          tc.stats.misses.Load(),
+		Fetches:         tc.stats.fetches.Load(),
+		FetchErrors:     tc.stats.fetchErrors.Load(),
+		BytesDownloaded: tc.stats.bytesDownloaded.Load(),
+		DiskBytes:       tc.Size(),
+	}
+}
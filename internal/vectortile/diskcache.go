@@ -0,0 +1,83 @@
+package vectortile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mapviewer/internal/atomicfile"
+)
+
+// diskPath returns the file path for a cached raw tile, or "" if disk
+// caching is disabled
+func (vtc *VectorTileCache) diskPath(z, x, y int) string {
+	if vtc.cacheDir == "" {
+		return ""
+	}
+	return filepath.Join(vtc.cacheDir, fmt.Sprintf("%d_%d_%d.pbf.gz", z, x, y))
+}
+
+// readDisk returns the raw MVT bytes for a tile from the disk cache
+func (vtc *VectorTileCache) readDisk(z, x, y int) ([]byte, error) {
+	path := vtc.diskPath(z, x, y)
+	if path == "" {
+		return nil, os.ErrNotExist
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	return io.ReadAll(gz)
+}
+
+// writeDisk stores raw MVT bytes for a tile gzipped in the disk cache
+func (vtc *VectorTileCache) writeDisk(z, x, y int, raw []byte) error {
+	path := vtc.diskPath(z, x, y)
+	if path == "" {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if _, err := gz.Write(raw); err != nil {
+		return err
+	}
+	if err := gz.Close(); err != nil {
+		return err
+	}
+
+	return atomicfile.Write(path, buf.Bytes())
+}
+
+// removeTempFiles deletes writes interrupted by a crash from a disk cache
+func removeTempFiles(dir string) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), atomicfile.TempPrefix) {
+			os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+}
+
+// removeDisk deletes a tile from the disk cache
+func (vtc *VectorTileCache) removeDisk(z, x, y int) {
+	if path := vtc.diskPath(z, x, y); path != "" {
+		os.Remove(path)
+	}
+}
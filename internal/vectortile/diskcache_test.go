@@ -0,0 +1,54 @@
+package vectortile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mapviewer/internal/atomicfile"
+)
+
+// Tiles written to disk read back whole, with no temp files left over, and
+// leftovers from an interrupted write are removed when the cache opens
+func TestDiskCache(t *testing.T) {
+	dir := t.TempDir()
+	leftover := filepath.Join(dir, atomicfile.TempPrefix+"12345")
+	if err := os.WriteFile(leftover, []byte("half a ti"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	vtc, err := NewVectorTileCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer vtc.Close()
+	if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+		t.Errorf("leftover temp file still present: %v", err)
+	}
+
+	raw := bytes.Repeat([]byte("mvt"), 1000)
+	for _, data := range [][]byte{raw, raw[:10]} {
+		if err := vtc.writeDisk(12, 2103, 1346, data); err != nil {
+			t.Fatal(err)
+		}
+		got, err := vtc.readDisk(12, 2103, 1346)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("read back %d bytes, want %d", len(got), len(data))
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), atomicfile.TempPrefix) {
+			t.Errorf("temp file left behind: %s", e.Name())
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package vectortile
+
+import (
+	"github.com/paulmach/orb"
+	"github.com/paulmach/orb/geojson"
+)
+
+// ToGeoJSON converts the tile data into a FeatureCollection for inspection in
+// GIS tools. Each feature carries its source properties plus a "layer" key,
+// and the typed fields (name, class, rank...) so they round-trip.
+func (d *TileData) ToGeoJSON() *geojson.FeatureCollection {
+	fc := geojson.NewFeatureCollection()
+
+	for _, p := range d.Places {
+		f := newFeature(p.Location, "place", p.Properties)
+		f.Properties["name"] = p.Name
+		f.Properties["class"] = p.Class
+		f.Properties["rank"] = p.Rank
+		fc.Append(f)
+	}
+
+	for _, p := range d.POIs {
+		f := newFeature(p.Location, "poi", p.Properties)
+		f.Properties["name"] = p.Name
+		f.Properties["class"] = p.Class
+		f.Properties["subclass"] = p.Subclass
+		f.Properties["rank"] = p.Rank
+		fc.Append(f)
+	}
+
+	for _, t := range d.Transport {
+		f := newFeature(t.Geometry, "transportation", t.Properties)
+		f.Properties["class"] = t.Class
+		fc.Append(f)
+	}
+
+	for _, w := range d.Water {
+		f := newFeature(w.Geometry, "water", w.Properties)
+		f.Properties["class"] = w.Class
+		fc.Append(f)
+	}
+
+	for _, b := range d.Boundaries {
+		f := newFeature(b.Geometry, "boundary", b.Properties)
+		f.Properties["admin_level"] = b.AdminLevel
+		fc.Append(f)
+	}
+
+	return fc
+}
+
+// newFeature builds a feature with a copy of props, so the extracted
+// features' (aliased) property maps are never modified
+func newFeature(g orb.Geometry, layer string, props map[string]interface{}) *geojson.Feature {
+	f := geojson.NewFeature(g)
+	for k, v := range props {
+		f.Properties[k] = v
+	}
+	f.Properties["layer"] = layer
+	return f
+}
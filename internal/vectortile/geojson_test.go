@@ -0,0 +1,70 @@
+package vectortile
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/paulmach/orb/geojson"
+)
+
+func TestToGeoJSON(t *testing.T) {
+	raw, err := os.ReadFile("testdata/amsterdam_12_2103_1346.pbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := parseTile(raw, 12, 2103, 1346)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	encoded, err := json.Marshal(data.ToGeoJSON())
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+	fc, err := geojson.UnmarshalFeatureCollection(encoded)
+	if err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+
+	counts := make(map[string]int)
+	for _, f := range fc.Features {
+		counts[f.Properties.MustString("layer", "")]++
+	}
+	// One feature per extracted place, road, water body and boundary
+	want := map[string]int{"place": 2, "transportation": 3, "water": 1, "boundary": 1}
+	for layer, n := range want {
+		if counts[layer] != n {
+			t.Errorf("%s: %d features, want %d", layer, counts[layer], n)
+		}
+	}
+	if len(fc.Features) != 7 {
+		t.Errorf("%d features, want 7", len(fc.Features))
+	}
+
+	// Typed fields survive the round trip
+	var city *geojson.Feature
+	for _, f := range fc.Features {
+		if f.Properties.MustString("name", "") == "Amsterdam" {
+			city = f
+		}
+	}
+	if city == nil {
+		t.Fatal("Amsterdam missing from the GeoJSON")
+	}
+	if class, rank := city.Properties.MustString("class", ""), city.Properties.MustInt("rank", -1); class != "city" || rank != 1 {
+		t.Errorf("Amsterdam: class %q rank %d, want city 1", class, rank)
+	}
+	for _, f := range fc.Features {
+		if f.Properties.MustString("layer", "") == "boundary" && f.Properties.MustInt("admin_level", -1) != 2 {
+			t.Errorf("boundary admin_level %v, want 2", f.Properties["admin_level"])
+		}
+	}
+
+	// The extracted features' own properties are left untouched
+	for _, p := range data.Places {
+		if _, ok := p.Properties["layer"]; ok {
+			t.Errorf("place %q properties gained a layer key", p.Name)
+		}
+	}
+}
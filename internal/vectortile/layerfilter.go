@@ -0,0 +1,97 @@
+package vectortile
+
+import "encoding/binary"
+
+// Protobuf field numbers and wire types of the MVT messages filterLayers reads
+const (
+	tileLayersField = 3
+	layerNameField  = 1
+
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// filterLayers returns the MVT bytes with only the layers we extract, so
+// mvt.Unmarshal doesn't decode buildings, landcover and the like just to
+// drop them. Data that doesn't scan as a plain tile (e.g. gzipped) is
+// returned unchanged and left to mvt.Unmarshal.
+func filterLayers(data []byte) []byte {
+	out := make([]byte, 0, len(data))
+	for rest := data; len(rest) > 0; {
+		field, wire, n := protoKey(rest)
+		if n <= 0 {
+			return data
+		}
+		size := protoFieldSize(rest[n:], wire)
+		if size < 0 {
+			return data
+		}
+		end := n + size
+
+		keep := true
+		if field == tileLayersField && wire == wireBytes {
+			_, m := binary.Uvarint(rest[n:])
+			_, keep = layerExtractors[layerName(rest[n+m:end])]
+		}
+		if keep {
+			out = append(out, rest[:end]...)
+		}
+		rest = rest[end:]
+	}
+	return out
+}
+
+// layerName returns the name field of an encoded MVT layer, or "" if the
+// layer has none or doesn't scan
+func layerName(layer []byte) string {
+	for len(layer) > 0 {
+		field, wire, n := protoKey(layer)
+		if n <= 0 {
+			return ""
+		}
+		size := protoFieldSize(layer[n:], wire)
+		if size < 0 {
+			return ""
+		}
+		if field == layerNameField && wire == wireBytes {
+			l, m := binary.Uvarint(layer[n:])
+			return string(layer[n+m : n+m+int(l)])
+		}
+		layer = layer[n+size:]
+	}
+	return ""
+}
+
+// protoKey decodes a field key, returning its field number, wire type and
+// length in bytes (<= 0 if malformed)
+func protoKey(b []byte) (field uint64, wire int, n int) {
+	key, n := binary.Uvarint(b)
+	return key >> 3, int(key & 7), n
+}
+
+// protoFieldSize returns the encoded size of a field value of the given
+// wire type at the start of b, or -1 if it is malformed or truncated
+func protoFieldSize(b []byte, wire int) int {
+	switch wire {
+	case wireVarint:
+		if _, n := binary.Uvarint(b); n > 0 {
+			return n
+		}
+	case wireFixed64:
+		if len(b) >= 8 {
+			return 8
+		}
+	case wireBytes:
+		l, n := binary.Uvarint(b)
+		if n > 0 && l <= uint64(len(b)-n) {
+			return n + int(l)
+		}
+	case wireFixed32:
+		if len(b) >= 4 {
+			return 4
+		}
+	}
+	return -1
+}
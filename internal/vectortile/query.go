@@ -0,0 +1,231 @@
+package vectortile
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/paulmach/orb"
+
+	"mapviewer/pkg/tiles"
+)
+
+const (
+	// MaxTileZoom is the highest zoom the vector tile source provides
+	MaxTileZoom = 14
+
+	// QueryTolerancePx is how close (in screen pixels) a feature must be to
+	// a queried point to count as "under" it
+	QueryTolerancePx = 8.0
+)
+
+// QueryPoint returns the places, POIs and transport lines near a point as
+// seen at the given zoom, nearest first. The tile containing the point is
+// fetched if needed.
+func (vtc *VectorTileCache) QueryPoint(lat, lon float64, zoom int) (*TileData, error) {
+	tileZoom := zoom
+	if tileZoom > MaxTileZoom {
+		tileZoom = MaxTileZoom
+	}
+	if tileZoom < 0 {
+		tileZoom = 0
+	}
+
+	coord := tiles.LatLonToTile(lat, lon, tileZoom)
+	data, err := vtc.GetTile(coord.Zoom, coord.X, coord.Y)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert the pixel tolerance to meters at the display zoom
+	metersPerPixel := 156543.03392 * math.Cos(lat*math.Pi/180.0) / math.Pow(2, float64(zoom))
+	tolerance := QueryTolerancePx * metersPerPixel
+
+	result := &TileData{}
+	for _, p := range data.Places {
+		if tiles.Haversine(lat, lon, p.Location.Lat(), p.Location.Lon()) <= tolerance {
+			result.Places = append(result.Places, p)
+		}
+	}
+	for _, p := range data.POIs {
+		if tiles.Haversine(lat, lon, p.Location.Lat(), p.Location.Lon()) <= tolerance {
+			result.POIs = append(result.POIs, p)
+		}
+	}
+	for _, t := range data.Transport {
+		if distanceToGeometry(lat, lon, t.Geometry) <= tolerance {
+			result.Transport = append(result.Transport, t)
+		}
+	}
+
+	dist := func(p orb.Point) float64 {
+		return tiles.Haversine(lat, lon, p.Lat(), p.Lon())
+	}
+	sort.SliceStable(result.Places, func(i, j int) bool {
+		return dist(result.Places[i].Location) < dist(result.Places[j].Location)
+	})
+	sort.SliceStable(result.POIs, func(i, j int) bool {
+		return dist(result.POIs[i].Location) < dist(result.POIs[j].Location)
+	})
+	sort.SliceStable(result.Transport, func(i, j int) bool {
+		return distanceToGeometry(lat, lon, result.Transport[i].Geometry) < distanceToGeometry(lat, lon, result.Transport[j].Geometry)
+	})
+
+	return result, nil
+}
+
+// distanceToGeometry returns the approximate distance in meters from a point
+// to the nearest vertex or segment of a point/line geometry
+func distanceToGeometry(lat, lon float64, g orb.Geometry) float64 {
+	switch geom := g.(type) {
+	case orb.Point:
+		return tiles.Haversine(lat, lon, geom.Lat(), geom.Lon())
+	case orb.LineString:
+		return distanceToLineString(lat, lon, geom)
+	case orb.MultiLineString:
+		best := math.Inf(1)
+		for _, ls := range geom {
+			best = math.Min(best, distanceToLineString(lat, lon, ls))
+		}
+		return best
+	}
+	return math.Inf(1)
+}
+
+// distanceToLineString projects the line into a local equirectangular plane
+// around the query point (accurate at query-tolerance scales) and returns the
+// distance in meters to the closest segment
+func distanceToLineString(lat, lon float64, ls orb.LineString) float64 {
+	if len(ls) == 0 {
+		return math.Inf(1)
+	}
+
+	metersPerDegLat := math.Pi * tiles.EarthRadius / 180.0
+	metersPerDegLon := metersPerDegLat * math.Cos(lat*math.Pi/180.0)
+	project := func(p orb.Point) (float64, float64) {
+		return (p.Lon() - lon) * metersPerDegLon, (p.Lat() - lat) * metersPerDegLat
+	}
+
+	if len(ls) == 1 {
+		x, y := project(ls[0])
+		return math.Hypot(x, y)
+	}
+
+	best := math.Inf(1)
+	for i := 0; i+1 < len(ls); i++ {
+		ax, ay := project(ls[i])
+		bx, by := project(ls[i+1])
+		best = math.Min(best, pointToSegment(0, 0, ax, ay, bx, by))
+	}
+	return best
+}
+
+// pointToSegment returns the distance from (px, py) to segment a-b in the plane
+func pointToSegment(px, py, ax, ay, bx, by float64) float64 {
+	dx, dy := bx-ax, by-ay
+	lenSq := dx*dx + dy*dy
+	if lenSq == 0 {
+		return math.Hypot(px-ax, py-ay)
+	}
+
+	t := ((px-ax)*dx + (py-ay)*dy) / lenSq
+	t = math.Max(0, math.Min(1, t))
+	return math.Hypot(px-(ax+t*dx), py-(ay+t*dy))
+}
+
+// MaxQueryTiles bounds how many tiles a single QueryBBox may fetch
+const MaxQueryTiles = 64
+
+// QueryBBox fetches every tile overlapping the box concurrently and merges
+// their features into one TileData. Places and POIs are limited to the box
+// and deduplicated, since tile buffers repeat them in neighbouring tiles.
+// An error is only returned if no overlapping tile could be loaded.
+func (vtc *VectorTileCache) QueryBBox(minLat, minLon, maxLat, maxLon float64, zoom int) (*TileData, error) {
+	if zoom > MaxTileZoom {
+		zoom = MaxTileZoom
+	}
+	if zoom < 0 {
+		zoom = 0
+	}
+	if minLat > maxLat {
+		minLat, maxLat = maxLat, minLat
+	}
+	if minLon > maxLon {
+		minLon, maxLon = maxLon, minLon
+	}
+
+	topLeft := tiles.LatLonToTile(maxLat, minLon, zoom)
+	bottomRight := tiles.LatLonToTile(minLat, maxLon, zoom)
+
+	count := (bottomRight.X - topLeft.X + 1) * (bottomRight.Y - topLeft.Y + 1)
+	if count > MaxQueryTiles {
+		return nil, fmt.Errorf("bounding box spans %d tiles at zoom %d (max %d)", count, zoom, MaxQueryTiles)
+	}
+
+	// Fetch concurrently; GetTile's in-flight dedup shares duplicate requests
+	results := make([]*TileData, count)
+	errs := make([]error, count)
+	var wg sync.WaitGroup
+	i := 0
+	for y := topLeft.Y; y <= bottomRight.Y; y++ {
+		for x := topLeft.X; x <= bottomRight.X; x++ {
+			wg.Add(1)
+			go func(i, x, y int) {
+				defer wg.Done()
+				results[i], errs[i] = vtc.GetTile(zoom, x, y)
+			}(i, x, y)
+			i++
+		}
+	}
+	wg.Wait()
+
+	inBox := func(p orb.Point) bool {
+		return p.Lat() >= minLat && p.Lat() <= maxLat && p.Lon() >= minLon && p.Lon() <= maxLon
+	}
+
+	merged := &TileData{}
+	seenPlaces := make(map[string]bool)
+	seenPOIs := make(map[string]bool)
+	var firstErr error
+	loaded := 0
+
+	for i, data := range results {
+		if errs[i] != nil {
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+			continue
+		}
+		loaded++
+
+		for _, p := range data.Places {
+			key := dedupKey(p.Name, p.Location)
+			if inBox(p.Location) && !seenPlaces[key] {
+				seenPlaces[key] = true
+				merged.Places = append(merged.Places, p)
+			}
+		}
+		for _, p := range data.POIs {
+			key := dedupKey(p.Name, p.Location)
+			if inBox(p.Location) && !seenPOIs[key] {
+				seenPOIs[key] = true
+				merged.POIs = append(merged.POIs, p)
+			}
+		}
+		merged.Transport = append(merged.Transport, data.Transport...)
+		merged.Water = append(merged.Water, data.Water...)
+		merged.Boundaries = append(merged.Boundaries, data.Boundaries...)
+	}
+
+	if loaded == 0 && firstErr != nil {
+		return nil, firstErr
+	}
+	return merged, nil
+}
+
+// dedupKey identifies a named point across tiles. Locations are rounded to
+// ~100m because the same feature is quantized differently in each tile.
+func dedupKey(name string, p orb.Point) string {
+	return fmt.Sprintf("%s@%.3f,%.3f", name, p.Lat(), p.Lon())
+}
@@ -2,22 +2,32 @@ package vectortile
 
 import (
 	"compress/gzip"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"os"
+	"slices"
 	"sync"
 
 	"github.com/paulmach/orb"
 	"github.com/paulmach/orb/encoding/mvt"
-	"github.com/paulmach/orb/geojson"
 	"github.com/paulmach/orb/maptile"
+
+	"mapviewer/internal/fetch"
+	"mapviewer/internal/logging"
+	"mapviewer/pkg/tiles"
 )
 
 const (
-	// OpenFreeMap vector tile endpoint
-	TileURLTemplate = "https://tiles.openfreemap.org/planet/20251203_001001_pt/%d/%d/%d.pbf"
+	// DefaultURLTemplate is the OpenFreeMap vector tile endpoint for a pinned planet build
+	DefaultURLTemplate = "https://tiles.openfreemap.org/planet/20251203_001001_pt/{z}/{x}/{y}.pbf"
 )
 
+// ErrTileNotFound is returned for tiles the source doesn't have (HTTP 404)
+var ErrTileNotFound = errors.New("vector tile not found")
+
 // VectorTile represents a parsed vector tile with its layers
 type VectorTile struct {
 	Coord  maptile.Tile
@@ -30,26 +40,58 @@ type Place struct {
 	Class    string // city, town, village, hamlet, etc.
 	Rank     int
 	Location orb.Point
+
+	// Properties holds every attribute of the source feature. It aliases the
+	// MVT feature's property map, so treat it as read-only.
+	Properties map[string]interface{}
+}
+
+// POI represents a point of interest (restaurant, shop, station...) from the poi layer
+type POI struct {
+	Name     string
+	Class    string // shop, restaurant, railway, etc.
+	Subclass string
+	Rank     int
+	Location orb.Point
+
+	// All source attributes, read-only (see Place.Properties)
+	Properties map[string]interface{}
 }
 
 // TransportLine represents a road/rail from the transportation layer
 type TransportLine struct {
 	Class    string // motorway, rail, primary, secondary, etc.
 	Geometry orb.Geometry
+
+	// All source attributes, read-only (see Place.Properties)
+	Properties map[string]interface{}
 }
 
 // WaterFeature represents water from the water layer
 type WaterFeature struct {
 	Class    string
 	Geometry orb.Geometry
+
+	// All source attributes, read-only (see Place.Properties)
+	Properties map[string]interface{}
+}
+
+// Boundary represents an administrative border from the boundary layer
+type Boundary struct {
+	AdminLevel int // 2 = country, 4 = state/province, higher = smaller regions
+	Geometry   orb.Geometry
+
+	// All source attributes, read-only (see Place.Properties)
+	Properties map[string]interface{}
 }
 
 // TileData holds extracted features from a vector tile
 type TileData struct {
 	Places     []Place
+	POIs       []POI
 	Transport  []TransportLine
 	Water      []WaterFeature
-	Boundaries []orb.Geometry
+	Boundaries []Boundary
 }
 
 // VectorTileCache manages fetching and caching vector tiles
@@ -57,17 +99,86 @@ type VectorTileCache struct {
 	client   *http.Client
 	tiles    map[string]*TileData
 	tilesMu  sync.RWMutex
-	inFlight map[string]chan struct{}
+	inFlight map[string]*inFlightFetch
 	inFlightMu sync.Mutex
+
+	// Directory for raw MVT bytes ("" = memory only)
+	cacheDir string
+
+	// Source URL with {z}/{x}/{y} placeholders
+	urlTemplate   string
+	urlTemplateMu sync.RWMutex
+
+	// Retry behaviour for upstream requests; ctx is cancelled on Close
+	retry  fetch.RetryPolicy
+	ctx    context.Context
+	cancel context.CancelFunc
 }
 
-// NewVectorTileCache creates a new vector tile cache
-func NewVectorTileCache() *VectorTileCache {
+// NewVectorTileCache creates a new vector tile cache. When cacheDir is not
+// empty, raw tiles are also kept on disk so they survive restarts.
+func NewVectorTileCache(cacheDir string) (*VectorTileCache, error) {
+	if cacheDir != "" {
+		if err := os.MkdirAll(cacheDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create vector cache directory: %w", err)
+		}
+		removeTempFiles(cacheDir)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
 	return &VectorTileCache{
-		client:   &http.Client{},
-		tiles:    make(map[string]*TileData),
-		inFlight: make(map[string]chan struct{}),
+		client:      &http.Client{},
+		cacheDir:    cacheDir,
+		urlTemplate: DefaultURLTemplate,
+		tiles:       make(map[string]*TileData),
+		inFlight:    make(map[string]*inFlightFetch),
+		retry:       fetch.DefaultRetryPolicy(),
+		ctx:         ctx,
+		cancel:      cancel,
+	}, nil
+}
+
+// SetURLTemplate points the cache at a different MVT source or planet build.
+// The template must contain {z}, {x} and {y} placeholders.
+func (vtc *VectorTileCache) SetURLTemplate(template string) error {
+	if err := tiles.ValidateURLTemplate(template); err != nil {
+		return err
 	}
+	vtc.urlTemplateMu.Lock()
+	vtc.urlTemplate = template
+	vtc.urlTemplateMu.Unlock()
+	return nil
+}
+
+// URLTemplate returns the currently configured vector tile source
+func (vtc *VectorTileCache) URLTemplate() string {
+	vtc.urlTemplateMu.RLock()
+	defer vtc.urlTemplateMu.RUnlock()
+	return vtc.urlTemplate
+}
+
+// SetRetryPolicy sets how failed upstream requests are retried
+func (vtc *VectorTileCache) SetRetryPolicy(policy fetch.RetryPolicy) {
+	vtc.retry = policy
+}
+
+// SetHTTPClient sets the client used for upstream requests, e.g. one whose
+// transport points at a local test server. Call it before fetching tiles.
+func (vtc *VectorTileCache) SetHTTPClient(client *http.Client) {
+	vtc.client = client
+}
+
+// Clear drops every parsed tile from memory. Tiles kept on disk are parsed
+// again on their next GetTile.
+func (vtc *VectorTileCache) Clear() {
+	vtc.tilesMu.Lock()
+	vtc.tiles = make(map[string]*TileData)
+	vtc.tilesMu.Unlock()
+}
+
+// Close aborts in-progress downloads and retries
+func (vtc *VectorTileCache) Close() {
+	vtc.cancel()
 }
 
 // tileKey generates a cache key for a tile
@@ -75,8 +186,25 @@ func tileKey(z, x, y int) string {
 	return fmt.Sprintf("%d/%d/%d", z, x, y)
 }
 
+// inFlightFetch is a download shared by every caller asking for the same tile.
+// It is only cancelled once all interested callers have given up.
+type inFlightFetch struct {
+	done    chan struct{}
+	data    *TileData
+	err     error
+	waiters int
+	cancel  context.CancelFunc
+}
+
 // GetTile returns tile data, fetching if necessary
 func (vtc *VectorTileCache) GetTile(z, x, y int) (*TileData, error) {
+	return vtc.GetTileCtx(vtc.ctx, z, x, y)
+}
+
+// GetTileCtx is like GetTile but gives up when ctx is cancelled. Concurrent
+// calls for the same tile share one download; cancelling ctx only abandons
+// this caller.
+func (vtc *VectorTileCache) GetTileCtx(ctx context.Context, z, x, y int) (*TileData, error) {
 	key := tileKey(z, x, y)
 
 	// Check cache
@@ -87,40 +215,62 @@ func (vtc *VectorTileCache) GetTile(z, x, y int) (*TileData, error) {
 	}
 	vtc.tilesMu.RUnlock()
 
-	// Check if fetch is in progress
+	// Join an in-progress fetch or start a new one
 	vtc.inFlightMu.Lock()
-	if ch, exists := vtc.inFlight[key]; exists {
-		vtc.inFlightMu.Unlock()
-		<-ch
-		vtc.tilesMu.RLock()
-		data := vtc.tiles[key]
-		vtc.tilesMu.RUnlock()
-		return data, nil
+	f, exists := vtc.inFlight[key]
+	if !exists {
+		dlCtx, cancel := context.WithCancel(vtc.ctx)
+		f = &inFlightFetch{done: make(chan struct{}), cancel: cancel}
+		vtc.inFlight[key] = f
+		go vtc.download(dlCtx, key, z, x, y, f)
 	}
-
-	// Mark as in-flight
-	ch := make(chan struct{})
-	vtc.inFlight[key] = ch
+	f.waiters++
 	vtc.inFlightMu.Unlock()
 
-	// Fetch and parse
-	data, err := vtc.fetchAndParse(z, x, y)
+	select {
+	case <-f.done:
+		return f.data, f.err
+	case <-ctx.Done():
+		vtc.inFlightMu.Lock()
+		f.waiters--
+		if f.waiters == 0 {
+			// Nobody wants this tile anymore; let a later request start afresh
+			f.cancel()
+			if vtc.inFlight[key] == f {
+				delete(vtc.inFlight, key)
+			}
+		}
+		vtc.inFlightMu.Unlock()
+		return nil, ctx.Err()
+	}
+}
 
-	vtc.inFlightMu.Lock()
-	delete(vtc.inFlight, key)
-	close(ch)
-	vtc.inFlightMu.Unlock()
+// download fetches, parses and caches a tile for an in-flight fetch
+func (vtc *VectorTileCache) download(ctx context.Context, key string, z, x, y int, f *inFlightFetch) {
+	data, err := vtc.fetchAndParse(ctx, z, x, y)
 
-	if err != nil {
-		return nil, err
+	if err == nil {
+		vtc.tilesMu.Lock()
+		vtc.tiles[key] = data
+		vtc.tilesMu.Unlock()
 	}
 
-	// Cache result
-	vtc.tilesMu.Lock()
-	vtc.tiles[key] = data
-	vtc.tilesMu.Unlock()
+	vtc.inFlightMu.Lock()
+	if vtc.inFlight[key] == f {
+		delete(vtc.inFlight, key)
+	}
+	f.data, f.err = data, err
+	close(f.done)
+	f.cancel()
+	vtc.inFlightMu.Unlock()
+}
 
-	return data, nil
+// Peek returns tile data only if it is already cached, without fetching
+func (vtc *VectorTileCache) Peek(z, x, y int) (*TileData, bool) {
+	vtc.tilesMu.RLock()
+	defer vtc.tilesMu.RUnlock()
+	data, ok := vtc.tiles[tileKey(z, x, y)]
+	return data, ok
 }
 
 // HasTile checks if a tile is cached
@@ -132,23 +282,54 @@ func (vtc *VectorTileCache) HasTile(z, x, y int) bool {
 	return ok
 }
 
-// fetchAndParse downloads and parses a vector tile
-func (vtc *VectorTileCache) fetchAndParse(z, x, y int) (*TileData, error) {
-	url := fmt.Sprintf(TileURLTemplate, z, x, y)
+// fetchAndParse loads a vector tile from disk, or downloads it and writes
+// it through to disk, then parses it
+func (vtc *VectorTileCache) fetchAndParse(ctx context.Context, z, x, y int) (*TileData, error) {
+	if raw, err := vtc.readDisk(z, x, y); err == nil {
+		if data, err := parseTile(raw, z, x, y); err == nil {
+			return data, nil
+		}
+		// Corrupt on disk; fall through and download a fresh copy
+		vtc.removeDisk(z, x, y)
+	}
+
+	rawData, err := vtc.fetchRaw(ctx, z, x, y)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := parseTile(rawData, z, x, y)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := vtc.writeDisk(z, x, y, rawData); err != nil {
+		logging.Warnf("failed to cache vector tile: %v", err)
+	}
+
+	return data, nil
+}
+
+// fetchRaw downloads the raw (decompressed) MVT bytes for a tile
+func (vtc *VectorTileCache) fetchRaw(ctx context.Context, z, x, y int) ([]byte, error) {
+	url := tiles.TileCoord{X: x, Y: y, Zoom: z}.URLFromTemplate(vtc.URLTemplate())
 
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, err
 	}
 	req.Header.Set("User-Agent", "MapViewer/1.0")
 	req.Header.Set("Accept-Encoding", "gzip")
 
-	resp, err := vtc.client.Do(req)
+	resp, err := fetch.Do(vtc.client, req, vtc.retry)
 	if err != nil {
 		return nil, fmt.Errorf("fetch failed: %w", err)
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%d/%d/%d: %w", z, x, y, ErrTileNotFound)
+	}
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("status %d", resp.StatusCode)
 	}
@@ -168,35 +349,44 @@ func (vtc *VectorTileCache) fetchAndParse(z, x, y int) (*TileData, error) {
 		return nil, fmt.Errorf("read error: %w", err)
 	}
 
-	// Parse MVT
-	layers, err := mvt.Unmarshal(rawData)
+	return rawData, nil
+}
+
+// parseTile decodes raw MVT bytes and extracts features in WGS84
+func parseTile(rawData []byte, z, x, y int) (*TileData, error) {
+	// Parse MVT, skipping layers we don't extract
+	layers, err := mvt.Unmarshal(filterLayers(rawData))
 	if err != nil {
 		return nil, fmt.Errorf("mvt parse error: %w", err)
 	}
 
-	// Project to WGS84 coordinates
+	// Extract features in WGS84 coordinates
 	tile := maptile.New(uint32(x), uint32(y), maptile.Zoom(z))
-	layers.ProjectToWGS84(tile)
+	return extractFeatures(layers, tile), nil
+}
 
-	// Extract features
-	return extractFeatures(layers), nil
+// layerExtractors fill TileData from the MVT layers we use, by layer name
+var layerExtractors = map[string]func(*TileData, *mvt.Layer){
+	"place":          func(d *TileData, l *mvt.Layer) { d.Places = extractPlaces(l) },
+	"poi":            func(d *TileData, l *mvt.Layer) { d.POIs = extractPOIs(l) },
+	"transportation": func(d *TileData, l *mvt.Layer) { d.Transport = extractTransport(l) },
+	"water":          func(d *TileData, l *mvt.Layer) { d.Water = extractWater(l) },
+	"boundary":       func(d *TileData, l *mvt.Layer) { d.Boundaries = extractBoundaries(l) },
 }
 
-// extractFeatures extracts typed features from MVT layers
-func extractFeatures(layers mvt.Layers) *TileData {
+// extractFeatures projects the layers we use to WGS84 and extracts typed
+// features from them. Other layers (buildings, landcover...) are skipped
+// before projecting, since projection copies every geometry.
+func extractFeatures(layers mvt.Layers, tile maptile.Tile) *TileData {
 	data := &TileData{}
 
 	for _, layer := range layers {
-		switch layer.Name {
-		case "place":
-			data.Places = extractPlaces(layer)
-		case "transportation":
-			data.Transport = extractTransport(layer)
-		case "water":
-			data.Water = extractWater(layer)
-		case "boundary":
-			data.Boundaries = extractBoundaries(layer)
+		extract, ok := layerExtractors[layer.Name]
+		if !ok {
+			continue
 		}
+		layer.ProjectToWGS84(tile)
+		extract(data, layer)
 	}
 
 	return data
@@ -206,7 +396,7 @@ func extractPlaces(layer *mvt.Layer) []Place {
 	places := make([]Place, 0, len(layer.Features))
 
 	for _, f := range layer.Features {
-		place := Place{}
+		place := Place{Properties: f.Properties}
 
 		// Get properties
 		if name, ok := f.Properties["name"].(string); ok {
@@ -229,11 +419,41 @@ func extractPlaces(layer *mvt.Layer) []Place {
 	return places
 }
 
+func extractPOIs(layer *mvt.Layer) []POI {
+	pois := make([]POI, 0, len(layer.Features))
+
+	for _, f := range layer.Features {
+		// Only point POIs can be shown as markers
+		pt, ok := f.Geometry.(orb.Point)
+		if !ok {
+			continue
+		}
+
+		poi := POI{Location: pt, Properties: f.Properties}
+		if name, ok := f.Properties["name"].(string); ok {
+			poi.Name = name
+		}
+		if class, ok := f.Properties["class"].(string); ok {
+			poi.Class = class
+		}
+		if subclass, ok := f.Properties["subclass"].(string); ok {
+			poi.Subclass = subclass
+		}
+		if rank, ok := f.Properties["rank"].(float64); ok {
+			poi.Rank = int(rank)
+		}
+
+		pois = append(pois, poi)
+	}
+
+	return pois
+}
+
 func extractTransport(layer *mvt.Layer) []TransportLine {
 	lines := make([]TransportLine, 0, len(layer.Features))
 
 	for _, f := range layer.Features {
-		line := TransportLine{Geometry: f.Geometry}
+		line := TransportLine{Geometry: f.Geometry, Properties: f.Properties}
 
 		if class, ok := f.Properties["class"].(string); ok {
 			line.Class = class
@@ -249,7 +469,7 @@ func extractWater(layer *mvt.Layer) []WaterFeature {
 	features := make([]WaterFeature, 0, len(layer.Features))
 
 	for _, f := range layer.Features {
-		water := WaterFeature{Geometry: f.Geometry}
+		water := WaterFeature{Geometry: f.Geometry, Properties: f.Properties}
 
 		if class, ok := f.Properties["class"].(string); ok {
 			water.Class = class
@@ -261,11 +481,17 @@ func extractWater(layer *mvt.Layer) []WaterFeature {
 	return features
 }
 
-func extractBoundaries(layer *mvt.Layer) []orb.Geometry {
-	boundaries := make([]orb.Geometry, 0, len(layer.Features))
+func extractBoundaries(layer *mvt.Layer) []Boundary {
+	boundaries := make([]Boundary, 0, len(layer.Features))
 
 	for _, f := range layer.Features {
-		boundaries = append(boundaries, f.Geometry)
+		boundary := Boundary{Geometry: f.Geometry, Properties: f.Properties}
+
+		if level, ok := f.Properties["admin_level"].(float64); ok {
+			boundary.AdminLevel = int(level)
+		}
+
+		boundaries = append(boundaries, boundary)
 	}
 
 	return boundaries
@@ -273,14 +499,34 @@ func extractBoundaries(layer *mvt.Layer) []orb.Geometry {
 
 // FilterPlacesByClass returns places matching the given classes
 func FilterPlacesByClass(places []Place, classes ...string) []Place {
-	classSet := make(map[string]bool)
-	for _, c := range classes {
-		classSet[c] = true
+	n := 0
+	for _, p := range places {
+		if slices.Contains(classes, p.Class) {
+			n++
+		}
 	}
 
-	filtered := make([]Place, 0)
+	filtered := make([]Place, 0, n)
 	for _, p := range places {
-		if classSet[p.Class] {
+		if slices.Contains(classes, p.Class) {
+			filtered = append(filtered, p)
+		}
+	}
+	return filtered
+}
+
+// FilterPOIsByClass returns POIs matching the given classes
+func FilterPOIsByClass(pois []POI, classes ...string) []POI {
+	n := 0
+	for _, p := range pois {
+		if slices.Contains(classes, p.Class) {
+			n++
+		}
+	}
+
+	filtered := make([]POI, 0, n)
+	for _, p := range pois {
+		if slices.Contains(classes, p.Class) {
 			filtered = append(filtered, p)
 		}
 	}
@@ -289,19 +535,18 @@ func FilterPlacesByClass(places []Place, classes ...string) []Place {
 
 // FilterTransportByClass returns transport lines matching the given classes
 func FilterTransportByClass(transport []TransportLine, classes ...string) []TransportLine {
-	classSet := make(map[string]bool)
-	for _, c := range classes {
-		classSet[c] = true
+	n := 0
+	for _, t := range transport {
+		if slices.Contains(classes, t.Class) {
+			n++
+		}
 	}
 
-	filtered := make([]TransportLine, 0)
+	filtered := make([]TransportLine, 0, n)
 	for _, t := range transport {
-		if classSet[t.Class] {
+		if slices.Contains(classes, t.Class) {
 			filtered = append(filtered, t)
 		}
 	}
 	return filtered
 }
-
-// Compile-time check that we're using the geojson package (for potential future use)
-var _ = geojson.NewFeature
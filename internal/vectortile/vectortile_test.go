@@ -0,0 +1,91 @@
+package vectortile
+
+import (
+	"math"
+	"os"
+	"testing"
+
+	"github.com/paulmach/orb/maptile"
+)
+
+// The fixture is z12 tile 2103/1346 (Amsterdam) with place, transportation,
+// water and boundary layers, plus a landcover layer parseTile should skip
+func TestParseTileFixture(t *testing.T) {
+	raw, err := os.ReadFile("testdata/amsterdam_12_2103_1346.pbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := parseTile(raw, 12, 2103, 1346)
+	if err != nil {
+		t.Fatalf("parseTile: %v", err)
+	}
+
+	counts := []struct {
+		name      string
+		got, want int
+	}{
+		{"places", len(data.Places), 2},
+		{"pois", len(data.POIs), 0},
+		{"transport", len(data.Transport), 3},
+		{"water", len(data.Water), 1},
+		{"boundaries", len(data.Boundaries), 1},
+	}
+	for _, c := range counts {
+		if c.got != c.want {
+			t.Errorf("%s: got %d, want %d", c.name, c.got, c.want)
+		}
+	}
+
+	var city *Place
+	for i := range data.Places {
+		if data.Places[i].Name == "Amsterdam" {
+			city = &data.Places[i]
+		}
+	}
+	if city == nil {
+		t.Fatalf("Amsterdam not found in %+v", data.Places)
+	}
+	if city.Class != "city" || city.Rank != 1 {
+		t.Errorf("Amsterdam: class %q rank %d, want city 1", city.Class, city.Rank)
+	}
+
+	// Features are projected back to lon/lat; the city sits mid-tile
+	bound := maptile.New(2103, 1346, 12).Bound()
+	center := bound.Center()
+	if math.Abs(city.Location.Lon()-center.Lon()) > 0.001 || math.Abs(city.Location.Lat()-center.Lat()) > 0.001 {
+		t.Errorf("Amsterdam at %v, want near %v", city.Location, center)
+	}
+
+	if got := data.Boundaries[0].AdminLevel; got != 2 {
+		t.Errorf("boundary admin level: got %d, want 2", got)
+	}
+	if got := data.Water[0].Class; got != "lake" {
+		t.Errorf("water class: got %q, want lake", got)
+	}
+}
+
+func TestParseTileTruncated(t *testing.T) {
+	raw, err := os.ReadFile("testdata/amsterdam_12_2103_1346.pbf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseTile(raw[:len(raw)/2], 12, 2103, 1346); err == nil {
+		t.Error("parseTile accepted a truncated tile")
+	}
+}
+
+// parseTile decodes the layers in use and extracts their features
+func BenchmarkParseTile(b *testing.B) {
+	raw, err := os.ReadFile("testdata/amsterdam_12_2103_1346.pbf")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ReportAllocs()
+	b.SetBytes(int64(len(raw)))
+	for i := 0; i < b.N; i++ {
+		if _, err := parseTile(raw, 12, 2103, 1346); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package tiles
+
+import "math"
+
+// EarthRadius is the mean Earth radius in meters
+const EarthRadius = 6371008.8
+
+// Haversine returns the great-circle distance in meters between two points
+func Haversine(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180.0
+	phi2 := lat2 * math.Pi / 180.0
+	dPhi := (lat2 - lat1) * math.Pi / 180.0
+	dLambda := (lon2 - lon1) * math.Pi / 180.0
+
+	a := math.Sin(dPhi/2)*math.Sin(dPhi/2) +
+		math.Cos(phi1)*math.Cos(phi2)*math.Sin(dLambda/2)*math.Sin(dLambda/2)
+	return 2 * EarthRadius * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// InitialBearing returns the initial great-circle bearing in degrees (0-360,
+// clockwise from north) when travelling from the first point to the second
+func InitialBearing(lat1, lon1, lat2, lon2 float64) float64 {
+	phi1 := lat1 * math.Pi / 180.0
+	phi2 := lat2 * math.Pi / 180.0
+	dLambda := (lon2 - lon1) * math.Pi / 180.0
+
+	y := math.Sin(dLambda) * math.Cos(phi2)
+	x := math.Cos(phi1)*math.Sin(phi2) - math.Sin(phi1)*math.Cos(phi2)*math.Cos(dLambda)
+	bearing := math.Atan2(y, x) * 180.0 / math.Pi
+	return math.Mod(bearing+360.0, 360.0)
+}
+
+// Intermediate returns the point a fraction f (0-1) of the way along the
+// great circle from the first point to the second. Antipodal points have no
+// single great circle and return the first point.
+func Intermediate(lat1, lon1, lat2, lon2, f float64) (lat, lon float64) {
+	phi1 := lat1 * math.Pi / 180.0
+	phi2 := lat2 * math.Pi / 180.0
+	lambda1 := lon1 * math.Pi / 180.0
+	lambda2 := lon2 * math.Pi / 180.0
+
+	d := Haversine(lat1, lon1, lat2, lon2) / EarthRadius
+	if math.Sin(d) < 1e-12 {
+		return lat1, lon1
+	}
+	a := math.Sin((1-f)*d) / math.Sin(d)
+	b := math.Sin(f*d) / math.Sin(d)
+
+	x := a*math.Cos(phi1)*math.Cos(lambda1) + b*math.Cos(phi2)*math.Cos(lambda2)
+	y := a*math.Cos(phi1)*math.Sin(lambda1) + b*math.Cos(phi2)*math.Sin(lambda2)
+	z := a*math.Sin(phi1) + b*math.Sin(phi2)
+	lat = math.Atan2(z, math.Hypot(x, y)) * 180.0 / math.Pi
+	lon = math.Atan2(y, x) * 180.0 / math.Pi
+	return lat, lon
+}
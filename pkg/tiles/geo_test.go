@@ -0,0 +1,67 @@
+package tiles
+
+import (
+	"math"
+	"testing"
+)
+
+func TestHaversineAndBearing(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		wantKm                 float64
+		wantBearing            float64
+	}{
+		{"Paris to London", 48.8566, 2.3522, 51.5074, -0.1278, 343.6, 330.0},
+		{"New York to Los Angeles", 40.7128, -74.0060, 34.0522, -118.2437, 3935.8, 273.7},
+		{"Sydney to Auckland", -33.8688, 151.2093, -36.8485, 174.7633, 2155.9, 105.6},
+		{"Tokyo to San Francisco, across the antimeridian", 35.6762, 139.6503, 37.7749, -122.4194, 8274.6, 54.4},
+		{"equator to north pole", 0, 0, 90, 0, math.Pi / 2 * EarthRadius / 1000, 0},
+		{"due east along the equator", 0, 0, 0, 90, math.Pi / 2 * EarthRadius / 1000, 90},
+		{"due south", 10, 20, -10, 20, 20 * math.Pi / 180 * EarthRadius / 1000, 180},
+		{"due west along the equator", 0, 10, 0, -10, 20 * math.Pi / 180 * EarthRadius / 1000, 270},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Haversine(tt.lat1, tt.lon1, tt.lat2, tt.lon2) / 1000; math.Abs(got-tt.wantKm) > 0.1 {
+				t.Errorf("Haversine = %.1f km, want %.1f km", got, tt.wantKm)
+			}
+			// Distance is symmetric
+			fwd := Haversine(tt.lat1, tt.lon1, tt.lat2, tt.lon2)
+			back := Haversine(tt.lat2, tt.lon2, tt.lat1, tt.lon1)
+			if math.Abs(fwd-back) > 1e-6 {
+				t.Errorf("Haversine not symmetric: %.3f vs %.3f", fwd, back)
+			}
+			if got := InitialBearing(tt.lat1, tt.lon1, tt.lat2, tt.lon2); math.Abs(got-tt.wantBearing) > 0.1 {
+				t.Errorf("InitialBearing = %.2f, want %.1f", got, tt.wantBearing)
+			}
+		})
+	}
+}
+
+func TestHaversineSamePoint(t *testing.T) {
+	if d := Haversine(52.37, 4.9, 52.37, 4.9); d != 0 {
+		t.Errorf("distance to self = %v, want 0", d)
+	}
+}
+
+func TestIntermediate(t *testing.T) {
+	tests := []struct {
+		name                   string
+		lat1, lon1, lat2, lon2 float64
+		f                      float64
+		wantLat, wantLon       float64
+	}{
+		{"start", 48.8566, 2.3522, 51.5074, -0.1278, 0, 48.8566, 2.3522},
+		{"end", 48.8566, 2.3522, 51.5074, -0.1278, 1, 51.5074, -0.1278},
+		{"equator midpoint", 0, 0, 0, 90, 0.5, 0, 45},
+		{"meridian midpoint", 0, 30, 60, 30, 0.5, 30, 30},
+		{"antipodes return the start", 0, 0, 0, 180, 0.5, 0, 0},
+	}
+	for _, tt := range tests {
+		lat, lon := Intermediate(tt.lat1, tt.lon1, tt.lat2, tt.lon2, tt.f)
+		if math.Abs(lat-tt.wantLat) > 1e-9 || math.Abs(lon-tt.wantLon) > 1e-9 {
+			t.Errorf("%s: got %.6f,%.6f, want %.6f,%.6f", tt.name, lat, lon, tt.wantLat, tt.wantLon)
+		}
+	}
+}
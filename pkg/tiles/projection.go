@@ -0,0 +1,28 @@
+package tiles
+
+import "math"
+
+// MaxLatitude is the edge of the Web Mercator square; latitudes beyond it
+// project outside the tile grid
+const MaxLatitude = 85.0511
+
+// Project converts latitude/longitude to fractional Web Mercator tile
+// coordinates at a zoom level: the world spans [0, 2^zoom) on both axes,
+// with X growing east and Y growing south. Multiply by TileSize() for
+// world pixels.
+func Project(lat, lon float64, zoom int) (x, y float64) {
+	n := math.Pow(2, float64(zoom))
+	latRad := lat * math.Pi / 180.0
+	x = (lon + 180.0) / 360.0 * n
+	y = (1.0 - math.Log(math.Tan(latRad)+1.0/math.Cos(latRad))/math.Pi) / 2.0 * n
+	return x, y
+}
+
+// Unproject converts fractional tile coordinates at a zoom level back to
+// latitude/longitude; it is the inverse of Project
+func Unproject(x, y float64, zoom int) (lat, lon float64) {
+	n := math.Pow(2, float64(zoom))
+	lon = x/n*360.0 - 180.0
+	lat = math.Atan(math.Sinh(math.Pi*(1-2*y/n))) * 180.0 / math.Pi
+	return lat, lon
+}
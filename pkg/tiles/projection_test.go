@@ -0,0 +1,82 @@
+package tiles
+
+import (
+	"math"
+	"testing"
+)
+
+func TestProject(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		zoom     int
+		x, y     float64
+	}{
+		{"origin", 0, 0, 0, 0.5, 0.5},
+		{"origin at zoom 3", 0, 0, 3, 4, 4},
+		{"west edge", 0, -180, 2, 0, 2},
+		{"east edge", 0, 180, 2, 4, 2},
+		{"north edge", MaxLatitude, 0, 1, 1, 0},
+		{"south edge", -MaxLatitude, 0, 1, 1, 2},
+	}
+	for _, tt := range tests {
+		x, y := Project(tt.lat, tt.lon, tt.zoom)
+		// MaxLatitude is rounded, so the edges land a hair inside the grid
+		if math.Abs(x-tt.x) > 1e-9 || math.Abs(y-tt.y) > 1e-5 {
+			t.Errorf("%s: Project(%v, %v, %d) = %v, %v; want %v, %v",
+				tt.name, tt.lat, tt.lon, tt.zoom, x, y, tt.x, tt.y)
+		}
+	}
+}
+
+func TestProjectUnprojectRoundTrip(t *testing.T) {
+	lats := []float64{-MaxLatitude, -66.5, -33.87, -0.001, 0, 1e-7, 45, 52.37, 78.22, MaxLatitude}
+	lons := []float64{-180, -122.42, -0.1278, 0, 4.9, 139.65, 179.999999}
+	for _, zoom := range []int{0, 1, 5, 12, 18, 24} {
+		for _, lat := range lats {
+			for _, lon := range lons {
+				x, y := Project(lat, lon, zoom)
+				gotLat, gotLon := Unproject(x, y, zoom)
+				if math.Abs(gotLat-lat) > 1e-9 || math.Abs(gotLon-lon) > 1e-9 {
+					t.Errorf("z%d: %v,%v -> %v,%v -> %v,%v", zoom, lat, lon, x, y, gotLat, gotLon)
+				}
+			}
+		}
+	}
+}
+
+// Unproject then Project returns the same tile coordinates, also outside
+// the [0, 2^zoom) range used for wrapped columns
+func TestUnprojectProjectRoundTrip(t *testing.T) {
+	for _, zoom := range []int{0, 3, 10, 18} {
+		n := math.Pow(2, float64(zoom))
+		for _, fx := range []float64{-1.25, 0, 0.1, 0.5, 0.99, 1, 2.5} {
+			for _, fy := range []float64{0.001, 0.25, 0.5, 0.75, 0.999} {
+				x, y := fx*n, fy*n
+				lat, lon := Unproject(x, y, zoom)
+				gotX, gotY := Project(lat, lon, zoom)
+				// Tolerance in pixels of a 256px tile
+				if math.Abs(gotX-x)*256 > 1e-6 || math.Abs(gotY-y)*256 > 1e-6 {
+					t.Errorf("z%d: %v,%v -> %v,%v -> %v,%v", zoom, x, y, lat, lon, gotX, gotY)
+				}
+			}
+		}
+	}
+}
+
+// Project agrees with the integer tile lookup
+func TestProjectMatchesLatLonToTile(t *testing.T) {
+	for _, zoom := range []int{1, 7, 15} {
+		for _, p := range [][2]float64{{52.37, 4.9}, {-33.87, 151.21}, {40.71, -74.01}} {
+			x, y := Project(p[0], p[1], zoom)
+			tile := LatLonToTile(p[0], p[1], zoom)
+			if tile.X != int(x) || tile.Y != int(y) {
+				t.Errorf("z%d %v: tile %v, projected %v,%v", zoom, p, tile, x, y)
+			}
+			lat, lon := TileToLatLon(tile)
+			if lat < p[0] || lon > p[1] {
+				t.Errorf("z%d %v: tile corner %v,%v is not north-west of the point", zoom, p, lat, lon)
+			}
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package tiles
+
+import "fmt"
+
+// Quadkey returns the Bing Maps quadkey for the tile: one base-4 digit per
+// zoom level, interleaving the bits of Y and X from the most significant down
+func (t TileCoord) Quadkey() string {
+	key := make([]byte, t.Zoom)
+	for i := t.Zoom; i > 0; i-- {
+		digit := byte('0')
+		mask := 1 << (i - 1)
+		if t.X&mask != 0 {
+			digit++
+		}
+		if t.Y&mask != 0 {
+			digit += 2
+		}
+		key[t.Zoom-i] = digit
+	}
+	return string(key)
+}
+
+// QuadkeyToTile converts a Bing Maps quadkey back to z/x/y. The empty key is
+// the single zoom 0 tile.
+func QuadkeyToTile(quadkey string) (TileCoord, error) {
+	t := TileCoord{Zoom: len(quadkey)}
+	for i, c := range quadkey {
+		mask := 1 << (t.Zoom - i - 1)
+		switch c {
+		case '0':
+		case '1':
+			t.X |= mask
+		case '2':
+			t.Y |= mask
+		case '3':
+			t.X |= mask
+			t.Y |= mask
+		default:
+			return TileCoord{}, fmt.Errorf("invalid quadkey digit %q in %q", c, quadkey)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,55 @@
+package tiles
+
+import "testing"
+
+func TestQuadkey(t *testing.T) {
+	tests := []struct {
+		tile TileCoord
+		want string
+	}{
+		{TileCoord{X: 0, Y: 0, Zoom: 0}, ""},
+		{TileCoord{X: 0, Y: 0, Zoom: 1}, "0"},
+		{TileCoord{X: 1, Y: 0, Zoom: 1}, "1"},
+		{TileCoord{X: 0, Y: 1, Zoom: 1}, "2"},
+		{TileCoord{X: 1, Y: 1, Zoom: 1}, "3"},
+		// The example from the Bing Maps tile system documentation
+		{TileCoord{X: 3, Y: 5, Zoom: 3}, "213"},
+		{TileCoord{X: 35210, Y: 21493, Zoom: 16}, "1202102332221212"},
+	}
+	for _, tt := range tests {
+		if got := tt.tile.Quadkey(); got != tt.want {
+			t.Errorf("%v.Quadkey() = %q, want %q", tt.tile, got, tt.want)
+		}
+		got, err := QuadkeyToTile(tt.want)
+		if err != nil {
+			t.Errorf("QuadkeyToTile(%q): %v", tt.want, err)
+		} else if got != tt.tile {
+			t.Errorf("QuadkeyToTile(%q) = %v, want %v", tt.want, got, tt.tile)
+		}
+	}
+}
+
+func TestQuadkeyRoundTrip(t *testing.T) {
+	for zoom := 0; zoom <= 20; zoom++ {
+		n := 1 << zoom
+		for _, xy := range [][2]int{{0, 0}, {n - 1, n - 1}, {n / 2, n / 3}, {n / 3, n - 1}} {
+			tile := TileCoord{X: xy[0], Y: xy[1], Zoom: zoom}
+			key := tile.Quadkey()
+			if len(key) != zoom {
+				t.Errorf("%v: quadkey %q has %d digits, want %d", tile, key, len(key), zoom)
+			}
+			got, err := QuadkeyToTile(key)
+			if err != nil || got != tile {
+				t.Errorf("%v -> %q -> %v, %v", tile, key, got, err)
+			}
+		}
+	}
+}
+
+func TestQuadkeyToTileInvalid(t *testing.T) {
+	for _, key := range []string{"4", "12a", "0 1", "-1"} {
+		if tile, err := QuadkeyToTile(key); err == nil {
+			t.Errorf("QuadkeyToTile(%q) = %v, want an error", key, tile)
+		}
+	}
+}
@@ -3,8 +3,117 @@ package tiles
 import (
 	"fmt"
 	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 )
 
+// DefaultURLTemplate is Carto's no-labels basemap for a cleaner Paradox-style look
+const DefaultURLTemplate = "https://basemaps.cartocdn.com/rastertiles/voyager_nolabels/{z}/{x}/{y}.png"
+
+// DefaultSubdomains are substituted for {s} when no list has been configured
+var DefaultSubdomains = []string{"a", "b", "c"}
+
+// DefaultTileSize is the pixel size of standard slippy map tiles
+const DefaultTileSize = 256
+
+var (
+	urlTemplate   = DefaultURLTemplate
+	subdomains    = DefaultSubdomains
+	urlTemplateMu sync.RWMutex
+
+	// subdomainCounter drives round-robin {s} selection across goroutines
+	subdomainCounter atomic.Uint64
+
+	// tileSize is the configured raster tile size in pixels (0 = default)
+	tileSize atomic.Int64
+)
+
+// SetTileSize sets the pixel size of raster tiles, e.g. 512 for sources that
+// serve high resolution tiles. It must be a power of two of at least 256.
+func SetTileSize(px int) error {
+	if px < DefaultTileSize || px&(px-1) != 0 {
+		return fmt.Errorf("tile size %d must be a power of two >= %d", px, DefaultTileSize)
+	}
+	tileSize.Store(int64(px))
+	return nil
+}
+
+// TileSize returns the raster tile size in pixels
+func TileSize() int {
+	if px := tileSize.Load(); px > 0 {
+		return int(px)
+	}
+	return DefaultTileSize
+}
+
+// ZoomOffset is how many zoom levels the tile size shifts the map scale: a
+// 512px tile at zoom z shows the detail of a 256px tile at zoom z+1
+func ZoomOffset() int {
+	return bits.Len(uint(TileSize()/DefaultTileSize)) - 1
+}
+
+// SetURLTemplate sets the raster tile URL template used by TileCoord.URL.
+// The template must contain {z}, {x} and {y} placeholders; a printf-style
+// template with three %d verbs (zoom, x, y) is also accepted, as is a Bing
+// style {q} quadkey placeholder instead of all three. An optional {s}
+// placeholder is replaced by one of the configured subdomains.
+func SetURLTemplate(template string) error {
+	if strings.Count(template, "%d") == 3 {
+		template = strings.Replace(template, "%d", "{z}", 1)
+		template = strings.Replace(template, "%d", "{x}", 1)
+		template = strings.Replace(template, "%d", "{y}", 1)
+	}
+
+	if err := ValidateURLTemplate(template); err != nil {
+		return err
+	}
+
+	urlTemplateMu.Lock()
+	urlTemplate = template
+	urlTemplateMu.Unlock()
+	return nil
+}
+
+// ValidateURLTemplate checks that a template has {z}, {x} and {y}
+// placeholders, or a {q} quadkey placeholder
+func ValidateURLTemplate(template string) error {
+	if strings.Contains(template, "{q}") {
+		return nil
+	}
+	for _, placeholder := range []string{"{z}", "{x}", "{y}"} {
+		if !strings.Contains(template, placeholder) {
+			return fmt.Errorf("tile URL template %q is missing %s", template, placeholder)
+		}
+	}
+	return nil
+}
+
+// SetSubdomains sets the subdomains rotated through for the {s} placeholder
+func SetSubdomains(subs ...string) error {
+	if len(subs) == 0 {
+		return fmt.Errorf("at least one subdomain is required")
+	}
+
+	list := make([]string, len(subs))
+	copy(list, subs)
+
+	urlTemplateMu.Lock()
+	subdomains = list
+	urlTemplateMu.Unlock()
+	return nil
+}
+
+// URLTemplate returns the current raster tile URL template
+func URLTemplate() string {
+	urlTemplateMu.RLock()
+	defer urlTemplateMu.RUnlock()
+	return urlTemplate
+}
+
 // TileCoord represents a tile coordinate in the slippy map format
 type TileCoord struct {
 	X    int
@@ -16,24 +125,45 @@ func (t TileCoord) String() string {
 	return fmt.Sprintf("%d/%d/%d", t.Zoom, t.X, t.Y)
 }
 
-// URL returns the OpenStreetMap tile URL (no labels variant)
+// URL returns the raster tile URL built from the current URL template.
+// Subdomains for {s} are picked round-robin so load is spread across hosts.
 func (t TileCoord) URL() string {
-	// Using Carto's no-labels basemap for a cleaner Paradox-style look
-	return fmt.Sprintf("https://basemaps.cartocdn.com/rastertiles/voyager_nolabels/%d/%d/%d.png", t.Zoom, t.X, t.Y)
+	return t.URLFromTemplate(URLTemplate())
+}
+
+// URLFromTemplate builds the tile URL from an explicit template, e.g. one of
+// several mirrors. {s} is filled from the configured subdomains.
+func (t TileCoord) URLFromTemplate(template string) string {
+	urlTemplateMu.RLock()
+	subs := subdomains
+	urlTemplateMu.RUnlock()
+
+	sub := ""
+	if strings.Contains(template, "{s}") {
+		n := subdomainCounter.Add(1) - 1
+		sub = subs[n%uint64(len(subs))]
+	}
+
+	r := strings.NewReplacer(
+		"{s}", sub,
+		"{z}", strconv.Itoa(t.Zoom),
+		"{x}", strconv.Itoa(t.X),
+		"{y}", strconv.Itoa(t.Y),
+		"{q}", t.Quadkey(),
+	)
+	return r.Replace(template)
 }
 
 // LatLonToTile converts latitude/longitude to tile coordinates at a given zoom level
 func LatLonToTile(lat, lon float64, zoom int) TileCoord {
-	n := math.Pow(2, float64(zoom))
-	x := int((lon + 180.0) / 360.0 * n)
-	latRad := lat * math.Pi / 180.0
-	y := int((1.0 - math.Log(math.Tan(latRad)+1.0/math.Cos(latRad))/math.Pi) / 2.0 * n)
+	fx, fy := Project(lat, lon, zoom)
+	x, y := int(fx), int(fy)
 
 	// Clamp values
 	if x < 0 {
 		x = 0
 	}
-	maxTile := int(n) - 1
+	maxTile := 1<<zoom - 1
 	if x > maxTile {
 		x = maxTile
 	}
@@ -47,13 +177,48 @@ func LatLonToTile(lat, lon float64, zoom int) TileCoord {
 	return TileCoord{X: x, Y: y, Zoom: zoom}
 }
 
+// WrapX wraps a tile column into [0, 2^zoom) so columns past the
+// antimeridian repeat the world
+func WrapX(x, zoom int) int {
+	n := 1 << zoom
+	return ((x % n) + n) % n
+}
+
+// Wrapped returns the tile with its X wrapped into range (see WrapX)
+func (t TileCoord) Wrapped() TileCoord {
+	return TileCoord{X: WrapX(t.X, t.Zoom), Y: t.Y, Zoom: t.Zoom}
+}
+
+// MaxTileZoom is the deepest zoom a TileCoord may have; 2^30 tiles per
+// side is ~4cm per pixel and still fits an int32
+const MaxTileZoom = 30
+
+// Valid reports whether the tile exists: zoom is within 0-MaxTileZoom and X
+// and Y are within the 2^zoom grid
+func (t TileCoord) Valid() bool {
+	if t.Zoom < 0 || t.Zoom > MaxTileZoom {
+		return false
+	}
+	n := 1 << t.Zoom
+	return t.X >= 0 && t.X < n && t.Y >= 0 && t.Y < n
+}
+
 // TileToLatLon converts tile coordinates to latitude/longitude (top-left corner)
 func TileToLatLon(t TileCoord) (lat, lon float64) {
-	n := math.Pow(2, float64(t.Zoom))
-	lon = float64(t.X)/n*360.0 - 180.0
-	latRad := math.Atan(math.Sinh(math.Pi * (1 - 2*float64(t.Y)/n)))
-	lat = latRad * 180.0 / math.Pi
-	return lat, lon
+	return Unproject(float64(t.X), float64(t.Y), t.Zoom)
+}
+
+// TileGeoBounds returns the geographic box a tile covers. X is wrapped
+// around the antimeridian and Y is clamped to the grid, the same way the
+// camera addresses tiles, so edge tiles always get in-range bounds.
+func TileGeoBounds(t TileCoord) (minLon, minLat, maxLon, maxLat float64) {
+	n := 1 << t.Zoom
+	t = t.Wrapped()
+	t.Y = max(0, min(t.Y, n-1))
+
+	maxLat, minLon = TileToLatLon(t)
+	minLat, maxLon = TileToLatLon(TileCoord{X: t.X + 1, Y: t.Y + 1, Zoom: t.Zoom})
+	return minLon, minLat, maxLon, maxLat
 }
 
 // GetAdjacentTiles returns adjacent tiles in priority order for prefetching
@@ -82,15 +247,17 @@ func GetAdjacentTiles(t TileCoord) []TileCoord {
 	return adjacent
 }
 
-// GetVisibleTiles returns all tiles visible in a viewport
+// GetVisibleTiles returns all tiles visible in a viewport, nearest to the
+// center first so the middle of the screen fills in before the edges.
+// Columns wrap across the antimeridian.
 func GetVisibleTiles(centerLat, centerLon float64, zoom int, viewportWidth, viewportHeight int) []TileCoord {
-	tileSize := 256 // Standard tile size
+	size := TileSize()
 
 	centerTile := LatLonToTile(centerLat, centerLon, zoom)
 
 	// Calculate how many tiles fit in the viewport (add buffer for smooth scrolling)
-	tilesX := (viewportWidth / tileSize) + 3
-	tilesY := (viewportHeight / tileSize) + 3
+	tilesX := (viewportWidth / size) + 3
+	tilesY := (viewportHeight / size) + 3
 
 	halfX := tilesX / 2
 	halfY := tilesY / 2
@@ -103,43 +270,97 @@ func GetVisibleTiles(centerLat, centerLon float64, zoom int, viewportWidth, view
 			x := centerTile.X + dx
 			y := centerTile.Y + dy
 
-			if x >= 0 && x <= maxTile && y >= 0 && y <= maxTile {
+			if y >= 0 && y <= maxTile {
 				tiles = append(tiles, TileCoord{X: x, Y: y, Zoom: zoom})
 			}
 		}
 	}
 
-	return tiles
+	sortCenterOut(tiles, centerTile)
+	return wrapUnique(tiles)
+}
+
+// wrapUnique wraps every tile's X across the antimeridian and drops the
+// repeats this creates at low zoom, keeping the first occurrence
+func wrapUnique(tiles []TileCoord) []TileCoord {
+	seen := make(map[TileCoord]bool, len(tiles))
+	out := tiles[:0]
+	for _, t := range tiles {
+		t = t.Wrapped()
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// sortCenterOut orders tiles by distance from center, spiralling outward.
+// Ties keep their row-major order so the result is deterministic.
+func sortCenterOut(tiles []TileCoord, center TileCoord) {
+	dist := func(t TileCoord) int {
+		dx, dy := t.X-center.X, t.Y-center.Y
+		return dx*dx + dy*dy
+	}
+	sort.SliceStable(tiles, func(i, j int) bool {
+		return dist(tiles[i]) < dist(tiles[j])
+	})
 }
 
-// GetPrefetchTiles returns tiles to prefetch (5x viewport area)
+// LookaheadSpeed is the pan speed (screen pixels per second) at which
+// GetDirectionalPrefetchTiles shifts the prefetch area furthest ahead
+const LookaheadSpeed = 2000.0
+
+// GetPrefetchTiles returns tiles to prefetch (5x viewport area), center-out
+// within each zoom level
 func GetPrefetchTiles(centerLat, centerLon float64, zoom int, viewportWidth, viewportHeight int) []TileCoord {
-	tileSize := 256
+	return GetDirectionalPrefetchTiles(centerLat, centerLon, zoom, viewportWidth, viewportHeight, 0, 0)
+}
+
+// GetDirectionalPrefetchTiles is GetPrefetchTiles for a view moving at
+// (velX, velY) screen pixels per second, positive towards east and south.
+// The same number of tiles is shifted ahead of the motion, by up to half
+// the area's radius at LookaheadSpeed, and ordered nearest the lookahead
+// point first.
+func GetDirectionalPrefetchTiles(centerLat, centerLon float64, zoom int, viewportWidth, viewportHeight int, velX, velY float64) []TileCoord {
+	size := TileSize()
 
 	centerTile := LatLonToTile(centerLat, centerLon, zoom)
 
 	// 5x area means sqrt(5) ≈ 2.24x in each dimension, let's use 2.5x
-	tilesX := int(float64(viewportWidth/tileSize+2) * 2.5)
-	tilesY := int(float64(viewportHeight/tileSize+2) * 2.5)
+	tilesX := int(float64(viewportWidth/size+2) * 2.5)
+	tilesY := int(float64(viewportHeight/size+2) * 2.5)
 
 	halfX := tilesX / 2
 	halfY := tilesY / 2
 
+	// Shift ahead of the motion, as a fraction of the half-size
+	aheadX, aheadY := 0.0, 0.0
+	if speed := math.Hypot(velX, velY); speed > 0 {
+		scale := math.Min(speed/LookaheadSpeed, 1) / 2 / speed
+		aheadX, aheadY = velX*scale, velY*scale
+	}
+	offX := int(math.Round(aheadX * float64(halfX)))
+	offY := int(math.Round(aheadY * float64(halfY)))
+	lookahead := TileCoord{X: centerTile.X + offX, Y: centerTile.Y + offY, Zoom: zoom}
+
 	maxTile := int(math.Pow(2, float64(zoom))) - 1
 	tiles := make([]TileCoord, 0, tilesX*tilesY*3) // Room for current + adjacent zoom levels
 
 	// Current zoom level tiles (highest priority)
 	for dy := -halfY; dy <= halfY; dy++ {
 		for dx := -halfX; dx <= halfX; dx++ {
-			x := centerTile.X + dx
-			y := centerTile.Y + dy
+			x := lookahead.X + dx
+			y := lookahead.Y + dy
 
-			if x >= 0 && x <= maxTile && y >= 0 && y <= maxTile {
+			if y >= 0 && y <= maxTile {
 				tiles = append(tiles, TileCoord{X: x, Y: y, Zoom: zoom})
 			}
 		}
 	}
 
+	sortCenterOut(tiles, lookahead)
+
 	// Also prefetch adjacent zoom levels for smoother zooming
 	for _, zoomOffset := range []int{-1, 1} {
 		adjZoom := zoom + zoomOffset
@@ -159,17 +380,25 @@ func GetPrefetchTiles(centerLat, centerLon float64, zoom int, viewportWidth, vie
 			adjHalfY = halfY
 		}
 
+		adjLookahead := TileCoord{
+			X:    adjCenterTile.X + int(math.Round(aheadX*float64(adjHalfX))),
+			Y:    adjCenterTile.Y + int(math.Round(aheadY*float64(adjHalfY))),
+			Zoom: adjZoom,
+		}
+
+		start := len(tiles)
 		for dy := -adjHalfY; dy <= adjHalfY; dy++ {
 			for dx := -adjHalfX; dx <= adjHalfX; dx++ {
-				x := adjCenterTile.X + dx
-				y := adjCenterTile.Y + dy
+				x := adjLookahead.X + dx
+				y := adjLookahead.Y + dy
 
-				if x >= 0 && x <= adjMaxTile && y >= 0 && y <= adjMaxTile {
+				if y >= 0 && y <= adjMaxTile {
 					tiles = append(tiles, TileCoord{X: x, Y: y, Zoom: adjZoom})
 				}
 			}
 		}
+		sortCenterOut(tiles[start:], adjLookahead)
 	}
 
-	return tiles
+	return wrapUnique(tiles)
 }
@@ -0,0 +1,351 @@
+package tiles
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// setSubdomains sets the {s} subdomains for the duration of a test
+func setSubdomains(t *testing.T, subs ...string) {
+	t.Helper()
+	urlTemplateMu.RLock()
+	prev := subdomains
+	urlTemplateMu.RUnlock()
+	if err := SetSubdomains(subs...); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { SetSubdomains(prev...) })
+}
+
+// subdomainOf extracts the host label a URL from subdomainTemplate uses
+func subdomainOf(url string) string {
+	host := strings.TrimPrefix(url, "https://")
+	return host[:strings.Index(host, ".")]
+}
+
+const subdomainTemplate = "https://{s}.tile.example.com/{z}/{x}/{y}.png"
+
+func TestURLFromTemplate(t *testing.T) {
+	setSubdomains(t, "a")
+	coord := TileCoord{X: 3, Y: 5, Zoom: 4}
+	tests := []struct {
+		template, want string
+	}{
+		{"https://tile.example.com/{z}/{x}/{y}.png", "https://tile.example.com/4/3/5.png"},
+		{subdomainTemplate, "https://a.tile.example.com/4/3/5.png"},
+		{"https://tile.example.com/{y}/{x}/{z}", "https://tile.example.com/5/3/4"},
+		{"https://tile.example.com/q/{q}.jpeg", "https://tile.example.com/q/" + coord.Quadkey() + ".jpeg"},
+	}
+	for _, tt := range tests {
+		if got := coord.URLFromTemplate(tt.template); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.template, got, tt.want)
+		}
+	}
+}
+
+func TestSubdomainRotation(t *testing.T) {
+	subs := []string{"a", "b", "c"}
+	setSubdomains(t, subs...)
+	coord := TileCoord{X: 1, Y: 2, Zoom: 3}
+
+	// Consecutive URLs cycle through every subdomain in order
+	first := subdomainOf(coord.URLFromTemplate(subdomainTemplate))
+	start := strings.Index(strings.Join(subs, ""), first)
+	if start < 0 {
+		t.Fatalf("unexpected subdomain %q", first)
+	}
+	for i := 1; i < 2*len(subs); i++ {
+		want := subs[(start+i)%len(subs)]
+		if got := subdomainOf(coord.URLFromTemplate(subdomainTemplate)); got != want {
+			t.Fatalf("URL %d: subdomain %q, want %q", i, got, want)
+		}
+	}
+}
+
+// Templates without {s} must not advance the rotation
+func TestSubdomainRotationSkipsPlainTemplates(t *testing.T) {
+	setSubdomains(t, "a", "b")
+	coord := TileCoord{X: 1, Y: 2, Zoom: 3}
+
+	before := subdomainOf(coord.URLFromTemplate(subdomainTemplate))
+	coord.URLFromTemplate("https://tile.example.com/{z}/{x}/{y}.png")
+	after := subdomainOf(coord.URLFromTemplate(subdomainTemplate))
+	if before == after {
+		t.Errorf("subdomain %q used twice in a row", after)
+	}
+}
+
+// Concurrent callers share the load evenly
+func TestSubdomainRotationConcurrent(t *testing.T) {
+	subs := []string{"a", "b", "c", "d"}
+	setSubdomains(t, subs...)
+	const perSub = 50
+
+	var mu sync.Mutex
+	counts := map[string]int{}
+	var wg sync.WaitGroup
+	for i := 0; i < perSub*len(subs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sub := subdomainOf(TileCoord{Zoom: 1}.URLFromTemplate(subdomainTemplate))
+			mu.Lock()
+			counts[sub]++
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	for _, sub := range subs {
+		if counts[sub] != perSub {
+			t.Errorf("subdomain %q used %d times, want %d (all: %v)", sub, counts[sub], perSub, counts)
+		}
+	}
+}
+
+func TestSetSubdomainsRejectsEmpty(t *testing.T) {
+	if err := SetSubdomains(); err == nil {
+		t.Error("SetSubdomains() accepted an empty list")
+	}
+}
+
+func TestSetURLTemplate(t *testing.T) {
+	prev := URLTemplate()
+	t.Cleanup(func() { SetURLTemplate(prev) })
+
+	tests := []struct {
+		template string
+		want     string // "" = rejected
+	}{
+		{"https://{s}.example.com/{z}/{x}/{y}.png", "https://{s}.example.com/{z}/{x}/{y}.png"},
+		{"https://example.com/%d/%d/%d.png", "https://example.com/{z}/{x}/{y}.png"},
+		{"https://example.com/tiles/{q}", "https://example.com/tiles/{q}"},
+		{"https://example.com/{z}/{x}.png", ""},
+		{"https://example.com/tiles", ""},
+	}
+	for _, tt := range tests {
+		err := SetURLTemplate(tt.template)
+		switch {
+		case tt.want == "" && err == nil:
+			t.Errorf("%s: accepted", tt.template)
+		case tt.want != "" && err != nil:
+			t.Errorf("%s: %v", tt.template, err)
+		case tt.want != "" && URLTemplate() != tt.want:
+			t.Errorf("%s: stored as %s, want %s", tt.template, URLTemplate(), tt.want)
+		}
+	}
+}
+
+// wrappedDist is the squared tile distance between a and b, measured the
+// short way around the antimeridian
+func wrappedDist(a, b TileCoord) int {
+	n := 1 << a.Zoom
+	dx := (a.X - b.X + n) % n
+	dx = min(dx, n-dx)
+	dy := a.Y - b.Y
+	return dx*dx + dy*dy
+}
+
+func TestGetVisibleTilesCenterOut(t *testing.T) {
+	tests := []struct {
+		name     string
+		lat, lon float64
+		zoom     int
+		w, h     int
+	}{
+		{"amsterdam", 52.37, 4.9, 12, 1280, 720},
+		{"tall viewport", -33.87, 151.21, 8, 400, 1600},
+		{"antimeridian", 0, 179.99, 6, 1920, 1080},
+		{"north edge", 85, 0, 5, 1024, 768},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			center := LatLonToTile(tt.lat, tt.lon, tt.zoom)
+			got := GetVisibleTiles(tt.lat, tt.lon, tt.zoom, tt.w, tt.h)
+			if len(got) == 0 || got[0] != center {
+				t.Fatalf("first tile %v, want center %v", got[:min(1, len(got))], center)
+			}
+
+			seen := map[TileCoord]bool{}
+			for i, tile := range got {
+				if !tile.Valid() {
+					t.Errorf("tile %d (%v) is outside the grid", i, tile)
+				}
+				if seen[tile] {
+					t.Errorf("tile %v listed twice", tile)
+				}
+				seen[tile] = true
+				if i > 0 && wrappedDist(tile, center) < wrappedDist(got[i-1], center) {
+					t.Errorf("tile %d (%v) is nearer the center than tile %d (%v)", i, tile, i-1, got[i-1])
+				}
+			}
+		})
+	}
+}
+
+// At low zoom the viewport is wider than the world; wrapped columns must
+// not repeat
+func TestGetVisibleTilesWholeWorld(t *testing.T) {
+	got := GetVisibleTiles(0, 0, 1, 2560, 1440)
+	if len(got) != 4 {
+		t.Errorf("got %d tiles %v, want the 4 tiles of zoom 1", len(got), got)
+	}
+}
+
+func TestGetPrefetchTilesCenterOutPerZoom(t *testing.T) {
+	const zoom = 10
+	lat, lon := 48.8566, 2.3522
+	got := GetPrefetchTiles(lat, lon, zoom, 1280, 720)
+
+	// Current zoom first, then the adjacent levels, each ordered center-out
+	last := map[int]int{}
+	order := []int{}
+	for _, tile := range got {
+		center := LatLonToTile(lat, lon, tile.Zoom)
+		d := wrappedDist(tile, center)
+		prev, ok := last[tile.Zoom]
+		if !ok {
+			order = append(order, tile.Zoom)
+			if d != 0 {
+				t.Errorf("zoom %d starts at %v, not its center %v", tile.Zoom, tile, center)
+			}
+		} else if d < prev {
+			t.Errorf("zoom %d: %v is nearer the center than the tile before it", tile.Zoom, tile)
+		}
+		last[tile.Zoom] = d
+	}
+	if len(order) != 3 || order[0] != zoom {
+		t.Errorf("zoom order %v, want %d first then its neighbours", order, zoom)
+	}
+}
+
+func TestTileCoordValid(t *testing.T) {
+	tests := []struct {
+		tile TileCoord
+		want bool
+	}{
+		{TileCoord{X: 0, Y: 0, Zoom: 0}, true},
+		{TileCoord{X: 1, Y: 0, Zoom: 0}, false},
+		{TileCoord{X: 3, Y: 3, Zoom: 2}, true},
+		{TileCoord{X: 4, Y: 0, Zoom: 2}, false},
+		{TileCoord{X: 0, Y: 4, Zoom: 2}, false},
+		{TileCoord{X: -1, Y: 0, Zoom: 2}, false},
+		{TileCoord{X: 0, Y: -1, Zoom: 2}, false},
+		{TileCoord{X: 0, Y: 0, Zoom: -1}, false},
+		{TileCoord{X: 1<<MaxTileZoom - 1, Y: 1<<MaxTileZoom - 1, Zoom: MaxTileZoom}, true},
+		{TileCoord{X: 0, Y: 0, Zoom: MaxTileZoom + 1}, false},
+		{TileCoord{X: 0, Y: 0, Zoom: 64}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.tile.Valid(); got != tt.want {
+			t.Errorf("%v.Valid() = %v, want %v", tt.tile, got, tt.want)
+		}
+	}
+}
+
+func TestTileGeoBounds(t *testing.T) {
+	const eps = 1e-9
+	tests := []struct {
+		name                           string
+		tile                           TileCoord
+		minLon, minLat, maxLon, maxLat float64
+	}{
+		{"whole world", TileCoord{X: 0, Y: 0, Zoom: 0}, -180, -MaxLatitude, 180, MaxLatitude},
+		{"north-west quarter", TileCoord{X: 0, Y: 0, Zoom: 1}, -180, 0, 0, MaxLatitude},
+		{"south-east quarter", TileCoord{X: 1, Y: 1, Zoom: 1}, 0, -MaxLatitude, 180, 0},
+		{"last column ends at the antimeridian", TileCoord{X: 3, Y: 1, Zoom: 2}, 90, 0, 180, 66.51326044311186},
+		{"east of the antimeridian wraps to the first column", TileCoord{X: 4, Y: 1, Zoom: 2}, -180, 0, -90, 66.51326044311186},
+		{"west of the antimeridian wraps to the last column", TileCoord{X: -1, Y: 1, Zoom: 2}, 90, 0, 180, 66.51326044311186},
+		{"several worlds away", TileCoord{X: 4*3 + 2, Y: 1, Zoom: 2}, 0, 0, 90, 66.51326044311186},
+		{"above the north pole clamps to the top row", TileCoord{X: 0, Y: -3, Zoom: 2}, -180, 66.51326044311186, -90, MaxLatitude},
+		{"below the south pole clamps to the bottom row", TileCoord{X: 0, Y: 9, Zoom: 2}, -180, -MaxLatitude, -90, -66.51326044311186},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			minLon, minLat, maxLon, maxLat := TileGeoBounds(tt.tile)
+			// MaxLatitude is rounded to 4 decimals
+			latEps := eps
+			if math.Abs(tt.maxLat) == MaxLatitude || math.Abs(tt.minLat) == MaxLatitude {
+				latEps = 1e-4
+			}
+			if math.Abs(minLon-tt.minLon) > eps || math.Abs(maxLon-tt.maxLon) > eps ||
+				math.Abs(minLat-tt.minLat) > latEps || math.Abs(maxLat-tt.maxLat) > latEps {
+				t.Errorf("got lon [%v, %v] lat [%v, %v], want lon [%v, %v] lat [%v, %v]",
+					minLon, maxLon, minLat, maxLat, tt.minLon, tt.maxLon, tt.minLat, tt.maxLat)
+			}
+			if minLon >= maxLon || minLat >= maxLat {
+				t.Errorf("empty box lon [%v, %v] lat [%v, %v]", minLon, maxLon, minLat, maxLat)
+			}
+		})
+	}
+}
+
+func TestWrapX(t *testing.T) {
+	tests := []struct {
+		x, zoom, want int
+	}{
+		{0, 0, 0},
+		{5, 0, 0},
+		{3, 2, 3},
+		{4, 2, 0},
+		{-1, 2, 3},
+		{-4, 2, 0},
+		{-9, 2, 3},
+		{13, 3, 5},
+	}
+	for _, tt := range tests {
+		if got := WrapX(tt.x, tt.zoom); got != tt.want {
+			t.Errorf("WrapX(%d, %d) = %d, want %d", tt.x, tt.zoom, got, tt.want)
+		}
+	}
+}
+
+func BenchmarkGetVisibleTiles(b *testing.B) {
+	for _, vp := range [][2]int{{1280, 720}, {3840, 2160}} {
+		b.Run(fmt.Sprintf("%dx%d", vp[0], vp[1]), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				GetVisibleTiles(52.37, 4.9, 14, vp[0], vp[1])
+			}
+		})
+	}
+}
+
+func BenchmarkGetPrefetchTiles(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		GetDirectionalPrefetchTiles(52.37, 4.9, 14, 1920, 1080, 800, -300)
+	}
+}
+
+// The per-tile lookups done every frame for every visible tile
+func BenchmarkTileLookup(b *testing.B) {
+	b.Run("LatLonToTile", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			LatLonToTile(52.37, 4.9, 14)
+		}
+	})
+	b.Run("TileGeoBounds", func(b *testing.B) {
+		tile := TileCoord{X: -3, Y: 5389, Zoom: 14}
+		for i := 0; i < b.N; i++ {
+			TileGeoBounds(tile)
+		}
+	})
+	b.Run("URL", func(b *testing.B) {
+		tile := TileCoord{X: 8419, Y: 5389, Zoom: 14}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			tile.URLFromTemplate(subdomainTemplate)
+		}
+	})
+	b.Run("Quadkey", func(b *testing.B) {
+		tile := TileCoord{X: 8419, Y: 5389, Zoom: 14}
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			tile.Quadkey()
+		}
+	})
+}